@@ -13,8 +13,10 @@ import (
 )
 
 // [sample configuration] - flags
-var cliConfig kubevip.Config
-var cliConfigLB kubevip.LoadBalancer
+var cliConfig = kubevip.Config{LoadBalancers: make([]kubevip.LoadBalancer, 1)}
+
+// The basic Load-Balancer of the configuration, its flags are set in place as a LoadBalancer can't be copied
+var cliConfigLB = &cliConfig.LoadBalancers[0]
 var cliLocalPeer string
 var cliRemotePeers, cliBackends []string
 var priority int32 = 2000001000
@@ -25,17 +27,36 @@ func init() {
 	kubeVipSampleConfig.Flags().StringVar(&cliConfig.VIP, "vip", "192.168.0.1", "The Virtual IP address")
 	kubeVipSampleConfig.Flags().BoolVar(&cliConfig.SingleNode, "singleNode", false, "Start this instance as a single node")
 	kubeVipSampleConfig.Flags().BoolVar(&cliConfig.StartAsLeader, "startAsLeader", false, "Start this instance as the cluster leader")
+	kubeVipSampleConfig.Flags().IntVar(&cliConfig.Priority, "priority", 0, "Priority of this node to hold the VIP, a higher priority node will take leadership")
+	kubeVipSampleConfig.Flags().IntVar(&cliConfig.PreemptDelay, "preemptDelay", 10, "Seconds a higher priority node must be present before it takes leadership")
+	kubeVipSampleConfig.Flags().BoolVar(&cliConfig.NoPreempt, "noPreempt", false, "Keep leadership with the current leader, regardless of priority")
 	kubeVipSampleConfig.Flags().BoolVar(&cliConfig.GratuitousARP, "arp", true, "Use ARP broadcasts to improve VIP re-allocations")
-	kubeVipSampleConfig.Flags().StringVar(&cliLocalPeer, "localPeer", "server1:192.168.0.1:10000", "Settings for this peer, format: id:address:port")
-	kubeVipSampleConfig.Flags().StringSliceVar(&cliRemotePeers, "remotePeers", []string{"server2:192.168.0.2:10000", "server3:192.168.0.3:10000"}, "Comma seperated remotePeers, format: id:address:port")
+	kubeVipSampleConfig.Flags().IntVar(&cliConfig.ARPBurstCount, "arpBurstCount", 3, "Number of gratuitous ARP packets sent when taking over the VIP")
+	kubeVipSampleConfig.Flags().IntVar(&cliConfig.ARPBurstInterval, "arpBurstInterval", 500, "Milliseconds between each gratuitous ARP packet sent when taking over the VIP")
+	kubeVipSampleConfig.Flags().IntVar(&cliConfig.ARPRefreshInterval, "arpRefreshInterval", 3, "Seconds between gratuitous ARP packets after taking over the VIP (negative disables)")
+	kubeVipSampleConfig.Flags().StringVar(&cliConfig.ARPOperation, "arpOperation", "reply", "Type of gratuitous ARP packet to send (reply/request/both)")
+	kubeVipSampleConfig.Flags().StringSliceVar(&cliConfig.ARPInterfaces, "arpInterfaces", []string{}, "Comma seperated additional interfaces to send gratuitous ARP on (e.g. bond slaves or VLANs)")
+	kubeVipSampleConfig.Flags().BoolVar(&cliConfig.DetectConflicts, "detectConflicts", false, "Probe the network for the VIP before adding it, and monitor for other hosts claiming it")
+	kubeVipSampleConfig.Flags().BoolVar(&cliConfig.RefuseOnConflict, "refuseOnConflict", false, "Refuse leadership when another host is using the VIP (requires detectConflicts)")
+	kubeVipSampleConfig.Flags().BoolVar(&cliConfig.EnableEvents, "enableEvents", false, "Record Kubernetes events when the VIP moves, a backend changes state or ARP fails (leader election only)")
+	kubeVipSampleConfig.Flags().StringVar(&cliLocalPeer, "localPeer", "server1:192.168.0.1:10000", "Settings for this peer, format: id:address:port[:priority]")
+	kubeVipSampleConfig.Flags().BoolVar(&cliConfig.EnableRaftTLS, "raftTLS", false, "Use mutual TLS for the RAFT transport, peer certificates must contain the peer id")
+	kubeVipSampleConfig.Flags().StringVar(&cliConfig.RaftTLSCA, "raftTLSCA", "", "Path to the CA used to verify RAFT peers")
+	kubeVipSampleConfig.Flags().StringVar(&cliConfig.RaftTLSCert, "raftTLSCert", "", "Path to the certificate of this RAFT peer")
+	kubeVipSampleConfig.Flags().StringVar(&cliConfig.RaftTLSKey, "raftTLSKey", "", "Path to the private key of this RAFT peer")
+	kubeVipSampleConfig.Flags().StringVar(&cliConfig.AdminAddress, "adminAddress", defaultAdminAddress, "Local address of the admin API used by kube-vip status (empty disables)")
+	kubeVipSampleConfig.Flags().StringSliceVar(&cliRemotePeers, "remotePeers", []string{"server2:192.168.0.2:10000", "server3:192.168.0.3:10000"}, "Comma seperated remotePeers, format: id:address:port[:priority]")
 	// Load Balancer flags
 	kubeVipSampleConfig.Flags().BoolVar(&cliConfigLB.BindToVip, "lbBindToVip", false, "Bind example load balancer to VIP")
 	kubeVipSampleConfig.Flags().BoolVar(&cliConfigLB.EnableProxyProtocol, "lbEnableProxyProtocol", false, "Enable send proxy protocol data to backends")
-	kubeVipSampleConfig.Flags().StringVar(&cliConfigLB.Type, "lbType", "tcp", "Type of load balancer instance (TCP/HTTP)")
+	kubeVipSampleConfig.Flags().StringVar(&cliConfigLB.Type, "lbType", "tcp", "Type of load balancer instance (TCP/UDP/HTTP/TLS)")
 	kubeVipSampleConfig.Flags().StringVar(&cliConfigLB.Name, "lbName", "Example Load Balancer", "The name of a load balancer instance")
 	kubeVipSampleConfig.Flags().IntVar(&cliConfigLB.Port, "lbPort", 6444, "Port that load balancer will expose on")
 	kubeVipSampleConfig.Flags().IntVar(&cliConfigLB.BackendPort, "lbBackEndPort", 6443, "A port that all backends may be using (optional)")
 	kubeVipSampleConfig.Flags().StringSliceVar(&cliBackends, "lbBackends", []string{"192.168.0.1:6443", "192.168.0.2:6443"}, "Comma seperated backends, format: address:port")
+
+	// Sample manifest flags
+	kubeVipSampleManifest.Flags().StringVar(&cliConfig.AdminAddress, "adminAddress", defaultAdminAddress, "Local address of the admin API in the configuration, probed by the kubelet (empty disables the probes)")
 }
 
 var kubeVipSampleConfig = &cobra.Command{
@@ -72,9 +93,6 @@ var kubeVipSampleConfig = &cobra.Command{
 		// 	cliConfigLB.Backends = append(cliConfigLB.Backends, *b)
 		// }
 
-		// Add the basic Load-Balancer to the configuration
-		cliConfig.LoadBalancers = append(cliConfig.LoadBalancers, cliConfigLB)
-
 		err := cliConfig.ParseFlags(cliLocalPeer, cliRemotePeers, cliBackends)
 		if err != nil {
 			cmd.Help()
@@ -95,6 +113,13 @@ var kubeVipSampleManifest = &cobra.Command{
 	Use:   "manifest",
 	Short: "Generate a Sample kubernetes manifest",
 	Run: func(cmd *cobra.Command, args []string) {
+		// The probes use the admin API at the address of the configuration, which is the flag if it is unset
+		liveness, readiness := kubevip.GenerateProbes(cliConfig.AdminAddress)
+		startArgs := []string{"--log=4", "start", "-c", "/etc/kube-vip/config.yaml"}
+		if cliConfig.AdminAddress == "" {
+			startArgs = append(startArgs, "--adminAddress=")
+		}
+
 		// Generate the sample manifest specification
 		p := &appv1.Pod{
 			TypeMeta: metav1.TypeMeta{
@@ -122,12 +147,9 @@ var kubeVipSampleManifest = &cobra.Command{
 								},
 							},
 						},
-						Args: []string{
-							"--log=4",
-							"start",
-							"-c",
-							"/etc/kube-vip/config.yaml",
-						},
+						Args: startArgs,
+						LivenessProbe:  liveness,
+						ReadinessProbe: readiness,
 						Resources: appv1.ResourceRequirements{
 							Requests: appv1.ResourceList{
 								appv1.ResourceCPU: resource.MustParse("250m"),
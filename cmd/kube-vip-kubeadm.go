@@ -17,8 +17,24 @@ import (
 // kubeadm adds two subcommands for managing a vip during a kubeadm init/join
 // It is designed to operate "light" and take minimal input to start
 
-var initConfig kubevip.Config
-var initLoadBalancer kubevip.LoadBalancer
+var initConfig = kubevip.Config{LoadBalancers: make([]kubevip.LoadBalancer, 1)}
+
+// The Load-Balancer of the configuration, its flags are set in place as a LoadBalancer can't be copied
+var initLoadBalancer = &initConfig.LoadBalancers[0]
+var initHealthGates, initHooks []string
+var initHealthGatesInsecure bool
+
+// Access logging of the load balancer
+var initAccessLog kubevip.AccessLog
+
+// Connection limits of the load balancer
+var initLimits kubevip.ConnectionLimits
+var initTimeouts kubevip.ConnectionTimeouts
+var initAffinity kubevip.SessionAffinity
+var initUpstreamTLS kubevip.UpstreamTLS
+var initDNSBackends []string
+var initOutlierDetection bool
+var initOutliers kubevip.OutlierDetection
 
 // Points to a kubernetes configuration file
 var kubeConfigPath string
@@ -34,10 +50,36 @@ func init() {
 	kubeKubeadm.PersistentFlags().StringVar(&initConfig.Interface, "interface", "", "Name of the interface to bind to")
 	kubeKubeadm.PersistentFlags().StringVar(&initConfig.VIP, "vip", "", "The Virtual IP address")
 	kubeKubeadm.PersistentFlags().BoolVar(&initConfig.StartAsLeader, "startAsLeader", false, "Start this instance as the cluster leader")
+	kubeKubeadm.PersistentFlags().BoolVar(&initConfig.EnableRaftTLS, "raftTLS", false, "Use mutual TLS for the RAFT transport, peer certificates must contain the peer id")
+	kubeKubeadm.PersistentFlags().StringVar(&initConfig.RaftTLSCA, "raftTLSCA", "", "Path to the CA used to verify RAFT peers")
+	kubeKubeadm.PersistentFlags().StringVar(&initConfig.RaftTLSCert, "raftTLSCert", "", "Path to the certificate of this RAFT peer")
+	kubeKubeadm.PersistentFlags().StringVar(&initConfig.RaftTLSKey, "raftTLSKey", "", "Path to the private key of this RAFT peer")
+	kubeKubeadm.PersistentFlags().IntVar(&initConfig.Priority, "priority", 0, "Priority of this node to hold the VIP, a higher priority node will take leadership")
+	kubeKubeadm.PersistentFlags().IntVar(&initConfig.PreemptDelay, "preemptDelay", 10, "Seconds a higher priority node must be present before it takes leadership")
+	kubeKubeadm.PersistentFlags().BoolVar(&initConfig.NoPreempt, "noPreempt", false, "Keep leadership with the current leader, regardless of priority")
 
 	kubeKubeadm.PersistentFlags().BoolVar(&initConfig.AddPeersAsBackends, "addPeersToLB", true, "The Virtual IP address")
 	kubeKubeadm.PersistentFlags().BoolVar(&initConfig.GratuitousARP, "arp", true, "Enable Arp for Vip changes")
+	kubeKubeadm.PersistentFlags().IntVar(&initConfig.ARPBurstCount, "arpBurstCount", 3, "Number of gratuitous ARP packets sent when taking over the VIP")
+	kubeKubeadm.PersistentFlags().IntVar(&initConfig.ARPBurstInterval, "arpBurstInterval", 500, "Milliseconds between each gratuitous ARP packet sent when taking over the VIP")
+	kubeKubeadm.PersistentFlags().IntVar(&initConfig.ARPRefreshInterval, "arpRefreshInterval", 3, "Seconds between gratuitous ARP packets after taking over the VIP (negative disables)")
+	kubeKubeadm.PersistentFlags().StringVar(&initConfig.ARPOperation, "arpOperation", "reply", "Type of gratuitous ARP packet to send (reply/request/both)")
+	kubeKubeadm.PersistentFlags().StringSliceVar(&initConfig.ARPInterfaces, "arpInterfaces", []string{}, "Comma seperated additional interfaces to send gratuitous ARP on (e.g. bond slaves or VLANs)")
+	kubeKubeadm.PersistentFlags().BoolVar(&initConfig.DetectConflicts, "detectConflicts", false, "Probe the network for the VIP before adding it, and monitor for other hosts claiming it")
+	kubeKubeadm.PersistentFlags().BoolVar(&initConfig.RefuseOnConflict, "refuseOnConflict", false, "Refuse leadership when another host is using the VIP (requires detectConflicts)")
+	kubeKubeadm.PersistentFlags().BoolVar(&initConfig.EnableEvents, "enableEvents", false, "Record Kubernetes events when the VIP moves, a backend changes state or ARP fails (leader election only)")
 	kubeKubeadm.PersistentFlags().BoolVar(&initConfig.EnableLeaderElection, "leaderElection", false, "Use the Kubernetes leader election mechanism for clustering")
+	kubeKubeadm.PersistentFlags().StringSliceVar(&initConfig.APIServers, "k8sAPIServers", []string{}, "Comma seperated API server endpoints used for leader election (default: hostname:6443), local endpoints are preferred")
+	kubeKubeadm.PersistentFlags().StringVar(&initConfig.LeaderElection.LeaseName, "leaseName", "plunder-lock", "Name of the lock used for leader election")
+	kubeKubeadm.PersistentFlags().StringVar(&initConfig.LeaderElection.LeaseNamespace, "leaseNamespace", "kube-system", "Namespace of the lock used for leader election")
+	kubeKubeadm.PersistentFlags().StringVar(&initConfig.LeaderElection.LeaseLockType, "leaseLockType", "leases", "Type of resource used as the leader election lock (leases/configmaps/endpoints)")
+	kubeKubeadm.PersistentFlags().IntVar(&initConfig.LeaderElection.LeaseDuration, "leaseDuration", 3, "Seconds followers wait before taking an un-renewed lock")
+	kubeKubeadm.PersistentFlags().IntVar(&initConfig.LeaderElection.RenewDeadline, "renewDeadline", 2, "Seconds the leader retries renewing the lock before giving it up")
+	kubeKubeadm.PersistentFlags().IntVar(&initConfig.LeaderElection.RetryPeriod, "retryPeriod", 1, "Seconds between attempts to acquire or renew the lock")
+	kubeKubeadm.PersistentFlags().StringVar(&initConfig.AdminAddress, "adminAddress", defaultAdminAddress, "Local address of the admin API used by kube-vip status (empty disables)")
+	kubeKubeadm.PersistentFlags().StringSliceVar(&initHooks, "hooks", []string{}, "Comma seperated hooks run when the VIP is acquired or released, format: afterAcquire=https://monitor/vip or beforeRelease=exec:///usr/local/bin/flush.sh")
+	kubeKubeadm.PersistentFlags().StringSliceVar(&initHealthGates, "healthGates", []string{}, "Comma seperated local health gates that must pass to hold the VIP, format: https://localhost:6443/healthz or tcp://localhost:6443")
+	kubeKubeadm.PersistentFlags().BoolVar(&initHealthGatesInsecure, "healthGatesInsecure", false, "Don't verify the certificates presented to https health gates")
 	kubeKubeadm.PersistentFlags().BoolVar(&initConfig.EnablePacket, "packet", false, "This will use the Packet API (requires the token ENV) to update the EIP <-> VIP")
 	kubeKubeadm.PersistentFlags().StringVar(&initConfig.PacketAPIKey, "packetKey", "", "The API token for authenticating with the Packet API")
 	kubeKubeadm.PersistentFlags().StringVar(&initConfig.PacketProject, "packetProject", "", "The name of project already created within Packet")
@@ -46,10 +88,51 @@ func init() {
 	kubeKubeadm.PersistentFlags().BoolVar(&initConfig.EnableLoadBalancer, "lbEnable", false, "Enable a load-balancer on the VIP")
 	kubeKubeadm.PersistentFlags().BoolVar(&initLoadBalancer.BindToVip, "lbBindToVip", true, "Bind example load balancer to VIP")
 	kubeKubeadm.PersistentFlags().BoolVar(&initLoadBalancer.EnableProxyProtocol, "lbEnableProxyProtocol", false, "Enable send proxy protocol data to backends")
-	kubeKubeadm.PersistentFlags().StringVar(&initLoadBalancer.Type, "lbType", "tcp", "Type of load balancer instance (TCP/HTTP)")
+	kubeKubeadm.PersistentFlags().IntVar(&initLoadBalancer.Listeners, "lbListeners", 0, "The number of listeners sharing the load balancer port with SO_REUSEPORT (default 1)")
+	kubeKubeadm.PersistentFlags().BoolVar(&initLoadBalancer.FreeBind, "lbFreeBind", false, "Allow the load balancer to bind to an address that isn't present yet")
+	kubeKubeadm.PersistentFlags().StringVar(&initLoadBalancer.Type, "lbType", "tcp", "Type of load balancer instance (TCP/UDP/HTTP/TLS)")
 	kubeKubeadm.PersistentFlags().StringVar(&initLoadBalancer.Name, "lbName", "Kubeadm Load Balancer", "The name of a load balancer instance")
 	kubeKubeadm.PersistentFlags().IntVar(&initLoadBalancer.Port, "lbPort", 6443, "Port that load balancer will expose on")
 	kubeKubeadm.PersistentFlags().IntVar(&initLoadBalancer.BackendPort, "lbBackEndPort", 6444, "A port that all backends may be using (optional)")
+	kubeKubeadm.PersistentFlags().StringVar(&initAccessLog.Path, "lbAccessLog", "", "Log every connection of the load balancer to a file (or stdout)")
+	kubeKubeadm.PersistentFlags().StringSliceVar(&initAccessLog.Fields, "lbAccessLogFields", []string{}, "The fields written to the access log, e.g. client,backend,duration (default all)")
+	kubeKubeadm.PersistentFlags().Float64Var(&initAccessLog.SampleRate, "lbAccessLogSampleRate", 0, "The fraction of connections written to the access log (default 1)")
+	kubeKubeadm.PersistentFlags().IntVar(&initLimits.MaxConnections, "lbMaxConnections", 0, "The maximum concurrent connections to the load balancer (default unlimited)")
+	kubeKubeadm.PersistentFlags().IntVar(&initLimits.MaxClientConnections, "lbMaxClientConnections", 0, "The maximum concurrent connections to the load balancer from a single client IP (default unlimited)")
+	kubeKubeadm.PersistentFlags().Float64Var(&initLimits.ConnectionRate, "lbConnectionRate", 0, "The new connections per second accepted by the load balancer (default unlimited)")
+	kubeKubeadm.PersistentFlags().Float64Var(&initLimits.ClientConnectionRate, "lbClientConnectionRate", 0, "The new connections per second accepted by the load balancer from a single client IP (default unlimited)")
+	kubeKubeadm.PersistentFlags().StringSliceVar(&initLoadBalancer.AllowedSources, "lbAllowedSources", []string{}, "The CIDRs clients of the load balancer must connect from, e.g. 10.0.0.0/8 (default any)")
+	kubeKubeadm.PersistentFlags().StringSliceVar(&initLoadBalancer.DeniedSources, "lbDeniedSources", []string{}, "The CIDRs clients of the load balancer can't connect from")
+	kubeKubeadm.PersistentFlags().BoolVar(&initLoadBalancer.AcceptProxyProtocol, "lbAcceptProxyProtocol", false, "Take the client address from the proxy protocol header of a proxy in front of the load balancer")
+	kubeKubeadm.PersistentFlags().StringSliceVar(&initLoadBalancer.ProxyProtocolTrustedSources, "lbProxyProtocolTrustedSources", []string{}, "The CIDRs of the proxies that may send a proxy protocol header to the load balancer (default any)")
+	kubeKubeadm.PersistentFlags().IntVar(&initLoadBalancer.ProxyProtocolVersion, "lbProxyProtocolVersion", 0, "The version (1 or 2) of the proxy protocol header sent to backends (default 2)")
+	kubeKubeadm.PersistentFlags().BoolVar(&initLoadBalancer.ProxyProtocolTLVs, "lbProxyProtocolTLVs", false, "Pass the TLVs of an incoming proxy protocol header through to backends")
+	kubeKubeadm.PersistentFlags().IntVar(&initLimits.ConnectionBurst, "lbConnectionBurst", 0, "The new connections accepted at once above the connection rates (default the rate rounded up)")
+	kubeKubeadm.PersistentFlags().IntVar(&initTimeouts.ConnectTimeout, "lbConnectTimeout", 0, "The milliseconds to wait when connecting to a backend (default 500)")
+	kubeKubeadm.PersistentFlags().IntVar(&initTimeouts.IdleTimeout, "lbIdleTimeout", 0, "The seconds a connection can go without data before it is closed (default none)")
+	kubeKubeadm.PersistentFlags().IntVar(&initTimeouts.TotalTimeout, "lbTotalTimeout", 0, "The seconds after which a connection is closed (default none)")
+	kubeKubeadm.PersistentFlags().IntVar(&initTimeouts.KeepAlive, "lbKeepAlive", 0, "The seconds between TCP keepalive probes on client and backend connections (default 15, negative disables)")
+	kubeKubeadm.PersistentFlags().StringVar(&initAffinity.Type, "lbAffinity", "", "Pin the connections of a client to a backend by sourceIP, or by cookie or header for http (default none)")
+	kubeKubeadm.PersistentFlags().IntVar(&initAffinity.TTL, "lbAffinityTTL", 0, "The seconds a client stays pinned to a backend (default 10800), or the max age of the cookie (default the browser session)")
+	kubeKubeadm.PersistentFlags().StringVar(&initAffinity.CookieName, "lbAffinityCookie", "", "The name of the session affinity cookie (default KUBEVIP_BACKEND)")
+	kubeKubeadm.PersistentFlags().StringVar(&initAffinity.HeaderName, "lbAffinityHeader", "", "The request header used for session affinity, e.g. X-Session-ID")
+	kubeKubeadm.PersistentFlags().StringSliceVar(&initDNSBackends, "lbDNSBackends", []string{}, "Comma seperated hostnames and SRV names resolved into backends, format: api.example.com:6443 or _https._tcp.example.com")
+	kubeKubeadm.PersistentFlags().IntVar(&initLoadBalancer.DNSRefresh, "lbDNSRefresh", 0, "The seconds between resolving the DNS backends (default the TTL of the answers, between 5 and 300)")
+	kubeKubeadm.PersistentFlags().StringVar(&initUpstreamTLS.CA, "lbUpstreamCA", "", "The path to the CAs that sign the backend certificates (default the system roots)")
+	kubeKubeadm.PersistentFlags().StringVar(&initUpstreamTLS.Certificate, "lbUpstreamCert", "", "The path to the client certificate presented to the backends")
+	kubeKubeadm.PersistentFlags().StringVar(&initUpstreamTLS.Key, "lbUpstreamKey", "", "The path to the private key of the client certificate")
+	kubeKubeadm.PersistentFlags().StringVar(&initUpstreamTLS.ServerName, "lbUpstreamServerName", "", "The server name sent to and verified against the backends (default the backend host)")
+	kubeKubeadm.PersistentFlags().StringVar(&initUpstreamTLS.Verify, "lbUpstreamVerify", "", "How the backend certificates are verified, full, ca or none (default full)")
+	kubeKubeadm.PersistentFlags().BoolVar(&initOutlierDetection, "lbOutlierDetection", false, "Eject backends that keep failing rather than marking them down on their first failure")
+	kubeKubeadm.PersistentFlags().IntVar(&initOutliers.ConsecutiveFailures, "lbOutlierConsecutiveFailures", 0, "The failures in a row that eject a backend (default 5, negative disables)")
+	kubeKubeadm.PersistentFlags().IntVar(&initOutliers.FailureRate, "lbOutlierFailureRate", 0, "The percentage of failures within an interval that eject a backend (default disabled)")
+	kubeKubeadm.PersistentFlags().IntVar(&initOutliers.MinimumRequests, "lbOutlierMinimumRequests", 0, "The connections within an interval before the failure rate of a backend is judged (default 10)")
+	kubeKubeadm.PersistentFlags().IntVar(&initOutliers.Interval, "lbOutlierInterval", 0, "The seconds the failure rate is measured over (default 10)")
+	kubeKubeadm.PersistentFlags().IntVar(&initOutliers.BaseEjectionTime, "lbOutlierBaseEjectionTime", 0, "The seconds of the first ejection of a backend, which doubles with each ejection (default 30)")
+	kubeKubeadm.PersistentFlags().IntVar(&initOutliers.MaxEjectionTime, "lbOutlierMaxEjectionTime", 0, "The most seconds a backend is ejected for (default 300)")
+	kubeKubeadm.PersistentFlags().IntVar(&initOutliers.MaxEjectionPercent, "lbOutlierMaxEjectionPercent", 0, "The most of the backends that can be ejected at once (default 50)")
+	kubeKubeadm.PersistentFlags().IntVar(&initOutliers.SlowStart, "lbSlowStart", 0, "The seconds a returning backend is ramped up over (default none)")
+	kubeKubeadm.PersistentFlags().IntVar(&initOutliers.MaxConnections, "lbBackendMaxConnections", 0, "The most connections (or requests) a backend is sent at once (default unlimited)")
 
 	kubeKubeadmJoin.Flags().StringVar(&kubeConfigPath, "config", "/etc/kubernetes/admin.conf", "The path of a Kubernetes configuration file")
 
@@ -72,10 +155,15 @@ var kubeKubeadmInit = &cobra.Command{
 	Long:  "The \"init\" subcommand will generate the Kubernetes manifest that will be started by kubeadm through the kubeadm init process",
 	Run: func(cmd *cobra.Command, args []string) {
 		// Set the logging level for all subsequent functions
-		log.SetLevel(log.Level(logLevel))
-		initConfig.LoadBalancers = append(initConfig.LoadBalancers, initLoadBalancer)
+		configureLogging()
+		if err := buildKubeadmConfig(); err != nil {
+			cmd.Help()
+			log.Fatalln(err)
+		}
 		// TODO - A load of text detailing what's actually happening
-		kubevip.ParseEnvironment(&initConfig)
+		if err := kubevip.ParseEnvironment(&initConfig); err != nil {
+			log.Fatalln(err)
+		}
 		// TODO - check for certain things VIP/interfaces
 		if initConfig.Interface == "" {
 			cmd.Help()
@@ -97,11 +185,15 @@ var kubeKubeadmJoin = &cobra.Command{
 	Short: "kube-vip join",
 	Run: func(cmd *cobra.Command, args []string) {
 		// Set the logging level for all subsequent functions
-		log.SetLevel(log.Level(logLevel))
-
-		initConfig.LoadBalancers = append(initConfig.LoadBalancers, initLoadBalancer)
+		configureLogging()
+		if err := buildKubeadmConfig(); err != nil {
+			cmd.Help()
+			log.Fatalln(err)
+		}
 		// TODO - A load of text detailing what's actually happening
-		kubevip.ParseEnvironment(&initConfig)
+		if err := kubevip.ParseEnvironment(&initConfig); err != nil {
+			log.Fatalln(err)
+		}
 		// TODO - check for certain things VIP/interfaces
 		if initConfig.Interface == "" {
 			cmd.Help()
@@ -147,7 +239,7 @@ var kubeKubeadmJoin = &cobra.Command{
 				}
 			}
 
-			newPeer, err := kubevip.ParsePeerConfig(fmt.Sprintf("%s:%s:%d", nodeHostname, nodeAddress, 10000))
+			newPeer, err := kubevip.ParsePeerConfig(fmt.Sprintf("%s:%s", nodeHostname, net.JoinHostPort(nodeAddress, "10000")))
 			if err != nil {
 				panic(err.Error())
 			}
@@ -191,3 +283,72 @@ func autoGenLocalPeer() (*kubevip.RaftPeer, error) {
 	}, nil
 
 }
+
+// buildKubeadmConfig validates the flags shared by init and join, adding the load balancer, health gates and hooks to
+// the configuration
+func buildKubeadmConfig() error {
+	if err := buildLoadBalancer(); err != nil {
+		return err
+	}
+	if err := initConfig.ParseHealthGates(initHealthGates, initHealthGatesInsecure); err != nil {
+		return err
+	}
+	if err := initConfig.ParseHooks(initHooks); err != nil {
+		return err
+	}
+	return kubevip.ValidateARPOperation(initConfig.ARPOperation)
+}
+
+// buildLoadBalancer validates the load balancer flags, and sets their options on the load balancer of the configuration
+func buildLoadBalancer() error {
+	if initAccessLog.Path != "" {
+		if err := initAccessLog.Validate(); err != nil {
+			return err
+		}
+		initLoadBalancer.AccessLog = &initAccessLog
+	}
+	if initLimits != (kubevip.ConnectionLimits{}) {
+		if err := initLimits.Validate(); err != nil {
+			return err
+		}
+		initLoadBalancer.Limits = &initLimits
+	}
+	if initTimeouts != (kubevip.ConnectionTimeouts{}) {
+		if err := initTimeouts.Validate(); err != nil {
+			return err
+		}
+		initLoadBalancer.Timeouts = &initTimeouts
+	}
+	if initAffinity.Type != "" {
+		if err := initAffinity.Validate(initLoadBalancer.Type); err != nil {
+			return err
+		}
+		initLoadBalancer.Affinity = &initAffinity
+	}
+	for _, name := range initDNSBackends {
+		d, err := kubevip.ParseDNSBackend(name)
+		if err != nil {
+			return err
+		}
+		initLoadBalancer.DNSBackends = append(initLoadBalancer.DNSBackends, *d)
+	}
+	if initUpstreamTLS != (kubevip.UpstreamTLS{}) {
+		if err := initUpstreamTLS.Validate(); err != nil {
+			return err
+		}
+		initLoadBalancer.UpstreamTLS = &initUpstreamTLS
+	}
+	if initOutlierDetection || initOutliers != (kubevip.OutlierDetection{}) {
+		if err := initOutliers.Validate(); err != nil {
+			return err
+		}
+		initLoadBalancer.OutlierDetection = &initOutliers
+	}
+	if _, err := kubevip.ParseSources(append(initLoadBalancer.AllowedSources, initLoadBalancer.DeniedSources...)); err != nil {
+		return err
+	}
+	if err := initLoadBalancer.ValidateProxyProtocol(); err != nil {
+		return err
+	}
+	return nil
+}
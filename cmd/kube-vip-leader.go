@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/cluster"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// The node to transfer leadership to
+var transferTo string
+
+const (
+	// transferConfirmTimeout is how long the status is watched for another node taking leadership
+	transferConfirmTimeout = 10 * time.Second
+	// transferConfirmInterval is how often the status is checked whilst waiting
+	transferConfirmInterval = 500 * time.Millisecond
+)
+
+func init() {
+	kubeVipLeaderTransfer.Flags().StringVar(&transferTo, "to", "", "ID of the node to transfer leadership to (default: any other node, raft only)")
+	kubeVipLeader.PersistentFlags().StringVar(&adminAPIAddress, "address", defaultAdminAddress, "Address of the kube-vip admin API")
+	kubeVipMaintenance.Flags().StringVar(&adminAPIAddress, "address", defaultAdminAddress, "Address of the kube-vip admin API")
+
+	kubeVipLeader.AddCommand(kubeVipLeaderTransfer)
+}
+
+var kubeVipLeader = &cobra.Command{
+	Use:   "leader",
+	Short: "Manage the leadership of the cluster through the local kube-vip instance",
+}
+
+var kubeVipLeaderTransfer = &cobra.Command{
+	Use:   "transfer",
+	Short: "Transfer leadership (and the VIP) from this node to another node in the cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		var before cluster.Status
+		err := adminRequest(http.MethodGet, "/status", &before)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		err = adminRequest(http.MethodPost, "/leader/transfer?to="+url.QueryEscape(transferTo), nil)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if leader := confirmTransfer(before.Leader); leader != "" {
+			fmt.Printf("Leadership has been transferred to [%s]\n", leader)
+			return
+		}
+		fmt.Println("Leadership release requested, no other node has been confirmed as the leader yet")
+	},
+}
+
+// confirmTransfer watches the status until another node than the previous leader is leading, returning that leader
+// or an empty string if none was confirmed in time
+func confirmTransfer(previous string) string {
+	deadline := time.Now().Add(transferConfirmTimeout)
+	for time.Now().Before(deadline) {
+		var status cluster.Status
+		if adminRequest(http.MethodGet, "/status", &status) == nil && !status.IsLeader && status.Leader != "" && status.Leader != previous {
+			return status.Leader
+		}
+		time.Sleep(transferConfirmInterval)
+	}
+	return ""
+}
+
+var kubeVipMaintenance = &cobra.Command{
+	Use:   "maintenance [on|off]",
+	Short: "Place this node into maintenance (giving up the VIP and draining its load balancers), or clear it",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		method := http.MethodGet
+		if len(args) == 1 {
+			switch args[0] {
+			case "on":
+				method = http.MethodPost
+			case "off":
+				method = http.MethodDelete
+			default:
+				log.Fatalf("Unknown maintenance state [%s], expected on or off", args[0])
+			}
+		}
+
+		var state struct {
+			Maintenance bool `json:"maintenance"`
+		}
+		err := adminRequest(method, "/maintenance", &state)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Printf("Maintenance: %t\n", state.Maintenance)
+	},
+}
@@ -3,10 +3,11 @@ package cmd
 import (
 	"fmt"
 	"github.com/ghodss/yaml"
+	"net"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/plunder-app/kube-vip/pkg/cluster"
 	"github.com/plunder-app/kube-vip/pkg/kubevip"
@@ -18,7 +19,8 @@ import (
 var startConfig kubevip.Config
 var startConfigLB kubevip.LoadBalancer
 var startLocalPeer, startKubeConfigPath string
-var startRemotePeers, startBackends []string
+var startRemotePeers, startBackends, startHealthGates, startHooks []string
+var startHealthGatesInsecure bool
 var inCluster bool
 
 func init() {
@@ -31,13 +33,28 @@ func init() {
 	kubeVipStart.Flags().StringVar(&startConfig.VIP, "vip", "192.168.0.1", "The Virtual IP address")
 	kubeVipStart.Flags().BoolVar(&startConfig.SingleNode, "singleNode", false, "Start this instance as a single node")
 	kubeVipStart.Flags().BoolVar(&startConfig.StartAsLeader, "startAsLeader", false, "Start this instance as the cluster leader")
+	kubeVipStart.Flags().IntVar(&startConfig.Priority, "priority", 0, "Priority of this node to hold the VIP, a higher priority node will take leadership")
+	kubeVipStart.Flags().IntVar(&startConfig.PreemptDelay, "preemptDelay", 10, "Seconds a higher priority node must be present before it takes leadership")
+	kubeVipStart.Flags().BoolVar(&startConfig.NoPreempt, "noPreempt", false, "Keep leadership with the current leader, regardless of priority")
 	kubeVipStart.Flags().BoolVar(&startConfig.GratuitousARP, "arp", false, "Use ARP broadcasts to improve VIP re-allocations")
-	kubeVipStart.Flags().StringVar(&startLocalPeer, "localPeer", "server1:192.168.0.1:10000", "Settings for this peer, format: id:address:port")
-	kubeVipStart.Flags().StringSliceVar(&startRemotePeers, "remotePeers", []string{"server2:192.168.0.2:10000", "server3:192.168.0.3:10000"}, "Comma seperated remotePeers, format: id:address:port")
+	kubeVipStart.Flags().IntVar(&startConfig.ARPBurstCount, "arpBurstCount", 3, "Number of gratuitous ARP packets sent when taking over the VIP")
+	kubeVipStart.Flags().IntVar(&startConfig.ARPBurstInterval, "arpBurstInterval", 500, "Milliseconds between each gratuitous ARP packet sent when taking over the VIP")
+	kubeVipStart.Flags().IntVar(&startConfig.ARPRefreshInterval, "arpRefreshInterval", 3, "Seconds between gratuitous ARP packets after taking over the VIP (negative disables)")
+	kubeVipStart.Flags().StringVar(&startConfig.ARPOperation, "arpOperation", "reply", "Type of gratuitous ARP packet to send (reply/request/both)")
+	kubeVipStart.Flags().StringSliceVar(&startConfig.ARPInterfaces, "arpInterfaces", []string{}, "Comma seperated additional interfaces to send gratuitous ARP on (e.g. bond slaves or VLANs)")
+	kubeVipStart.Flags().BoolVar(&startConfig.DetectConflicts, "detectConflicts", false, "Probe the network for the VIP before adding it, and monitor for other hosts claiming it")
+	kubeVipStart.Flags().BoolVar(&startConfig.RefuseOnConflict, "refuseOnConflict", false, "Refuse leadership when another host is using the VIP (requires detectConflicts)")
+	kubeVipStart.Flags().BoolVar(&startConfig.EnableEvents, "enableEvents", false, "Record Kubernetes events when the VIP moves, a backend changes state or ARP fails (leader election only)")
+	kubeVipStart.Flags().StringVar(&startLocalPeer, "localPeer", "server1:192.168.0.1:10000", "Settings for this peer, format: id:address:port[:priority]")
+	kubeVipStart.Flags().BoolVar(&startConfig.EnableRaftTLS, "raftTLS", false, "Use mutual TLS for the RAFT transport, peer certificates must contain the peer id")
+	kubeVipStart.Flags().StringVar(&startConfig.RaftTLSCA, "raftTLSCA", "", "Path to the CA used to verify RAFT peers")
+	kubeVipStart.Flags().StringVar(&startConfig.RaftTLSCert, "raftTLSCert", "", "Path to the certificate of this RAFT peer")
+	kubeVipStart.Flags().StringVar(&startConfig.RaftTLSKey, "raftTLSKey", "", "Path to the private key of this RAFT peer")
+	kubeVipStart.Flags().StringSliceVar(&startRemotePeers, "remotePeers", []string{"server2:192.168.0.2:10000", "server3:192.168.0.3:10000"}, "Comma seperated remotePeers, format: id:address:port[:priority]")
 	// Load Balancer flags
 	kubeVipStart.Flags().BoolVar(&startConfigLB.BindToVip, "lbBindToVip", false, "Bind example load balancer to VIP")
 	kubeVipStart.Flags().BoolVar(&startConfigLB.EnableProxyProtocol, "lbEnableProxyProtocol", false, "Enable send proxy protocol data to backends")
-	kubeVipStart.Flags().StringVar(&startConfigLB.Type, "lbType", "tcp", "Type of load balancer instance (TCP/HTTP)")
+	kubeVipStart.Flags().StringVar(&startConfigLB.Type, "lbType", "tcp", "Type of load balancer instance (TCP/UDP/HTTP/TLS)")
 	kubeVipStart.Flags().StringVar(&startConfigLB.Name, "lbName", "Example Load Balancer", "The name of a load balancer instance")
 	kubeVipStart.Flags().IntVar(&startConfigLB.Port, "lbPort", 6444, "Port that load balancer will expose on")
 	kubeVipStart.Flags().IntVar(&startConfigLB.BackendPort, "lbBackEndPort", 6443, "A port that all backends may be using (optional)")
@@ -46,7 +63,18 @@ func init() {
 	// Cluster configuration
 	kubeVipStart.Flags().StringVar(&startKubeConfigPath, "kubeConfig", "/etc/kubernetes/admin.conf", "The path of a kubernetes configuration file")
 	kubeVipStart.Flags().BoolVar(&inCluster, "inCluster", false, "Use the incluster token to authenticate to Kubernetes")
+	kubeVipStart.Flags().StringSliceVar(&startConfig.APIServers, "k8sAPIServers", []string{}, "Comma seperated API server endpoints used for leader election (default: hostname:6443), local endpoints are preferred")
 	kubeVipStart.Flags().BoolVar(&startConfig.EnableLeaderElection, "leaderElection", false, "Use the Kubernetes leader election mechanism for clustering")
+	kubeVipStart.Flags().StringVar(&startConfig.LeaderElection.LeaseName, "leaseName", "plunder-lock", "Name of the lock used for leader election")
+	kubeVipStart.Flags().StringVar(&startConfig.LeaderElection.LeaseNamespace, "leaseNamespace", "kube-system", "Namespace of the lock used for leader election")
+	kubeVipStart.Flags().StringVar(&startConfig.LeaderElection.LeaseLockType, "leaseLockType", "leases", "Type of resource used as the leader election lock (leases/configmaps/endpoints)")
+	kubeVipStart.Flags().IntVar(&startConfig.LeaderElection.LeaseDuration, "leaseDuration", 3, "Seconds followers wait before taking an un-renewed lock")
+	kubeVipStart.Flags().IntVar(&startConfig.LeaderElection.RenewDeadline, "renewDeadline", 2, "Seconds the leader retries renewing the lock before giving it up")
+	kubeVipStart.Flags().IntVar(&startConfig.LeaderElection.RetryPeriod, "retryPeriod", 1, "Seconds between attempts to acquire or renew the lock")
+	kubeVipStart.Flags().StringVar(&startConfig.AdminAddress, "adminAddress", defaultAdminAddress, "Local address of the admin API used by kube-vip status (empty disables)")
+	kubeVipStart.Flags().StringSliceVar(&startHooks, "hooks", []string{}, "Comma seperated hooks run when the VIP is acquired or released, format: afterAcquire=https://monitor/vip or beforeRelease=exec:///usr/local/bin/flush.sh")
+	kubeVipStart.Flags().StringSliceVar(&startHealthGates, "healthGates", []string{}, "Comma seperated local health gates that must pass to hold the VIP, format: https://localhost:6443/healthz or tcp://localhost:6443")
+	kubeVipStart.Flags().BoolVar(&startHealthGatesInsecure, "healthGatesInsecure", false, "Don't verify the certificates presented to https health gates")
 
 }
 
@@ -55,16 +83,36 @@ var kubeVipStart = &cobra.Command{
 	Short: "Start the Virtual IP / Load balancer",
 	Run: func(cmd *cobra.Command, args []string) {
 		// Set the logging level for all subsequent functions
-		log.SetLevel(log.Level(logLevel))
+		configureLogging()
 		var err error
 
-		// If a configuration file is loaded, then it will overwrite flags
+		err = startConfig.ParseHealthGates(startHealthGates, startHealthGatesInsecure)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		err = startConfig.ParseHooks(startHooks)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		err = kubevip.ValidateARPOperation(startConfig.ARPOperation)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		// If a configuration file is loaded, then it will overwrite flags (the health gates and hooks from flags are
+		// added to those of the file)
 
 		if configPath != "" {
 			c, err := kubevip.OpenConfig(configPath)
 			if err != nil {
 				log.Fatalf("%v", err)
 			}
+			// A configuration file without an admin address uses the flag, so the admin API matches the probes
+			if c.AdminAddress == "" {
+				c.AdminAddress = startConfig.AdminAddress
+			}
+			c.HealthGates = append(c.HealthGates, startConfig.HealthGates...)
+			c.Hooks = append(c.Hooks, startConfig.Hooks...)
 			startConfig = *c
 		}
 
@@ -73,13 +121,15 @@ var kubeVipStart = &cobra.Command{
 		if err != nil {
 			log.Fatalln(err)
 		}
+		// Hooks from the configuration file haven't been checked yet
+		err = startConfig.ValidateHooks()
+		if err != nil {
+			log.Fatalln(err)
+		}
 
-		if log.GetLevel() >= log.DebugLevel {
+		if log.IsLevelEnabled(log.DebugLevel) {
 			config, _ := yaml.Marshal(startConfig)
-			// for log output orderly
-			time.Sleep(time.Millisecond * 500)
-			fmt.Println(string(config))
-			time.Sleep(time.Millisecond * 500)
+			log.WithField("config", string(config)).Debugln("Loaded [config.yaml]")
 		}
 
 		if startConfig.AddPeersAsBackends {
@@ -91,8 +141,8 @@ var kubeVipStart = &cobra.Command{
 		for lx := range startConfig.LoadBalancers {
 			lb := &startConfig.LoadBalancers[lx]
 
-			// after testing, when type is http, vip can not work as expected
-			if strings.ToLower(lb.Type) != "tcp" && strings.ToLower(lb.Type) != "udp" {
+			lbType := strings.ToLower(lb.Type)
+			if lbType != "tcp" && lbType != "udp" && lbType != "tls" && lbType != "http" {
 				log.Fatalf("Load balancer does not support the [%s] type", lb.Type)
 			}
 
@@ -128,22 +178,32 @@ var kubeVipStart = &cobra.Command{
 
 			// set backend.port with backendPort
 			for x := range lb.Backends {
+				// a http backend is its URL, whose port is that of its scheme if it has none
+				key := lb.Backends[x].Address
+				if lb.Backends[x].RawURL != "" {
+					key = lb.Backends[x].RawURL
+				}
 				// already contain
-				if _, ok := existMap[lb.Backends[x].Address]; ok {
+				if _, ok := existMap[key]; ok {
 					continue
 				}
-				existMap[lb.Backends[x].Address] = lb.Backends[x].Address
+				existMap[key] = key
 
 				// not set alone
-				if lb.Backends[x].Port == 0 {
+				if lb.Backends[x].Port == 0 && lb.Backends[x].RawURL == "" {
 					log.Debugf("Load Balancer [%s] backend [%s] use default backendPort [%d]", lb.Name, lb.Backends[x].Address, backendPort)
 					lb.Backends[x].Port = backendPort
 				}
+				// a http backend is a URL, so a backend given by its address (e.g. a peer) is given one
+				if lbType == "http" && lb.Backends[x].RawURL == "" {
+					lb.Backends[x].RawURL = fmt.Sprintf("http://%s/", net.JoinHostPort(lb.Backends[x].Address, strconv.Itoa(lb.Backends[x].Port)))
+				}
 
 				backends = append(backends, kubevip.BackEnd{
 					Alive:    true,
 					Address:  lb.Backends[x].Address,
 					Port:     lb.Backends[x].Port,
+					RawURL:   lb.Backends[x].RawURL,
 				})
 			}
 
@@ -151,13 +211,9 @@ var kubeVipStart = &cobra.Command{
 			lb.Backends = backends
 		}
 
-		if log.GetLevel() >= log.DebugLevel {
+		if log.IsLevelEnabled(log.DebugLevel) {
 			config, _ := yaml.Marshal(startConfig)
-			log.Debugln("Effective [config.yaml]")
-			// for log output orderly
-			time.Sleep(time.Millisecond * 500)
-			fmt.Println(string(config))
-			time.Sleep(time.Millisecond * 500)
+			log.WithField("config", string(config)).Debugln("Effective [config.yaml]")
 		}
 
 		var newCluster *cluster.Cluster
@@ -168,6 +224,7 @@ var kubeVipStart = &cobra.Command{
 			if err != nil {
 				log.Fatalf("%v", err)
 			}
+			startAdmin(newCluster, startConfig.AdminAddress)
 			// Start a single node cluster
 			newCluster.StartSingleNode(&startConfig, disableVIP)
 		} else {
@@ -180,9 +237,10 @@ var kubeVipStart = &cobra.Command{
 			if err != nil {
 				log.Fatalf("%v", err)
 			}
+			startAdmin(newCluster, startConfig.AdminAddress)
 
 			if startConfig.EnableLeaderElection {
-				cm, err := cluster.NewManager(startKubeConfigPath, inCluster)
+				cm, err := cluster.NewManager(startKubeConfigPath, inCluster, &startConfig)
 				if err != nil {
 					log.Fatalf("%v", err)
 				}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/cluster"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// defaultAdminAddress is the local address of the admin API
+const defaultAdminAddress = "127.0.0.1:10269"
+
+// Address of the admin API to query
+var adminAPIAddress string
+
+// Output the status as JSON
+var statusJSON bool
+
+func init() {
+	kubeVipStatus.Flags().StringVar(&adminAPIAddress, "address", defaultAdminAddress, "Address of the kube-vip admin API")
+	kubeVipStatus.Flags().BoolVar(&statusJSON, "json", false, "Output the status as JSON")
+}
+
+var kubeVipStatus = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of the cluster from the local kube-vip instance",
+	Run: func(cmd *cobra.Command, args []string) {
+		var status cluster.Status
+		err := adminRequest(http.MethodGet, "/status", &status)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		if statusJSON {
+			b, _ := json.MarshalIndent(status, "", "  ")
+			fmt.Println(string(b))
+			return
+		}
+		printStatus(&status)
+	},
+}
+
+// adminRequest sends a request to the admin API, decoding any response into out
+func adminRequest(method, path string, out interface{}) error {
+	req, err := http.NewRequest(method, fmt.Sprintf("http://%s%s", adminAPIAddress, path), nil)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach the admin API [%s] -> error [%v]", adminAPIAddress, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("the admin API returned [%s] -> %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// startAdmin will start the admin API of a cluster, if an address has been configured
+func startAdmin(newCluster *cluster.Cluster, address string) {
+	if address == "" {
+		return
+	}
+	err := newCluster.StartAdmin(address)
+	if err != nil {
+		log.Warnf("%v", err)
+	}
+}
+
+// printStatus writes the status as tables
+func printStatus(status *cluster.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintf(w, "Mode:\t%s\n", status.Mode)
+	fmt.Fprintf(w, "Node:\t%s\n", status.ID)
+	fmt.Fprintf(w, "Leader:\t%s\n", status.Leader)
+	if status.Mode == cluster.ModeRaft {
+		fmt.Fprintf(w, "Term:\t%d\n", status.Term)
+		fmt.Fprintf(w, "Index (last/commit/applied):\t%d/%d/%d\n", status.LastIndex, status.CommitIndex, status.AppliedIndex)
+	}
+	if status.VIP != "" {
+		fmt.Fprintf(w, "VIP:\t%s (%s)\n", status.VIP, status.Interface)
+		fmt.Fprintf(w, "Holds VIP:\t%t\n", status.HoldsVIP)
+	}
+	w.Flush()
+
+	if len(status.Peers) != 0 {
+		fmt.Println()
+		fmt.Fprintln(w, "PEER\tADDRESS\tSUFFRAGE\tLEADER\tREACHABLE")
+		for _, p := range status.Peers {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%t\n", p.ID, p.Address, p.Suffrage, p.Leader, p.Reachable)
+		}
+		w.Flush()
+	}
+
+	if len(status.LoadBalancers) != 0 {
+		fmt.Println()
+		fmt.Fprintln(w, "LOAD BALANCER\tTYPE\tLISTENER\tBACKEND\tALIVE")
+		for _, lb := range status.LoadBalancers {
+			if len(lb.Backends) == 0 {
+				fmt.Fprintf(w, "%s\t%s\t%s\t-\t-\n", lb.Name, lb.Type, lb.Address)
+			}
+			for _, be := range lb.Backends {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\n", lb.Name, lb.Type, lb.Address, net.JoinHostPort(be.Address, strconv.Itoa(be.Port)), be.Alive)
+			}
+		}
+		w.Flush()
+	}
+}
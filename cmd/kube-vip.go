@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+	"github.com/plunder-app/kube-vip/pkg/logging"
 	"github.com/plunder-app/kube-vip/pkg/service"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -25,6 +28,12 @@ var configMap string
 // Configure the level of loggin
 var logLevel uint32
 
+// Configure the format of logs (text/logfmt/json)
+var logFormat string
+
+// Configure the level of individual subsystems (e.g. raft=warn)
+var logLevels []string
+
 // Release - this struct contains the release information populated when building kube-vip
 var Release struct {
 	Version string
@@ -40,17 +49,28 @@ func init() {
 
 	// Manage logging
 	kubeVipCmd.PersistentFlags().Uint32Var(&logLevel, "log", 4, "Set the level of logging")
+	kubeVipCmd.PersistentFlags().StringVar(&logFormat, "logFormat", logging.FormatText, "Set the format of logging (text/logfmt/json)")
+	kubeVipCmd.PersistentFlags().StringSliceVar(&logLevels, "logLevels", []string{}, "Set the level of logging per subsystem, e.g. raft=warn,arp=debug (vip/arp/raft/election/loadbalancer/service)")
 
 	// Service flags
 	kubeVipService.Flags().StringVarP(&configMap, "configMap", "c", "kube-vip", "The configuration map defined within the cluster")
 	kubeVipService.Flags().StringVarP(&service.Interface, "interface", "i", "eth0", "Name of the interface to bind to")
 	kubeVipService.Flags().BoolVar(&service.OutSideCluster, "OutSideCluster", false, "Start Controller outside of cluster")
 	kubeVipService.Flags().BoolVar(&service.EnableArp, "arp", false, "Use ARP broadcasts to improve VIP re-allocations")
+	kubeVipService.Flags().StringVar(&service.LeaderElection.LeaseName, "leaseName", "plunder-lock", "Name of the lock used for leader election")
+	kubeVipService.Flags().StringVar(&service.LeaderElection.LeaseNamespace, "leaseNamespace", "", "Namespace of the lock used for leader election (default: namespace of the pod)")
+	kubeVipService.Flags().StringVar(&service.LeaderElection.LeaseLockType, "leaseLockType", "leases", "Type of resource used as the leader election lock (leases/configmaps/endpoints)")
+	kubeVipService.Flags().IntVar(&service.LeaderElection.LeaseDuration, "leaseDuration", 10, "Seconds followers wait before taking an un-renewed lock")
+	kubeVipService.Flags().IntVar(&service.LeaderElection.RenewDeadline, "renewDeadline", 5, "Seconds the leader retries renewing the lock before giving it up")
+	kubeVipService.Flags().IntVar(&service.LeaderElection.RetryPeriod, "retryPeriod", 1, "Seconds between attempts to acquire or renew the lock")
 
 	kubeVipCmd.AddCommand(kubeKubeadm)
+	kubeVipCmd.AddCommand(kubeVipLeader)
+	kubeVipCmd.AddCommand(kubeVipMaintenance)
 	kubeVipCmd.AddCommand(kubeVipSample)
 	kubeVipCmd.AddCommand(kubeVipService)
 	kubeVipCmd.AddCommand(kubeVipStart)
+	kubeVipCmd.AddCommand(kubeVipStatus)
 	kubeVipCmd.AddCommand(kubeVipVersion)
 
 	// Sample commands
@@ -59,6 +79,25 @@ func init() {
 
 }
 
+// configureLogging - sets the format and levels of logging from the flags, the environment variables
+// vip_logformat and vip_loglevels take precedence
+func configureLogging() {
+	if envFormat := os.Getenv("vip_logformat"); envFormat != "" {
+		logFormat = envFormat
+	}
+	if envLevels := os.Getenv("vip_loglevels"); envLevels != "" {
+		logLevels = strings.Split(envLevels, ",")
+	}
+
+	levels, err := logging.ParseLevels(logLevels)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err = logging.Configure(logFormat, log.Level(logLevel), levels); err != nil {
+		log.Fatalln(err)
+	}
+}
+
 // Execute - starts the command parsing process
 func Execute() {
 	if err := kubeVipCmd.Execute(); err != nil {
@@ -90,7 +129,7 @@ var kubeVipService = &cobra.Command{
 	Short: "Start the Virtual IP / Load balancer as a service within a Kubernetes cluster",
 	Run: func(cmd *cobra.Command, args []string) {
 		// Set the logging level for all subsequent functions
-		log.SetLevel(log.Level(logLevel))
+		configureLogging()
 
 		// User Environment variables as an option to make manifest clearer
 		envInterface := os.Getenv("vip_interface")
@@ -105,11 +144,12 @@ var kubeVipService = &cobra.Command{
 
 		envLog := os.Getenv("vip_loglevel")
 		if envLog != "" {
-			logLevel, err := strconv.Atoi(envLog)
+			envLevel, err := strconv.Atoi(envLog)
 			if err != nil {
 				panic(fmt.Sprintf("Unable to parse environment variable [vip_loglevel], should be int"))
 			}
-			log.SetLevel(log.Level(logLevel))
+			logLevel = uint32(envLevel)
+			configureLogging()
 		}
 
 		envArp := os.Getenv("vip_arp")
@@ -121,6 +161,11 @@ var kubeVipService = &cobra.Command{
 			service.EnableArp = arpBool
 		}
 
+		err := kubevip.ParseEnvironmentLeaderElection(&service.LeaderElection)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+
 		// Define the new service manager
 		mgr, err := service.NewManager(configMap)
 		if err != nil {
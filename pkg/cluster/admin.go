@@ -0,0 +1,107 @@
+package cluster
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// StartAdmin - starts the admin HTTP API, it exposes the status of this node (/status), leadership transfer
+// (/leader/transfer), maintenance (/maintenance), the liveness and readiness probes (/healthz, /readyz) and the
+// metrics (/debug/vars). The API has no authentication so should only be bound to a local address.
+func (cluster *Cluster) StartAdmin(address string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", cluster.statusHandler)
+	mux.HandleFunc("/leader/transfer", cluster.transferHandler)
+	mux.HandleFunc("/maintenance", cluster.maintenanceHandler)
+	mux.HandleFunc("/healthz", healthHandler(cluster.Liveness))
+	mux.HandleFunc("/readyz", healthHandler(cluster.Readiness))
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("unable to start the admin API on [%s] -> error [%v]", address, err)
+	}
+	log.Infof("Starting the admin API on [%s]", address)
+
+	go func() {
+		err := http.Serve(listener, mux)
+		if err != nil {
+			log.Errorf("The admin API has stopped -> error [%v]", err)
+		}
+	}()
+	return nil
+}
+
+// statusHandler returns the status of this node as JSON
+func (cluster *Cluster) statusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(cluster.Status())
+	if err != nil {
+		log.Warnf("Unable to write the status -> error [%v]", err)
+	}
+}
+
+// transferHandler transfers leadership to the node in the "to" parameter, or any other node when it is empty
+func (cluster *Cluster) transferHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	err := cluster.TransferLeadership(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// maintenanceHandler places this node into maintenance (POST), clears maintenance (DELETE) or returns the current
+// state (GET)
+func (cluster *Cluster) maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		err = cluster.SetMaintenance(true)
+	case http.MethodDelete:
+		err = cluster.SetMaintenance(false)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]bool{"maintenance": cluster.InMaintenance()})
+	if err != nil {
+		log.Warnf("Unable to write the maintenance state -> error [%v]", err)
+	}
+}
+
+// healthHandler returns the result of the checks as JSON, with a 503 status if any have failed
+func healthHandler(check func() *Health) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		health := check()
+		w.Header().Set("Content-Type", "application/json")
+		if !health.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		err := json.NewEncoder(w).Encode(health)
+		if err != nil {
+			log.Warnf("Unable to write the health -> error [%v]", err)
+		}
+	}
+}
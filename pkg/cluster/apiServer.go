@@ -0,0 +1,160 @@
+package cluster
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// apiServerDialTimeout is how long to wait when checking an API server endpoint is reachable
+	apiServerDialTimeout = time.Second
+	// defaultAPIServerPort is used for any API server endpoint without a port
+	defaultAPIServerPort = "6443"
+)
+
+// selectAPIServer - returns the API server endpoint to use for leader election. Endpoints local to this host are
+// preferred (so the election doesn't depend on the VIP it manages), followed by the others in the order given.
+// The first endpoint that accepts a connection is returned, or the first endpoint if none of them do.
+func selectAPIServer(endpoints []string, vip string) string {
+	var local, remote []string
+	for _, endpoint := range endpoints {
+		if isLocalAPIServer(endpoint, vip) {
+			local = append(local, endpoint)
+		} else {
+			remote = append(remote, endpoint)
+		}
+	}
+	ordered := append(local, remote...)
+
+	for _, endpoint := range ordered {
+		conn, err := net.DialTimeout("tcp", apiServerAddress(endpoint), apiServerDialTimeout)
+		if err != nil {
+			electionLog.Debugf("API server [%s] is unreachable -> error [%v]", endpoint, err)
+			continue
+		}
+		conn.Close()
+		return endpoint
+	}
+
+	electionLog.Warnf("No API server endpoints are reachable, using [%s]", ordered[0])
+	return ordered[0]
+}
+
+// apiServerRotation - sends the requests of the leader election to the selected API server, selecting again when a
+// request to it fails (e.g. the lease can't be renewed as that API server has gone away)
+type apiServerRotation struct {
+	endpoints []string
+	vip       string
+
+	mux       sync.Mutex
+	current   string // the host:port of the selected API server
+	selecting bool
+}
+
+// newAPIServerRotation - selects an API server from the endpoints, returning the rotation and the endpoint selected
+func newAPIServerRotation(endpoints []string, vip string) (*apiServerRotation, string) {
+	endpoint := selectAPIServer(endpoints, vip)
+	return &apiServerRotation{
+		endpoints: endpoints,
+		vip:       vip,
+		current:   apiServerAddress(endpoint),
+	}, endpoint
+}
+
+// reselect will select an API server again in the background, unless a selection is already underway
+func (r *apiServerRotation) reselect(failed string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.selecting || r.current != failed {
+		return
+	}
+	r.selecting = true
+
+	go func() {
+		selected := apiServerAddress(selectAPIServer(r.endpoints, r.vip))
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		if selected != r.current {
+			electionLog.Warnf("API server [%s] has failed, using the API server [%s] for leader election", r.current, selected)
+		}
+		r.current, r.selecting = selected, false
+	}()
+}
+
+// wrap - returns the transport of the Kubernetes client, which sends each request to the selected API server
+func (r *apiServerRotation) wrap(rt http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		r.mux.Lock()
+		current := r.current
+		r.mux.Unlock()
+
+		// A request must not be modified by a transport, so a copy is sent
+		out := req.Clone(req.Context())
+		out.URL.Host, out.Host = current, ""
+		resp, err := rt.RoundTrip(out)
+		if err != nil && req.Context().Err() == nil && err != context.Canceled {
+			r.reselect(current)
+		}
+		return resp, err
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// apiServerAddress - returns the host:port of an API server endpoint given as a URL or host[:port]
+func apiServerAddress(endpoint string) string {
+	host := endpoint
+	if strings.Contains(endpoint, "://") {
+		if u, err := url.Parse(endpoint); err == nil {
+			host = u.Host
+		}
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), defaultAPIServerPort)
+	}
+	return host
+}
+
+// isLocalAPIServer - returns true if the endpoint resolves to a loopback address, or an address of this host
+// that isn't the VIP
+func isLocalAPIServer(endpoint, vip string) bool {
+	host, _, err := net.SplitHostPort(apiServerAddress(endpoint))
+	if err != nil {
+		return false
+	}
+	resolved, err := net.LookupHost(host)
+	if err != nil {
+		electionLog.Debugf("Unable to resolve API server [%s] -> error [%v]", endpoint, err)
+		return false
+	}
+	interfaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	vipIP := net.ParseIP(vip)
+
+	for _, r := range resolved {
+		ip := net.ParseIP(r)
+		if ip == nil || ip.Equal(vipIP) {
+			continue
+		}
+		if ip.IsLoopback() {
+			return true
+		}
+		for _, a := range interfaceAddrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package cluster
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+	"github.com/plunder-app/kube-vip/pkg/vip"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// defaultARPBurstInterval is the time between each packet of the takeover burst
+	defaultARPBurstInterval = 500 * time.Millisecond
+	// defaultARPRefreshInterval is the time between packets once the burst has been sent
+	defaultARPRefreshInterval = 3 * time.Second
+)
+
+// startARP will send a burst of gratuitous ARP packets for the VIP, followed by a refresh at a slower cadence
+// until the context is cancelled. It is expected to be started when this node takes over the VIP.
+func (cluster *Cluster) startARP(ctx context.Context, c *kubevip.Config) {
+	count := c.ARPBurstCount
+	if count < 1 {
+		count = 1
+	}
+	burstInterval := defaultARPBurstInterval
+	if c.ARPBurstInterval > 0 {
+		burstInterval = time.Duration(c.ARPBurstInterval) * time.Millisecond
+	}
+	// A refresh interval of zero uses the default, a negative interval disables the refresh
+	refreshInterval := defaultARPRefreshInterval
+	if c.ARPRefreshInterval > 0 {
+		refreshInterval = time.Duration(c.ARPRefreshInterval) * time.Second
+	}
+
+	go func() {
+		// An event is only recorded when ARP starts failing, rather than for every packet
+		var failing bool
+		send := func() {
+			err := sendGratuitousARP(c)
+			if err != nil && !failing {
+				cluster.events.event(corev1.EventTypeWarning, eventARPFailed, "Unable to send gratuitous ARP for the Virtual IP [%s] -> error [%v]", c.VIP, err)
+			}
+			failing = err != nil
+		}
+
+		for i := 0; i < count; i++ {
+			if i != 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(burstInterval):
+				}
+			}
+			send()
+		}
+
+		if c.ARPRefreshInterval < 0 {
+			return
+		}
+
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				send()
+			}
+		}
+	}()
+}
+
+// sendGratuitousARP will broadcast the MAC <-> VIP of this node on the VIP interface and any additional ARP
+// interfaces, using the type of packet(s) set by the ARP operation. The last error (if any) is returned.
+func sendGratuitousARP(c *kubevip.Config) error {
+	interfaces := append([]string{c.Interface}, c.ARPInterfaces...)
+
+	var lastErr error
+	for _, iface := range interfaces {
+		var err error
+		switch strings.ToLower(c.ARPOperation) {
+		case "request":
+			err = vip.ARPSendGratuitousRequest(c.VIP, iface)
+		case "both":
+			err = vip.ARPSendGratuitous(c.VIP, iface)
+			if err == nil {
+				err = vip.ARPSendGratuitousRequest(c.VIP, iface)
+			}
+		default:
+			err = vip.ARPSendGratuitous(c.VIP, iface)
+		}
+		if err != nil {
+			arpLog.Warnf("%v", err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
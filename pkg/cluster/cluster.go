@@ -1,7 +1,12 @@
 package cluster
 
 import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
 	"github.com/plunder-app/kube-vip/pkg/kubevip"
+	"github.com/plunder-app/kube-vip/pkg/loadbalancer"
 	"github.com/plunder-app/kube-vip/pkg/vip"
 )
 
@@ -13,6 +18,30 @@ type Cluster struct {
 	stop         chan bool
 	completed    chan bool
 	network      *vip.Network
+
+	// The state of the cluster reported by the admin API (see status.go)
+	mux      sync.Mutex
+	mode     string
+	id       string
+	leader   string
+	raft     *raft.Raft
+	vipLB    *loadbalancer.LBManager
+	nonVipLB *loadbalancer.LBManager
+
+	// Leadership transfer and maintenance of this node (see maintenance.go)
+	maintenance   bool
+	onTransfer    func(id string) error
+	onMaintenance func(enabled bool) error
+
+	// Kubernetes events, nil unless enabled (see events.go)
+	events *eventRecorder
+
+	// The liveness and readiness of this node (see health.go)
+	healthConfig        *kubevip.Config
+	healthLoadBalancers bool
+	contesting          bool
+	progressAt          time.Time
+	mismatchAt          time.Time
 }
 
 // InitCluster - Will attempt to initialise all of the required settings for the cluster
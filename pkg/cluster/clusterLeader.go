@@ -3,38 +3,43 @@ package cluster
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/plunder-app/kube-vip/pkg/kubevip"
 	"github.com/plunder-app/kube-vip/pkg/loadbalancer"
-	"github.com/plunder-app/kube-vip/pkg/vip"
 
 	"github.com/packethost/packngo"
 
-	log "github.com/sirupsen/logrus"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/leaderelection"
-	"k8s.io/client-go/tools/leaderelection/resourcelock"
 )
 
+// Default name and namespace of the leader election lock
 const plunderLock = "plunder-lock"
 const namespace = "kube-system"
 
+// electionRejoinDelay is how long this node waits before contesting the election again, once it has stepped down
+const electionRejoinDelay = 5 * time.Second
+
 // Manager degines the manager of the load-balancing services
 type Manager struct {
 	clientSet *kubernetes.Clientset
 }
 
-// NewManager will create a new managing object
-func NewManager(path string, inCluster bool) (*Manager, error) {
+// NewManager will create a new managing object, when running outside of the cluster the API server is selected
+// from the configured endpoints (defaulting to this host on port 6443), and is selected again whenever it fails.
+func NewManager(path string, inCluster bool, c *kubevip.Config) (*Manager, error) {
 	var clientset *kubernetes.Clientset
 	if inCluster {
 		// This will attempt to load the configuration when running within a POD
@@ -54,18 +59,26 @@ func NewManager(path string, inCluster bool) (*Manager, error) {
 		}
 		config, err := clientcmd.BuildConfigFromFlags("", path)
 		if err != nil {
-			panic(err.Error())
+			return nil, fmt.Errorf("error reading kubernetes configuration [%s]: %s", path, err.Error())
 		}
 
 		// We modify the config so that we can always speak to the correct host
-		id, err := os.Hostname()
-		if err != nil {
-			return nil, err
+		endpoints := c.APIServers
+		if len(endpoints) == 0 {
+			id, err := os.Hostname()
+			if err != nil {
+				return nil, err
+			}
+			endpoints = []string{net.JoinHostPort(id, defaultAPIServerPort)}
 		}
-
-		// TODO - we need to make the host/port configurable
-
-		config.Host = fmt.Sprintf("%s:6443", id)
+		// The server from the kubeconfig is the last resort, as it is commonly the VIP itself
+		endpoints = append(endpoints, config.Host)
+
+		// Requests are sent to the selected API server, which is selected again if it fails
+		rotation, endpoint := newAPIServerRotation(endpoints, c.VIP)
+		config.Host = endpoint
+		config.Wrap(rotation.wrap)
+		electionLog.Infof("Using the API server [%s] for leader election", config.Host)
 		clientset, err = kubernetes.NewForConfig(config)
 
 		if err != nil {
@@ -85,31 +98,30 @@ func (cluster *Cluster) StartLeaderCluster(c *kubevip.Config, sm *Manager) error
 	if err != nil {
 		return err
 	}
-	log.Infof("Beginning cluster membership, namespace [%s], lock name [%s], id [%s]", namespace, plunderLock, id)
+	// Any unset values of the lock use the leader election cluster defaults
+	le := &c.LeaderElection
+	le.SetDefaults(plunderLock, namespace, 3, 2, 1)
+	err = le.Validate()
+	if err != nil {
+		return err
+	}
+	electionLog.Infof("Beginning cluster membership, namespace [%s], lock name [%s], lock type [%s], id [%s]", le.LeaseNamespace, le.LeaseName, le.LeaseLockType, id)
 
-	// we use the Lease lock type since edits to Leases are less common
+	// we use the Lease lock type by default since edits to Leases are less common
 	// and fewer objects in the cluster watch "all Leases".
-	lock := &resourcelock.LeaseLock{
-		LeaseMeta: metav1.ObjectMeta{
-			Name:      plunderLock,
-			Namespace: namespace,
-		},
-		Client: sm.clientSet.CoordinationV1(),
-		LockConfig: resourcelock.ResourceLockConfig{
-			Identity: id,
-		},
+	lock, err := NewLock(sm.clientSet, le, id)
+	if err != nil {
+		return err
 	}
 
-	// use a Go context so we can tell the leaderelection code when we
-	// want to step down
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
 	// use a Go context so we can tell the arp loop code when we
 	// want to step down
 	ctxArp, cancelArp := context.WithCancel(context.Background())
 	defer cancelArp()
 
+	// leading serializes acquiring the VIP (OnStartedLeading) with releasing it (OnStoppedLeading)
+	var leading sync.Mutex
+
 	// listen for interrupts or the Linux SIGTERM signal and cancel
 	// our context, which the leader election code will observe and
 	// step down
@@ -123,14 +135,41 @@ func (cluster *Cluster) StartLeaderCluster(c *kubevip.Config, sm *Manager) error
 	// Add Notification for SIGKILL (sent from Kubernetes)
 	signal.Notify(signalChan, syscall.SIGKILL)
 
+	// the shutdown channel is closed once a signal is received, stopping any further elections
+	shutdown := make(chan struct{})
+
 	go func() {
 		<-signalChan
-		log.Info("Received termination, signaling shutdown")
-		// Cancel the context, which will in turn cancel the leadership
-		cancel()
-		// Cancel the arp context, which will in turn stop any broadcasts
+		electionLog.Info("Received termination, signaling shutdown")
+		// Close the shutdown channel, which will in turn cancel the leadership
+		close(shutdown)
 	}()
 
+	// Record events on the VIP, the backends of the load balancers and ARP
+	if c.EnableEvents {
+		events := newEventRecorder(sm.clientSet, id)
+		cluster.events = events
+
+		kubevip.SetBackendStateChanged(func(lb *kubevip.LoadBalancer, b *kubevip.BackEnd, alive bool) {
+			if alive {
+				events.event(corev1.EventTypeNormal, eventBackendUp, "Backend [%s] of load balancer [%s] is up", net.JoinHostPort(b.Address, strconv.Itoa(b.Port)), lb.Name)
+			} else {
+				events.event(corev1.EventTypeWarning, eventBackendDown, "Backend [%s] of load balancer [%s] is down", net.JoinHostPort(b.Address, strconv.Itoa(b.Port)), lb.Name)
+			}
+		})
+		// The backends stop recording events before the recorder is stopped
+		defer func() {
+			kubevip.SetBackendStateChanged(nil)
+			events.stop()
+		}()
+	}
+
+	// Begin checking the local health gates, this node will only contest leadership whilst they pass
+	gates := newHealthGates(c.HealthGates)
+	ctxGates, cancelGates := context.WithCancel(context.Background())
+	defer cancelGates()
+	gates.start(ctxGates)
+
 	// (attempt to) Remove the virtual IP, incase it already exists
 	cluster.network.DeleteIP()
 
@@ -147,157 +186,283 @@ func (cluster *Cluster) StartLeaderCluster(c *kubevip.Config, sm *Manager) error
 				if c.LoadBalancers[x].BindToVip == false {
 					err = nonVipLB.Add("", &c.LoadBalancers[x])
 					if err != nil {
-						log.Warnf("Error creating loadbalancer [%s] type [%s] -> error [%s]", c.LoadBalancers[x].Name, c.LoadBalancers[x].Type, err)
+						electionLog.Warnf("Error creating loadbalancer [%s] type [%s] -> error [%s]", c.LoadBalancers[x].Name, c.LoadBalancers[x].Type, err)
 					}
 				}
 			}
 		}
 	}
-	// start the leader election code loop
-	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
-		Lock: lock,
-		// IMPORTANT: you MUST ensure that any code you have that
-		// is protected by the lease must terminate **before**
-		// you call cancel. Otherwise, you could have a background
-		// loop still running and another process could
-		// get elected before your background loop finished, violating
-		// the stated goal of the lease.
-		ReleaseOnCancel: true,
-		LeaseDuration:   3 * time.Second,
-		RenewDeadline:   2 * time.Second,
-		RetryPeriod:     1 * time.Second,
-		Callbacks: leaderelection.LeaderCallbacks{
-			OnStartedLeading: func(ctx context.Context) {
-
-				// we're notified when we start
-				log.Info("This node is starting with leadership of the cluster")
-				err = cluster.network.AddIP()
-				if err != nil {
-					log.Warnf("%v", err)
-				}
+	// Record the load balancers for the admin API
+	cluster.setStatus(ModeLeaderElection, id, nil, &VipLB, &nonVipLB)
+	cluster.startHealth(c, c.EnableLoadBalancer)
+
+	// A request to transfer leadership releases the lease, this node then waits before re-joining the election
+	// so another node can take it
+	transfer := make(chan struct{}, 1)
+	cluster.setControls(func(to string) error {
+		if to != "" {
+			return fmt.Errorf("leadership can't be transferred to a particular node in [%s] mode", ModeLeaderElection)
+		}
+		cluster.mux.Lock()
+		leader := cluster.leader
+		cluster.mux.Unlock()
+		if leader != id {
+			return fmt.Errorf("this node isn't the leader, the leader is [%s]", leader)
+		}
+		select {
+		case transfer <- struct{}{}:
+		default:
+		}
+		return nil
+	}, func(enabled bool) error {
+		if c.EnableLoadBalancer {
+			drainLoadBalancers(c, &nonVipLB, enabled)
+		}
+		return nil
+	})
+
+	// The election is run in a loop, so that this node can release the lease when it is unable to hold
+	// the VIP and re-join the election later on
+	for {
+		// Wait for the local health gates to pass before contesting the election
+		cluster.setContesting(false)
+		if !gates.wait(shutdown) {
+			break
+		}
+		// Wait for this node to leave maintenance before contesting the election
+		if !cluster.waitMaintenance(shutdown) {
+			break
+		}
+		cluster.setContesting(true)
+
+		// use a Go context so we can tell the leaderelection code when we
+		// want to step down
+		ctx, cancel := context.WithCancel(context.Background())
+
+		go func() {
+			select {
+			case <-shutdown:
+				cancel()
+			case <-transfer:
+				electionLog.Infof("Releasing leadership to another node in the cluster")
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		// Release the lease if this node is placed into maintenance
+		cluster.watchMaintenance(ctx, cancel)
+
+		// Take (or give up) leadership based upon the priority of this node
+		cluster.preemptLease(ctx, c, sm, id, cancel)
+
+		// start the leader election code loop
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			// Every read or write of the lock is progress of the election, reported by /healthz
+			Lock: &progressLock{Interface: lock, cluster: cluster},
+			// IMPORTANT: you MUST ensure that any code you have that
+			// is protected by the lease must terminate **before**
+			// you call cancel. Otherwise, you could have a background
+			// loop still running and another process could
+			// get elected before your background loop finished, violating
+			// the stated goal of the lease.
+			ReleaseOnCancel: true,
+			LeaseDuration:   time.Duration(le.LeaseDuration) * time.Second,
+			RenewDeadline:   time.Duration(le.RenewDeadline) * time.Second,
+			RetryPeriod:     time.Duration(le.RetryPeriod) * time.Second,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					// The VIP is acquired and released under the leading lock, so that a release waits for an acquire
+					// to finish (or be rolled back) rather than running alongside it
+					leading.Lock()
+					defer leading.Unlock()
+
+					// Leadership may have been lost before the acquire started
+					if ctx.Err() != nil {
+						return
+					}
+
+					// we're notified when we start
+					electionLog.Info("This node is starting with leadership of the cluster")
+					if !gates.Healthy() {
+						electionLog.Errorf("Local health gates are failing, releasing leadership")
+						cancel()
+						return
+					}
+					gates.watch(ctx, cancel)
+					cluster.announcePriority(ctx, c, sm)
 
-				if c.EnablePacket {
-					packetClient, err := packngo.NewClient()
+					err := cluster.runHooks(c, kubevip.HookBeforeAcquire)
 					if err != nil {
-						log.Error(err)
+						electionLog.Errorf("%v, releasing leadership", err)
+						cancel()
+						return
 					}
-					projects, _, err := packetClient.Projects.List(nil)
+					if ctx.Err() != nil {
+						electionLog.Warnf("Leadership was lost whilst running the hooks, the Virtual IP will not be added")
+						return
+					}
+
+					err = cluster.claimVIP(ctx, c)
 					if err != nil {
-						log.Error(err)
+						electionLog.Errorf("%v, releasing leadership", err)
+						cancel()
+						return
 					}
-					for _, p := range projects {
-						log.Println(p.ID, p.Name)
 
-						// Find our project
-						if p.Name == c.PacketProject {
-							ips, _, _ := packetClient.ProjectIPs.List(p.ID)
-							for _, ip := range ips {
+					// abandon rolls back the acquire when leadership is lost part way through, the VIP and the load
+					// balancers bound to it are removed before the release runs
+					abandon := func() bool {
+						if ctx.Err() == nil {
+							return false
+						}
+						electionLog.Warnf("Leadership was lost whilst acquiring the Virtual IP, removing it")
+						if err := VipLB.StopAll(); err != nil {
+							electionLog.Warnf("%v", err)
+						}
+						if err := cluster.network.DeleteIP(); err != nil {
+							electionLog.Warnf("%v", err)
+						}
+						sm.recordTransition(c, id, "released")
+						return true
+					}
 
-								// Find the device id for our EIP
-								if ip.Address == c.VIP {
-									log.Infof("Found EIP ->%s ID -> %s\n", ip.Address, ip.ID)
+					cluster.monitorConflicts(ctx, c, cancel)
+					sm.recordTransition(c, id, "acquired")
 
-									if len(ip.Assignments) != 0 {
-										hrefID := strings.Replace(ip.Assignments[0].Href, "/ips/", "", -1)
-										packetClient.DeviceIPs.Unassign(hrefID)
+					if c.EnablePacket {
+						packetClient, err := packngo.NewClient()
+						if err != nil {
+							electionLog.Error(err)
+						}
+						projects, _, err := packetClient.Projects.List(nil)
+						if err != nil {
+							electionLog.Error(err)
+						}
+						for _, p := range projects {
+							electionLog.Println(p.ID, p.Name)
+
+							// Find our project
+							if p.Name == c.PacketProject {
+								ips, _, _ := packetClient.ProjectIPs.List(p.ID)
+								for _, ip := range ips {
+
+									// Find the device id for our EIP
+									if ip.Address == c.VIP {
+										electionLog.Infof("Found EIP ->%s ID -> %s\n", ip.Address, ip.ID)
+
+										if len(ip.Assignments) != 0 {
+											hrefID := strings.Replace(ip.Assignments[0].Href, "/ips/", "", -1)
+											packetClient.DeviceIPs.Unassign(hrefID)
+										}
 									}
 								}
-							}
 
-							// Go through devices
-							dev, _, _ := packetClient.Devices.List(p.ID, &packngo.ListOptions{})
-							for _, d := range dev {
+								// Go through devices
+								dev, _, _ := packetClient.Devices.List(p.ID, &packngo.ListOptions{})
+								for _, d := range dev {
 
-								if d.Hostname == id {
-									log.Infof("Assigning EIP to -> %s\n", d.Hostname)
-									_, _, err := packetClient.DeviceIPs.Assign(d.ID, &packngo.AddressStruct{
-										Address: c.VIP,
-									})
-									if err != nil {
-										log.Errorln(err)
-									}
+									if d.Hostname == id {
+										electionLog.Infof("Assigning EIP to -> %s\n", d.Hostname)
+										_, _, err := packetClient.DeviceIPs.Assign(d.ID, &packngo.AddressStruct{
+											Address: c.VIP,
+										})
+										if err != nil {
+											electionLog.Errorln(err)
+										}
 
+									}
 								}
 							}
 						}
 					}
-				}
-
-				if c.EnableLoadBalancer {
-					// Once we have the VIP running, start the load balancer(s) that bind to the VIP
-					for x := range c.LoadBalancers {
+					if abandon() {
+						return
+					}
 
-						if c.LoadBalancers[x].BindToVip == true {
-							err = VipLB.Add(c.VIP, &c.LoadBalancers[x])
-							if err != nil {
-								log.Warnf("Error creating loadbalancer [%s] type [%s] -> error [%s]", c.LoadBalancers[x].Name, c.LoadBalancers[x].Type, err)
+					if c.EnableLoadBalancer {
+						// Once we have the VIP running, start the load balancer(s) that bind to the VIP
+						for x := range c.LoadBalancers {
 
-								// Stop all load balancers associated with the VIP
-								err = VipLB.StopAll()
+							if c.LoadBalancers[x].BindToVip == true {
+								err = VipLB.Add(c.VIP, &c.LoadBalancers[x])
 								if err != nil {
-									log.Warnf("%v", err)
-								}
+									electionLog.Warnf("Error creating loadbalancer [%s] type [%s] -> error [%s]", c.LoadBalancers[x].Name, c.LoadBalancers[x].Type, err)
 
-								err = cluster.network.DeleteIP()
-								if err != nil {
-									log.Warnf("%v", err)
-								}
-							}
-						}
-					}
-				}
+									// Stop all load balancers associated with the VIP
+									err = VipLB.StopAll()
+									if err != nil {
+										electionLog.Warnf("%v", err)
+									}
 
-				if c.GratuitousARP == true {
-					ctxArp, cancelArp = context.WithCancel(context.Background())
-
-					go func(ctx context.Context) {
-						for {
-							select {
-							case <-ctx.Done(): // if cancel() execute
-								return
-							default:
-								// Gratuitous ARP, will broadcast to new MAC <-> IP
-								err = vip.ARPSendGratuitous(c.VIP, c.Interface)
-								if err != nil {
-									log.Warnf("%v", err)
+									err = cluster.network.DeleteIP()
+									if err != nil {
+										electionLog.Warnf("%v", err)
+									}
 								}
 							}
-							time.Sleep(3 * time.Second)
 						}
-					}(ctxArp)
-				}
-			},
-			OnStoppedLeading: func() {
-				// we can do cleanup here
-				log.Info("This node is becoming a follower within the cluster")
-
-				// Stop the Arp context if it is running
-				cancelArp()
+					}
+					if abandon() {
+						return
+					}
 
-				// Stop all load balancers associated with the VIP
-				err = VipLB.StopAll()
-				if err != nil {
-					log.Warnf("%v", err)
-				}
+					if c.GratuitousARP == true {
+						// Gratuitous ARP, will broadcast to new MAC <-> IP, until leadership is lost or released
+						ctxArp, cancelArp = context.WithCancel(ctx)
+						cluster.startARP(ctxArp, c)
+					}
 
-				err = cluster.network.DeleteIP()
-				if err != nil {
-					log.Warnf("%v", err)
-				}
+					err = cluster.runHooks(c, kubevip.HookAfterAcquire)
+					if err != nil {
+						electionLog.Errorf("%v, releasing leadership", err)
+						cancel()
+					}
+				},
+				OnStoppedLeading: func() {
+					// Wait for any acquire to finish (or be rolled back) before releasing
+					leading.Lock()
+					defer leading.Unlock()
+
+					// we can do cleanup here
+					electionLog.Info("This node is becoming a follower within the cluster")
+
+					// The release hooks are only run if this node was holding the VIP
+					holding, _ := cluster.network.IsSet()
+					cluster.releaseVIP(c, &VipLB, holding, func() {
+						// Stop the Arp context if it is running
+						cancelArp()
+					})
+					if holding {
+						sm.recordTransition(c, id, "released")
+					}
+				},
+				OnNewLeader: func(identity string) {
+					// we're notified when new leader elected
+					electionLog.Infof("Node [%s] is assuming leadership of the cluster", identity)
+					cluster.setLeader(identity)
+
+					if identity == id {
+						// We have the lock
+					}
+				},
 			},
-			OnNewLeader: func(identity string) {
-				// we're notified when new leader elected
-				log.Infof("Node [%s] is assuming leadership of the cluster", identity)
+		})
 
-				if identity == id {
-					// We have the lock
-				}
-			},
-		},
-	})
+		cancel()
+
+		// Stop if we're shutting down, otherwise wait before re-joining the election
+		select {
+		case <-shutdown:
+		case <-time.After(electionRejoinDelay):
+			electionLog.Infof("Re-joining the election after stepping down")
+			continue
+		}
+		break
+	}
 
 	//<-signalChan
-	log.Infof("Shutting down Kube-Vip Leader Election cluster")
+	electionLog.Infof("Shutting down Kube-Vip Leader Election cluster")
 	// Force a removal of the VIP (ignore the error if we don't have it)
 	cluster.network.DeleteIP()
 
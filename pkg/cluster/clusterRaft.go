@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"time"
@@ -8,21 +9,22 @@ import (
 	"github.com/hashicorp/raft"
 	"github.com/plunder-app/kube-vip/pkg/kubevip"
 	"github.com/plunder-app/kube-vip/pkg/loadbalancer"
-	"github.com/plunder-app/kube-vip/pkg/vip"
-	log "github.com/sirupsen/logrus"
+	"github.com/plunder-app/kube-vip/pkg/logging"
+	"github.com/sirupsen/logrus"
 )
 
 // StartRaftCluster - Begins a running instance of the Raft cluster
 func (cluster *Cluster) StartRaftCluster(c *kubevip.Config) error {
 
 	// Create local configuration address
-	localAddress := fmt.Sprintf("%s:%d", c.LocalPeer.Address, c.LocalPeer.Port)
+	localAddress := c.LocalPeer.HostPort()
 
 	// Begin the Raft configuration
 	config := raft.DefaultConfig()
 	config.LocalID = raft.ServerID(c.LocalPeer.ID)
-	logger := log.StandardLogger().Writer()
-	config.LogOutput = logger
+	// Raft logs through hclog, which is adapted to the raft subsystem logger
+	logger := logging.NewHCLogger(raftLog)
+	config.Logger = logger
 
 	// Initialize communication
 	address, err := net.ResolveTCPAddr("tcp", localAddress)
@@ -30,10 +32,20 @@ func (cluster *Cluster) StartRaftCluster(c *kubevip.Config) error {
 		return err
 	}
 
-	// Create transport
-	transport, err := raft.NewTCPTransport(localAddress, address, 3, 10*time.Second, logger)
-	if err != nil {
-		return err
+	// Create transport, either with mutual TLS or plain TCP
+	var transport raft.Transport
+	if c.EnableRaftTLS {
+		stream, err := newTLSStreamLayer(localAddress, address, c)
+		if err != nil {
+			return err
+		}
+		raftLog.Info("The Raft transport is using mutual TLS")
+		transport = raft.NewNetworkTransportWithLogger(stream, 3, 10*time.Second, logger)
+	} else {
+		transport, err = raft.NewTCPTransportWithLogger(localAddress, address, 3, 10*time.Second, logger)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Create Raft structures
@@ -47,7 +59,7 @@ func (cluster *Cluster) StartRaftCluster(c *kubevip.Config) error {
 	// Add Local Peer
 	configuration.Servers = append(configuration.Servers, raft.Server{
 		ID:      raft.ServerID(c.LocalPeer.ID),
-		Address: raft.ServerAddress(fmt.Sprintf("%s:%d", c.LocalPeer.Address, c.LocalPeer.Port))})
+		Address: raft.ServerAddress(localAddress)})
 
 	// Automatically detects if startAsLeader is true/false, default true
 	c.StartAsLeader = true
@@ -55,10 +67,10 @@ func (cluster *Cluster) StartRaftCluster(c *kubevip.Config) error {
 		if c.LocalPeer.Address == c.RemotePeers[x].Address {
 			continue
 		}
-		peerAddress := fmt.Sprintf("%s:%d", c.RemotePeers[x].Address, c.RemotePeers[x].Port)
+		peerAddress := c.RemotePeers[x].HostPort()
 		conn, err := net.DialTimeout("tcp", peerAddress, time.Second * 1)
 		if err != nil {
-			log.Debugf("unreachable, error: %v", err)
+			raftLog.Debugf("unreachable, error: %v", err)
 		} else {
 			c.StartAsLeader = false
 			conn.Close()
@@ -74,7 +86,7 @@ func (cluster *Cluster) StartRaftCluster(c *kubevip.Config) error {
 			if c.LocalPeer.Address != c.RemotePeers[x].Address {
 
 				// Build the address from the peer configuration
-				peerAddress := fmt.Sprintf("%s:%d", c.RemotePeers[x].Address, c.RemotePeers[x].Port)
+				peerAddress := c.RemotePeers[x].HostPort()
 
 				// Set this peer into the raft configuration
 				configuration.Servers = append(configuration.Servers, raft.Server{
@@ -82,9 +94,9 @@ func (cluster *Cluster) StartRaftCluster(c *kubevip.Config) error {
 					Address: raft.ServerAddress(peerAddress)})
 			}
 		}
-		log.Info("This node will attempt to start as Follower")
+		raftLog.Info("This node will attempt to start as Follower")
 	} else {
-		log.Info("This node will attempt to start as Leader")
+		raftLog.Info("This node will attempt to start as Leader")
 	}
 
 	// Bootstrap cluster
@@ -106,6 +118,22 @@ func (cluster *Cluster) StartRaftCluster(c *kubevip.Config) error {
 	// (attempt to) Remove the virtual IP, incase it already exists
 	cluster.network.DeleteIP()
 
+	// Begin checking the local health gates, this node will give up leadership if they fail
+	gates := newHealthGates(c.HealthGates)
+	ctxGates, cancelGates := context.WithCancel(context.Background())
+	gates.start(ctxGates)
+
+	// use a Go context so we can stop monitoring for address conflicts (and the
+	// health gates) when we step down
+	ctxMonitor, cancelMonitor := context.WithCancel(context.Background())
+
+	// use a Go context so we can tell the arp loop code when we
+	// want to step down
+	ctxArp, cancelArp := context.WithCancel(context.Background())
+
+	// peers with a higher priority than this node, and when they became reachable
+	preempting := newRaftPreemption()
+
 	// leader log broadcast - this counter is used to stop flooding STDOUT with leader log entries
 	var leaderbroadcast int
 	// Managers for Vip load balancers and none-vip loadbalancers
@@ -118,17 +146,36 @@ func (cluster *Cluster) StartRaftCluster(c *kubevip.Config) error {
 		if c.LoadBalancers[x].BindToVip == false {
 			err = nonVipLB.Add("", &c.LoadBalancers[x])
 			if err != nil {
-				log.Warnf("Error creating loadbalancer [%s] type [%s] -> error [%s]", c.LoadBalancers[x].Name, c.LoadBalancers[x].Type, err)
+				raftLog.Warnf("Error creating loadbalancer [%s] type [%s] -> error [%s]", c.LoadBalancers[x].Name, c.LoadBalancers[x].Type, err)
 			}
 		}
 	}
 
+	// Record the Raft server and load balancers for the admin API
+	cluster.setStatus(ModeRaft, c.LocalPeer.ID, raftServer, &VipLB, &nonVipLB)
+	cluster.startHealth(c, true)
+	cluster.setControls(func(id string) error {
+		return transferRaft(raftServer, id)
+	}, func(enabled bool) error {
+		drainLoadBalancers(c, &nonVipLB, enabled)
+		if enabled && raftServer.State() == raft.Leader {
+			err := raftServer.LeadershipTransfer().Error()
+			if err != nil {
+				return fmt.Errorf("unable to transfer leadership to another node -> error [%v]", err)
+			}
+		}
+		return nil
+	})
+
 	// On a cold start the node will sleep for 5 seconds to ensure that leader elections are complete
-	log.Infoln("This instance will wait approximately 5 seconds, from cold start to ensure cluster elections are complete")
+	raftLog.Infoln("This instance will wait approximately 5 seconds, from cold start to ensure cluster elections are complete")
 	time.Sleep(time.Second * 5)
 
 	go func() {
 		for {
+			// Every iteration is progress of the election, reported by /healthz
+			cluster.progress()
+
 			if c.AddPeersAsBackends == true {
 				// Get addresses and change backends
 
@@ -140,22 +187,14 @@ func (cluster *Cluster) StartRaftCluster(c *kubevip.Config) error {
 			}
 			// Broadcast the current leader on this node if it's the correct time (every leaderLogcount * time.Second)
 			if leaderbroadcast == leaderLogcount {
-				log.Infof("The Node [%s] is leading", raftServer.Leader())
+				raftLog.Infof("The Node [%s] is leading", raftServer.Leader())
 				// Reset the timer
 				leaderbroadcast = 0
 
 				// ensure that if this node is the leader, it is set as the leader
 				if localAddress == string(raftServer.Leader()) {
-					// Re-broadcast arp to ensure network stays up to date
-					if c.GratuitousARP == true {
-						// Gratuitous ARP, will broadcast to new MAC <-> IP
-						err = vip.ARPSendGratuitous(c.VIP, c.Interface)
-						if err != nil {
-							log.Warnf("%v", err)
-						}
-					}
 					if !isLeader {
-						log.Infoln("This node is leading, but isnt the leader (correcting)")
+						raftLog.Infoln("This node is leading, but isnt the leader (correcting)")
 						isLeader = true
 					}
 				} else {
@@ -169,16 +208,50 @@ func (cluster *Cluster) StartRaftCluster(c *kubevip.Config) error {
 
 			select {
 			case leader := <-raftServer.LeaderCh():
-				log.Infoln("New Election event")
+				raftLog.Infoln("New Election event")
 				if leader {
 					isLeader = true
 
-					log.Info("This node is assuming leadership of the cluster")
-					err = cluster.network.AddIP()
+					raftLog.Info("This node is assuming leadership of the cluster")
+					if !gates.Healthy() {
+						raftLog.Errorf("Local health gates are failing, dropping leadership to another node in the cluster")
+						raftServer.LeadershipTransfer()
+						continue
+					}
+					if cluster.InMaintenance() {
+						raftLog.Warnf("This node is in maintenance, dropping leadership to another node in the cluster")
+						raftServer.LeadershipTransfer()
+						continue
+					}
+
+					err = cluster.runHooks(c, kubevip.HookBeforeAcquire)
 					if err != nil {
-						log.Warnf("%v", err)
+						raftLog.Errorf("%v, dropping leadership to another node in the cluster", err)
+						raftServer.LeadershipTransfer()
+						continue
 					}
 
+					ctxClaim, cancelClaim := cluster.leadershipContext(raftServer)
+					err = cluster.claimVIP(ctxClaim, c)
+					cancelClaim()
+					if err != nil {
+						raftLog.Errorf("%v, dropping leadership to another node in the cluster", err)
+						raftServer.LeadershipTransfer()
+						continue
+					}
+
+					// Monitor for any other host claiming the VIP whilst this node holds it
+					cancelMonitor()
+					ctxMonitor, cancelMonitor = context.WithCancel(context.Background())
+					cluster.monitorConflicts(ctxMonitor, c, func() {
+						raftServer.LeadershipTransfer()
+					})
+
+					// Give up leadership if the local health gates fail whilst this node holds the VIP
+					gates.watch(ctxMonitor, func() {
+						raftServer.LeadershipTransfer()
+					})
+
 					// Once we have the VIP running, start the load balancer(s) that bind to the VIP
 
 					for x := range c.LoadBalancers {
@@ -186,19 +259,19 @@ func (cluster *Cluster) StartRaftCluster(c *kubevip.Config) error {
 						if c.LoadBalancers[x].BindToVip == true {
 							err = VipLB.Add(c.VIP, &c.LoadBalancers[x])
 							if err != nil {
-								log.Warnf("Error creating loadbalancer [%s] type [%s] -> error [%s]", c.LoadBalancers[x].Name, c.LoadBalancers[x].Type, err)
-								log.Errorf("Dropping Leadership to another node in the cluster")
+								raftLog.Warnf("Error creating loadbalancer [%s] type [%s] -> error [%s]", c.LoadBalancers[x].Name, c.LoadBalancers[x].Type, err)
+								raftLog.Errorf("Dropping Leadership to another node in the cluster")
 								raftServer.LeadershipTransfer()
 
 								// Stop all load balancers associated with the VIP
 								err = VipLB.StopAll()
 								if err != nil {
-									log.Warnf("%v", err)
+									raftLog.Warnf("%v", err)
 								}
 
 								err = cluster.network.DeleteIP()
 								if err != nil {
-									log.Warnf("%v", err)
+									raftLog.Warnf("%v", err)
 								}
 							}
 						}
@@ -206,43 +279,64 @@ func (cluster *Cluster) StartRaftCluster(c *kubevip.Config) error {
 
 					if c.GratuitousARP == true {
 						// Gratuitous ARP, will broadcast to new MAC <-> IP
-						err = vip.ARPSendGratuitous(c.VIP, c.Interface)
-						if err != nil {
-							log.Warnf("%v", err)
-						}
+						cancelArp()
+						ctxArp, cancelArp = context.WithCancel(context.Background())
+						cluster.startARP(ctxArp, c)
 					}
-				} else {
-					isLeader = false
 
-					log.Info("This node is becoming a follower within the cluster")
-
-					// Stop all load balancers associated with the VIP
-					err = VipLB.StopAll()
+					err = cluster.runHooks(c, kubevip.HookAfterAcquire)
 					if err != nil {
-						log.Warnf("%v", err)
+						raftLog.Errorf("%v, dropping leadership to another node in the cluster", err)
+						raftServer.LeadershipTransfer()
 					}
+				} else {
+					isLeader = false
 
-					err = cluster.network.DeleteIP()
-					if err != nil {
-						log.Warnf("%v", err)
-					}
+					raftLog.Info("This node is becoming a follower within the cluster")
+
+					// The release hooks are only run if this node was holding the VIP
+					holding, _ := cluster.network.IsSet()
+					cluster.releaseVIP(c, &VipLB, holding, func() {
+						// Stop monitoring for address conflicts and any ARP broadcasts
+						cancelMonitor()
+						cancelArp()
+					})
 				}
 
 			case <-ticker.C:
 
 				if isLeader {
+					// Hand over leadership to any higher priority peer
+					cluster.preemptRaft(raftServer, c, preempting)
 
 					result, err := cluster.network.IsSet()
 					if err != nil {
-						log.WithFields(log.Fields{"error": err, "ip": cluster.network.IP(), "interface": cluster.network.Interface()}).Error("Could not check ip")
+						raftLog.WithFields(logrus.Fields{"error": err, "ip": cluster.network.IP(), "interface": cluster.network.Interface()}).Error("Could not check ip")
+					}
+
+					if result == false && (cluster.InMaintenance() || !gates.Healthy()) {
+						// This node can't hold the VIP, so hand leadership to another node
+						raftServer.LeadershipTransfer()
+						continue
 					}
 
 					if result == false {
-						log.Error("This node is leader and is adopting the virtual IP")
+						raftLog.Error("This node is leader and is adopting the virtual IP")
+
+						err = cluster.runHooks(c, kubevip.HookBeforeAcquire)
+						if err != nil {
+							raftLog.Errorf("%v, dropping leadership to another node in the cluster", err)
+							raftServer.LeadershipTransfer()
+							continue
+						}
 
-						err = cluster.network.AddIP()
+						ctxClaim, cancelClaim := cluster.leadershipContext(raftServer)
+						err = cluster.claimVIP(ctxClaim, c)
+						cancelClaim()
 						if err != nil {
-							log.Warnf("%v", err)
+							raftLog.Errorf("%v, dropping leadership to another node in the cluster", err)
+							raftServer.LeadershipTransfer()
+							continue
 						}
 						// Once we have the VIP running, start the load balancer(s) that bind to the VIP
 
@@ -251,41 +345,49 @@ func (cluster *Cluster) StartRaftCluster(c *kubevip.Config) error {
 							if c.LoadBalancers[x].BindToVip == true {
 								err = VipLB.Add(c.VIP, &c.LoadBalancers[x])
 								if err != nil {
-									log.Warnf("Error creating loadbalancer [%s] type [%s] -> error [%s]", c.LoadBalancers[x].Name, c.LoadBalancers[x].Type, err)
+									raftLog.Warnf("Error creating loadbalancer [%s] type [%s] -> error [%s]", c.LoadBalancers[x].Name, c.LoadBalancers[x].Type, err)
 								}
 							}
 						}
 						if c.GratuitousARP == true {
 							// Gratuitous ARP, will broadcast to new MAC <-> IP
-							err = vip.ARPSendGratuitous(c.VIP, c.Interface)
-							if err != nil {
-								log.Warnf("%v", err)
-							}
+							cancelArp()
+							ctxArp, cancelArp = context.WithCancel(context.Background())
+							cluster.startARP(ctxArp, c)
+						}
+
+						err = cluster.runHooks(c, kubevip.HookAfterAcquire)
+						if err != nil {
+							raftLog.Errorf("%v, dropping leadership to another node in the cluster", err)
+							raftServer.LeadershipTransfer()
 						}
 					}
 				}
 
 			case <-cluster.stop:
-				log.Info("[RAFT] Stopping this node")
-				log.Info("[LOADBALANCER] Stopping load balancers")
+				raftLog.Info("[RAFT] Stopping this node")
+				raftLog.Info("[LOADBALANCER] Stopping load balancers")
 
-				// Stop all load balancers associated with the VIP
-				err = VipLB.StopAll()
-				if err != nil {
-					log.Warnf("%v", err)
-				}
+				// Stop monitoring for address conflicts and any ARP broadcasts
+				cancelMonitor()
+				cancelArp()
+				cancelGates()
 
 				// Stop all load balancers associated with the Host
 				err = nonVipLB.StopAll()
 				if err != nil {
-					log.Warnf("%v", err)
+					raftLog.Warnf("%v", err)
 				}
 
 				if isLeader {
-					log.Info("[VIP] Releasing the Virtual IP")
-					err = cluster.network.DeleteIP()
+					raftLog.Info("[VIP] Releasing the Virtual IP")
+					holding, _ := cluster.network.IsSet()
+					cluster.releaseVIP(c, &VipLB, holding, nil)
+				} else {
+					// Stop all load balancers associated with the VIP
+					err = VipLB.StopAll()
 					if err != nil {
-						log.Warnf("%v", err)
+						raftLog.Warnf("%v", err)
 					}
 				}
 
@@ -296,7 +398,7 @@ func (cluster *Cluster) StartRaftCluster(c *kubevip.Config) error {
 		}
 	}()
 
-	log.Info("Started")
+	raftLog.Info("Started")
 
 	return nil
 }
@@ -309,5 +411,59 @@ func (cluster *Cluster) Stop() {
 	// Wait until the completed channel is closed, signallign all shutdown tasks completed
 	<-cluster.completed
 
-	log.Info("Stopped")
+	raftLog.Info("Stopped")
+}
+
+// leadershipContext returns a context that is cancelled once this node stops leading the Raft cluster or is
+// stopped, the LeaderCh can't be read whilst the VIP is being claimed so the state changes are observed instead.
+func (cluster *Cluster) leadershipContext(raftServer *raft.Raft) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	observations := make(chan raft.Observation, 1)
+	observer := raft.NewObserver(observations, false, func(o *raft.Observation) bool {
+		state, ok := o.Data.(raft.RaftState)
+		return ok && state != raft.Leader
+	})
+	raftServer.RegisterObserver(observer)
+
+	go func() {
+		defer raftServer.DeregisterObserver(observer)
+		select {
+		case <-observations:
+			raftLog.Warnf("This node has stopped leading, abandoning the claim of the Virtual IP")
+			cancel()
+		case <-cluster.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Leadership may have been lost before the observer was registered
+	if raftServer.State() != raft.Leader {
+		cancel()
+	}
+	return ctx, cancel
+}
+
+// transferRaft will transfer leadership of the Raft cluster to the peer with id, or the most up to date peer when
+// the id is empty. Only the leader is able to transfer leadership.
+func transferRaft(raftServer *raft.Raft, id string) error {
+	if raftServer.State() != raft.Leader {
+		return fmt.Errorf("this node isn't the leader, the leader is [%s]", raftServer.Leader())
+	}
+	if id == "" {
+		raftLog.Infof("Transferring leadership to another node in the cluster")
+		return raftServer.LeadershipTransfer().Error()
+	}
+
+	future := raftServer.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return err
+	}
+	for _, server := range future.Configuration().Servers {
+		if string(server.ID) == id {
+			raftLog.Infof("Transferring leadership to peer [%s]", id)
+			return raftServer.LeadershipTransferToServer(server.ID, server.Address).Error()
+		}
+	}
+	return fmt.Errorf("unknown peer [%s]", id)
 }
@@ -0,0 +1,101 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+	"github.com/plunder-app/kube-vip/pkg/vip"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// conflictProbeTimeout is how long to wait for another host to answer a probe for the VIP
+	conflictProbeTimeout = time.Second
+	// dadTimeout is how long to wait for the kernel to complete IPv6 duplicate address detection
+	dadTimeout = 3 * time.Second
+	// conflictReportInterval stops the same conflicting host flooding the logs
+	conflictReportInterval = 10 * time.Second
+)
+
+// claimVIP will add the VIP to the interface. When conflict detection is enabled the network is checked for
+// any other host using the address, an error is only returned if a conflict is found and RefuseOnConflict is
+// set (errors adding the address are logged, as they always have been). If the context is cancelled whilst the
+// VIP is being claimed, the claim is abandoned (removing the VIP if it was added) and the error is returned.
+func (cluster *Cluster) claimVIP(ctx context.Context, c *kubevip.Config) error {
+	if c.DetectConflicts {
+		mac, err := vip.ARPProbe(ctx, c.VIP, c.Interface, conflictProbeTimeout)
+		if err != nil && ctx.Err() == nil {
+			log.Warnf("Unable to probe for address conflicts [%v]", err)
+		} else if mac != nil {
+			log.Errorf("The Virtual IP [%s] is already in use by [%s]", c.VIP, mac)
+			cluster.events.event(corev1.EventTypeWarning, eventVIPConflict, "The Virtual IP [%s] is already in use by [%s]", c.VIP, mac)
+			if c.RefuseOnConflict {
+				return fmt.Errorf("the Virtual IP [%s] is in use by [%s]", c.VIP, mac)
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("the claim of the Virtual IP [%s] was abandoned", c.VIP)
+	}
+
+	err := cluster.network.AddIP()
+	if err != nil {
+		log.Warnf("%v", err)
+		return nil
+	}
+
+	if c.DetectConflicts {
+		err = cluster.network.CheckDAD(ctx, dadTimeout)
+		if err != nil && ctx.Err() == nil {
+			log.Errorf("%v", err)
+			if c.RefuseOnConflict {
+				if err := cluster.network.DeleteIP(); err != nil {
+					log.Warnf("%v", err)
+				}
+				return err
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		if err := cluster.network.DeleteIP(); err != nil {
+			log.Warnf("%v", err)
+		}
+		return fmt.Errorf("the claim of the Virtual IP [%s] was abandoned", c.VIP)
+	}
+	cluster.events.event(corev1.EventTypeNormal, eventVIPAcquired, "Acquired the Virtual IP [%s] on interface [%s]", c.VIP, c.Interface)
+	return nil
+}
+
+// monitorConflicts will watch the network for other hosts claiming the VIP until the context is cancelled.
+// If RefuseOnConflict is set then release is called (once) so that this node can give up leadership.
+func (cluster *Cluster) monitorConflicts(ctx context.Context, c *kubevip.Config, release func()) {
+	if !c.DetectConflicts {
+		return
+	}
+
+	go func() {
+		var once sync.Once
+		reported := make(map[string]time.Time)
+
+		err := vip.ARPMonitor(ctx, c.VIP, c.Interface, func(mac net.HardwareAddr) {
+			if time.Since(reported[mac.String()]) > conflictReportInterval {
+				log.Errorf("Host [%s] is claiming the Virtual IP [%s]", mac, c.VIP)
+				cluster.events.event(corev1.EventTypeWarning, eventVIPConflict, "Host [%s] is claiming the Virtual IP [%s]", mac, c.VIP)
+				reported[mac.String()] = time.Now()
+			}
+			if c.RefuseOnConflict && release != nil {
+				once.Do(func() {
+					log.Errorf("Releasing leadership due to an address conflict on [%s]", c.VIP)
+					release()
+				})
+			}
+		})
+		if err != nil {
+			log.Warnf("Unable to monitor for address conflicts [%v]", err)
+		}
+	}()
+}
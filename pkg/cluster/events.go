@@ -0,0 +1,81 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// The reasons of the events recorded by kube-vip
+const (
+	eventVIPAcquired = "VIPAcquired"
+	eventVIPReleased = "VIPReleased"
+	eventVIPConflict = "VIPConflict"
+	eventBackendUp   = "BackendUp"
+	eventBackendDown = "BackendDown"
+	eventARPFailed   = "ARPFailed"
+)
+
+// eventRecorder - records Kubernetes events against the pod kube-vip is running in (when POD_NAME and
+// POD_NAMESPACE are set) or the node it is running on
+type eventRecorder struct {
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+	ref         *corev1.ObjectReference
+}
+
+func newEventRecorder(clientSet kubernetes.Interface, id string) *eventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientSet.CoreV1().Events("")})
+
+	node := os.Getenv("NODE_NAME")
+	if node == "" {
+		node = id
+	}
+	// kubectl matches the events of a node by using its name as the UID
+	ref := &corev1.ObjectReference{Kind: "Node", APIVersion: "v1", Name: node, UID: types.UID(node)}
+
+	name, namespace := os.Getenv("POD_NAME"), os.Getenv("POD_NAMESPACE")
+	if name != "" && namespace != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		pod, err := clientSet.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			electionLog.Warnf("Unable to find pod [%s/%s], events will be recorded on node [%s] -> error [%v]", namespace, name, node, err)
+		} else {
+			ref = &corev1.ObjectReference{Kind: "Pod", APIVersion: "v1", Name: name, Namespace: namespace, UID: pod.UID}
+		}
+	}
+	electionLog.Infof("Recording events on %s [%s]", ref.Kind, ref.Name)
+
+	return &eventRecorder{
+		broadcaster: broadcaster,
+		recorder:    broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "kube-vip", Host: node}),
+		ref:         ref,
+	}
+}
+
+// event records an event, it does nothing if events aren't enabled
+func (e *eventRecorder) event(eventType, reason, messageFmt string, args ...interface{}) {
+	if e == nil {
+		return
+	}
+	e.recorder.Event(e.ref, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// stop flushes any queued events, and stops recording
+func (e *eventRecorder) stop() {
+	if e == nil {
+		return
+	}
+	e.broadcaster.Shutdown()
+}
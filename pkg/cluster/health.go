@@ -0,0 +1,211 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+	"github.com/plunder-app/kube-vip/pkg/loadbalancer"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	// healthStallTimeout is how long the election loop can go without making progress before this node is unhealthy
+	healthStallTimeout = 60 * time.Second
+	// healthSettleTimeout is how long the VIP can disagree with the leadership before this node isn't ready, as
+	// the VIP is moved shortly after the leadership changes
+	healthSettleTimeout = 15 * time.Second
+)
+
+// The checks that make up the health of a node
+const (
+	checkElection      = "election"
+	checkVIP           = "vip"
+	checkLoadBalancers = "loadBalancers"
+)
+
+// Health - the result of the liveness (/healthz) or readiness (/readyz) checks of this node
+type Health struct {
+	Healthy bool          `json:"healthy"`
+	Checks  []HealthCheck `json:"checks"`
+}
+
+// HealthCheck - the result of a single check
+type HealthCheck struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+func (h *Health) add(name string, err error) {
+	check := HealthCheck{Name: name, Healthy: err == nil}
+	if err != nil {
+		check.Message = err.Error()
+		h.Healthy = false
+	}
+	h.Checks = append(h.Checks, check)
+}
+
+// startHealth begins tracking the health of this node, the load balancers of the configuration are expected to be
+// bound unless loadBalancers is false (they're disabled)
+func (cluster *Cluster) startHealth(c *kubevip.Config, loadBalancers bool) {
+	cluster.mux.Lock()
+	defer cluster.mux.Unlock()
+	cluster.healthConfig = c
+	cluster.healthLoadBalancers = loadBalancers
+	cluster.contesting = cluster.mode != ModeSingleNode
+	cluster.progressAt = time.Now()
+}
+
+// progress records that the election loop is running
+func (cluster *Cluster) progress() {
+	cluster.mux.Lock()
+	cluster.progressAt = time.Now()
+	cluster.mux.Unlock()
+}
+
+// setContesting records if this node is contesting the election, a node waiting on its health gates or maintenance
+// isn't expected to make progress
+func (cluster *Cluster) setContesting(contesting bool) {
+	cluster.mux.Lock()
+	cluster.contesting = contesting
+	cluster.progressAt = time.Now()
+	cluster.mux.Unlock()
+}
+
+// Liveness - returns if the election loop of this node is making progress, a node that fails this should be restarted
+func (cluster *Cluster) Liveness() *Health {
+	health := &Health{Healthy: true}
+	health.add(checkElection, cluster.checkElection())
+	return health
+}
+
+// Readiness - returns if the election loop is making progress, the VIP is held only when this node is the leader
+// and the load balancers are bound
+func (cluster *Cluster) Readiness() *Health {
+	health := &Health{Healthy: true}
+
+	cluster.mux.Lock()
+	mode := cluster.mode
+	cluster.mux.Unlock()
+	if mode == "" {
+		health.add(checkElection, fmt.Errorf("kube-vip is starting"))
+		return health
+	}
+
+	health.add(checkElection, cluster.checkElection())
+	holdsVIP, err := cluster.checkVIP()
+	health.add(checkVIP, err)
+	health.add(checkLoadBalancers, cluster.checkLoadBalancers(holdsVIP))
+	return health
+}
+
+// checkElection returns an error if the election loop hasn't made progress within the stall timeout
+func (cluster *Cluster) checkElection() error {
+	cluster.mux.Lock()
+	defer cluster.mux.Unlock()
+	if cluster.mode == "" || !cluster.contesting {
+		return nil
+	}
+	if since := time.Since(cluster.progressAt); since > healthStallTimeout {
+		return fmt.Errorf("the %s election hasn't made progress for %s", cluster.mode, since.Round(time.Second))
+	}
+	return nil
+}
+
+// checkVIP returns an error if the VIP has been held by a follower (or not held by the leader) for longer than the
+// settle timeout, and if this node holds the VIP
+func (cluster *Cluster) checkVIP() (bool, error) {
+	if cluster.network == nil {
+		return false, nil
+	}
+	holdsVIP, err := cluster.network.IsSet()
+	if err != nil {
+		return false, err
+	}
+
+	cluster.mux.Lock()
+	defer cluster.mux.Unlock()
+	isLeader := cluster.leader != "" && cluster.leader == cluster.id
+	if cluster.raft != nil {
+		isLeader = cluster.raft.State() == raft.Leader
+	}
+
+	if holdsVIP == isLeader {
+		cluster.mismatchAt = time.Time{}
+		return holdsVIP, nil
+	}
+	if cluster.mismatchAt.IsZero() {
+		cluster.mismatchAt = time.Now()
+	}
+	if since := time.Since(cluster.mismatchAt); since > healthSettleTimeout {
+		if holdsVIP {
+			return holdsVIP, fmt.Errorf("this node has held the VIP [%s] without leadership for %s", cluster.network.IP(), since.Round(time.Second))
+		}
+		return holdsVIP, fmt.Errorf("this node has led without holding the VIP [%s] for %s", cluster.network.IP(), since.Round(time.Second))
+	}
+	return holdsVIP, nil
+}
+
+// checkLoadBalancers returns an error if any expected load balancer isn't bound, the load balancers bound to the
+// VIP are only expected whilst this node holds it
+func (cluster *Cluster) checkLoadBalancers(holdsVIP bool) error {
+	cluster.mux.Lock()
+	c, enabled := cluster.healthConfig, cluster.healthLoadBalancers
+	vipLB, nonVipLB := cluster.vipLB, cluster.nonVipLB
+	cluster.mux.Unlock()
+	if c == nil || !enabled {
+		return nil
+	}
+
+	running := map[string]bool{}
+	for _, lm := range []*loadbalancer.LBManager{vipLB, nonVipLB} {
+		if lm != nil {
+			for _, s := range lm.Status() {
+				running[s.Name] = true
+			}
+		}
+	}
+
+	var failed []string
+	for x := range c.LoadBalancers {
+		lb := &c.LoadBalancers[x]
+		if lb.BindToVip && !holdsVIP {
+			continue
+		}
+		if !running[lb.Name] {
+			failed = append(failed, fmt.Sprintf("[%s]", lb.Name))
+		}
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("the load balancer(s) %s aren't bound", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// progressLock records progress of the election every time the lock is read or written, whether or not that succeeds
+type progressLock struct {
+	resourcelock.Interface
+	cluster *Cluster
+}
+
+// Get - reads the lock
+func (l *progressLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	l.cluster.progress()
+	return l.Interface.Get(ctx)
+}
+
+// Create - creates the lock
+func (l *progressLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	l.cluster.progress()
+	return l.Interface.Create(ctx, ler)
+}
+
+// Update - updates the lock
+func (l *progressLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	l.cluster.progress()
+	return l.Interface.Update(ctx, ler)
+}
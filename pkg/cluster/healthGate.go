@@ -0,0 +1,206 @@
+package cluster
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+)
+
+const (
+	// defaultGateInterval is the time between each health gate check
+	defaultGateInterval = 2 * time.Second
+	// defaultGateTimeout is the time before a health gate check is considered failed
+	defaultGateTimeout = time.Second
+	// defaultGateThreshold is the number of consecutive failures before a health gate is unhealthy
+	defaultGateThreshold = 3
+	// gateWatchInterval is how often the leader checks the state of the health gates
+	gateWatchInterval = 500 * time.Millisecond
+)
+
+// healthGates - manages the local health gates that must pass for this node to hold the VIP
+type healthGates struct {
+	gates []kubevip.HealthGate
+
+	mux     sync.RWMutex
+	failing []bool // gates that have reached their failure threshold
+	checked []bool // gates that have been checked at least once
+}
+
+func newHealthGates(gates []kubevip.HealthGate) *healthGates {
+	return &healthGates{
+		gates:   gates,
+		failing: make([]bool, len(gates)),
+		checked: make([]bool, len(gates)),
+	}
+}
+
+// start will begin checking all of the health gates until the context is cancelled
+func (h *healthGates) start(ctx context.Context) {
+	for x := range h.gates {
+		go h.run(ctx, x)
+	}
+}
+
+// Healthy - returns true once every health gate has been checked and is passing
+func (h *healthGates) Healthy() bool {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	for x := range h.gates {
+		if !h.checked[x] || h.failing[x] {
+			return false
+		}
+	}
+	return true
+}
+
+// watch will call release once if the health gates fail before the context is cancelled
+func (h *healthGates) watch(ctx context.Context, release func()) {
+	if len(h.gates) == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(gateWatchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !h.Healthy() {
+					log.Errorf("Local health gates are failing, releasing leadership")
+					release()
+					return
+				}
+			}
+		}
+	}()
+}
+
+// wait will block until the health gates are passing, it returns false if the stop channel is closed first
+func (h *healthGates) wait(stop <-chan struct{}) bool {
+	if h.Healthy() {
+		return true
+	}
+	log.Warnf("Local health gates are failing, this node will not contest leadership until they pass")
+
+	ticker := time.NewTicker(gateWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return false
+		case <-ticker.C:
+			if h.Healthy() {
+				log.Infof("Local health gates are passing")
+				return true
+			}
+		}
+	}
+}
+
+func (h *healthGates) run(ctx context.Context, x int) {
+	gate := h.gates[x]
+	if gate.Name == "" {
+		gate.Name = fmt.Sprintf("%s %s", gate.Type, gate.Address)
+	}
+	interval := defaultGateInterval
+	if gate.Interval > 0 {
+		interval = time.Duration(gate.Interval) * time.Second
+	}
+	timeout := defaultGateTimeout
+	if gate.Timeout > 0 {
+		timeout = time.Duration(gate.Timeout) * time.Second
+	}
+	threshold := defaultGateThreshold
+	if gate.FailureThreshold > 0 {
+		threshold = gate.FailureThreshold
+	}
+
+	// A http(s) gate keeps the same client, so that its connection is reused between checks
+	var client *http.Client
+	switch strings.ToLower(gate.Type) {
+	case "http", "https":
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: gate.InsecureSkipVerify}
+		client = &http.Client{Transport: transport}
+		defer transport.CloseIdleConnections()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var failures int
+	for {
+		err := checkGate(ctx, gate, client, timeout)
+		if err != nil {
+			failures++
+			log.Debugf("Health gate [%s] failed [%d/%d] -> error [%v]", gate.Name, failures, threshold, err)
+		} else {
+			failures = 0
+		}
+
+		h.mux.Lock()
+		failing := failures >= threshold
+		if failing != h.failing[x] {
+			if failing {
+				log.Warnf("Health gate [%s] is unhealthy -> error [%v]", gate.Name, err)
+			} else {
+				log.Infof("Health gate [%s] is healthy", gate.Name)
+			}
+		}
+		h.failing[x] = failing
+		// A gate only counts as checked once it has passed, or has failed enough to be unhealthy
+		h.checked[x] = h.checked[x] || err == nil || failing
+		h.mux.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkGate runs a single check of a health gate, returning an error if it fails. The client is used by http(s) gates
+func checkGate(ctx context.Context, gate kubevip.HealthGate, client *http.Client, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch strings.ToLower(gate.Type) {
+	case "tcp":
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", gate.Address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, gate.Address, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return fmt.Errorf("unhealthy status [%s]", resp.Status)
+		}
+		return nil
+	case "exec":
+		if len(gate.Command) == 0 {
+			return fmt.Errorf("no command to run")
+		}
+		return exec.CommandContext(ctx, gate.Command[0], gate.Command[1:]...).Run()
+	}
+	return fmt.Errorf("unknown health gate type [%s]", gate.Type)
+}
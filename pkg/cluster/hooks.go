@@ -0,0 +1,150 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+	"github.com/plunder-app/kube-vip/pkg/loadbalancer"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// defaultHookTimeout is the time before a hook is considered failed
+const defaultHookTimeout = 10 * time.Second
+
+// hookEvent - the details of an event passed to a hook, as environment variables (exec) or JSON (http)
+type hookEvent struct {
+	Event     string    `json:"event"`
+	VIP       string    `json:"vip"`
+	Interface string    `json:"interface"`
+	Node      string    `json:"node"`
+	Mode      string    `json:"mode"`
+	Time      time.Time `json:"time"`
+}
+
+// runHooks runs every hook configured for the event in order, it returns an error if a hook with the fail policy
+// fails (any other failures are logged)
+func (cluster *Cluster) runHooks(c *kubevip.Config, event string) error {
+	cluster.mux.Lock()
+	e := hookEvent{
+		Event:     event,
+		VIP:       c.VIP,
+		Interface: c.Interface,
+		Node:      cluster.id,
+		Mode:      cluster.mode,
+		Time:      time.Now(),
+	}
+	cluster.mux.Unlock()
+
+	for _, hook := range c.Hooks {
+		if hook.Event != event {
+			continue
+		}
+		if hook.Name == "" {
+			hook.Name = fmt.Sprintf("%s %s", hook.Type, hook.Event)
+		}
+		timeout := defaultHookTimeout
+		if hook.Timeout > 0 {
+			timeout = time.Duration(hook.Timeout) * time.Second
+		}
+
+		log.Infof("Running hook [%s]", hook.Name)
+		err := runHook(hook, e, timeout)
+		if err == nil {
+			continue
+		}
+		if hook.FailurePolicy == "fail" {
+			return fmt.Errorf("hook [%s] failed -> error [%v]", hook.Name, err)
+		}
+		log.Warnf("Hook [%s] failed -> error [%v]", hook.Name, err)
+	}
+	return nil
+}
+
+// releaseVIP stops the load balancers bound to the VIP and removes it, when this node was holding the VIP the
+// release hooks are run around it (and an event recorded). Anything else tied to holding the VIP is stopped
+// through stop (which can be nil).
+func (cluster *Cluster) releaseVIP(c *kubevip.Config, lm *loadbalancer.LBManager, holding bool, stop func()) {
+	if holding {
+		err := cluster.runHooks(c, kubevip.HookBeforeRelease)
+		if err != nil {
+			log.Errorf("%v", err)
+		}
+	}
+
+	if stop != nil {
+		stop()
+	}
+
+	// Stop all load balancers associated with the VIP
+	err := lm.StopAll()
+	if err != nil {
+		log.Warnf("%v", err)
+	}
+
+	err = cluster.network.DeleteIP()
+	if err != nil {
+		log.Warnf("%v", err)
+	}
+
+	if holding {
+		cluster.events.event(corev1.EventTypeNormal, eventVIPReleased, "Released the Virtual IP [%s] on interface [%s]", c.VIP, c.Interface)
+		err = cluster.runHooks(c, kubevip.HookAfterRelease)
+		if err != nil {
+			log.Errorf("%v", err)
+		}
+	}
+}
+
+// runHook runs a single hook, returning an error if it fails or doesn't complete within the timeout
+func runHook(hook kubevip.Hook, e hookEvent, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	switch strings.ToLower(hook.Type) {
+	case "exec":
+		if len(hook.Command) == 0 {
+			return fmt.Errorf("no command to run")
+		}
+		cmd := exec.CommandContext(ctx, hook.Command[0], hook.Command[1:]...)
+		cmd.Env = append(os.Environ(),
+			"KUBE_VIP_EVENT="+e.Event,
+			"KUBE_VIP_VIP="+e.VIP,
+			"KUBE_VIP_INTERFACE="+e.Interface,
+			"KUBE_VIP_NODE="+e.Node,
+			"KUBE_VIP_MODE="+e.Mode,
+		)
+		out, err := cmd.CombinedOutput()
+		if len(out) != 0 {
+			log.Debugf("Hook [%s] output: %s", hook.Name, out)
+		}
+		return err
+	case "http", "https":
+		body, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("unexpected status [%s]", resp.Status)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown hook type [%s]", hook.Type)
+}
@@ -0,0 +1,116 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	// vipAnnotation records the VIP on the lease
+	vipAnnotation = "kube-vip.io/vip"
+	// interfaceAnnotation records the interface of the VIP on the lease
+	interfaceAnnotation = "kube-vip.io/interface"
+	// historyAnnotation records the most recent VIP transitions on the lease
+	historyAnnotation = "kube-vip.io/history"
+
+	// leaseHistoryLength is the number of transitions kept in the history annotation
+	leaseHistoryLength = 10
+	// leaseAnnotateTimeout is how long updating the lease annotations can take
+	leaseAnnotateTimeout = 5 * time.Second
+)
+
+// transition is an entry of the history annotation
+type transition struct {
+	Node  string    `json:"node"`
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+}
+
+// NewLock - returns the resource lock used by the leader election, of the type set in the configuration
+func NewLock(clientSet kubernetes.Interface, le *kubevip.LeaderElection, id string) (resourcelock.Interface, error) {
+	return resourcelock.New(le.LeaseLockType, le.LeaseNamespace, le.LeaseName, clientSet.CoreV1(), clientSet.CoordinationV1(), resourcelock.ResourceLockConfig{
+		Identity: id,
+	})
+}
+
+// hasLease - returns true if the lock type is (or is migrating to) a Lease, older lock types have no Lease to annotate
+func hasLease(le *kubevip.LeaderElection) bool {
+	return strings.HasSuffix(le.LeaseLockType, resourcelock.LeasesResourceLock)
+}
+
+// getLease - returns the lease used for leader election
+func (sm *Manager) getLease(ctx context.Context, namespace, name string) (*coordinationv1.Lease, error) {
+	return sm.clientSet.CoordinationV1().Leases(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// annotateLease will merge the annotations into the lease used for leader election, a nil value will
+// remove that annotation. A patch is used so that the annotations can be set by any node, not just the leader.
+// If resourceVersion is set the patch fails with a conflict when the lease has changed since that version.
+func (sm *Manager) annotateLease(ctx context.Context, namespace, name, resourceVersion string, annotations map[string]*string) error {
+	metadata := map[string]interface{}{
+		"annotations": annotations,
+	}
+	if resourceVersion != "" {
+		metadata["resourceVersion"] = resourceVersion
+	}
+	patch := map[string]interface{}{
+		"metadata": metadata,
+	}
+	b, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	_, err = sm.clientSet.CoordinationV1().Leases(namespace).Patch(ctx, name, types.MergePatchType, b, metav1.PatchOptions{})
+	return err
+}
+
+// recordTransition will add the VIP transition (acquired or released) of this node to the history annotation of the
+// lease, along with the VIP and its interface so they can be found with kubectl describe
+func (sm *Manager) recordTransition(c *kubevip.Config, id, event string) {
+	le := &c.LeaderElection
+	if !hasLease(le) {
+		return
+	}
+	// The transition is recorded even when leadership has just been lost, so a new context is used
+	ctx, cancel := context.WithTimeout(context.Background(), leaseAnnotateTimeout)
+	defer cancel()
+
+	var history []transition
+	lease, err := sm.getLease(ctx, le.LeaseNamespace, le.LeaseName)
+	if err != nil {
+		electionLog.Warnf("Unable to record the VIP transition on lease [%s] -> error [%v]", le.LeaseName, err)
+		return
+	}
+	if h, ok := lease.Annotations[historyAnnotation]; ok {
+		// A malformed history is replaced
+		_ = json.Unmarshal([]byte(h), &history)
+	}
+	history = append(history, transition{Node: id, Event: event, Time: time.Now().UTC()})
+	if len(history) > leaseHistoryLength {
+		history = history[len(history)-leaseHistoryLength:]
+	}
+	b, err := json.Marshal(history)
+	if err != nil {
+		electionLog.Warnf("%v", err)
+		return
+	}
+	h := string(b)
+
+	err = sm.annotateLease(ctx, le.LeaseNamespace, le.LeaseName, "", map[string]*string{
+		vipAnnotation:       &c.VIP,
+		interfaceAnnotation: &c.Interface,
+		historyAnnotation:   &h,
+	})
+	if err != nil {
+		electionLog.Warnf("Unable to record the VIP transition on lease [%s] -> error [%v]", le.LeaseName, err)
+	}
+}
@@ -0,0 +1,11 @@
+package cluster
+
+import "github.com/plunder-app/kube-vip/pkg/logging"
+
+// The loggers of each subsystem within the cluster
+var (
+	log         = logging.Logger(logging.VIP)
+	arpLog      = logging.Logger(logging.ARP)
+	raftLog     = logging.Logger(logging.Raft)
+	electionLog = logging.Logger(logging.Election)
+)
@@ -0,0 +1,133 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+	"github.com/plunder-app/kube-vip/pkg/loadbalancer"
+)
+
+const (
+	// maintenanceWatchInterval is how often the leader checks if this node has been placed into maintenance
+	maintenanceWatchInterval = 500 * time.Millisecond
+	// drainTimeout is how long the load balancers wait for their active connections when draining, it is within the
+	// timeout of a kube-vip maintenance request
+	drainTimeout = 20 * time.Second
+)
+
+// setControls records how the current mode transfers leadership and enters (or leaves) maintenance, either can
+// be nil when the mode doesn't support it
+func (cluster *Cluster) setControls(transfer func(id string) error, maintenance func(enabled bool) error) {
+	cluster.mux.Lock()
+	defer cluster.mux.Unlock()
+	cluster.onTransfer = transfer
+	cluster.onMaintenance = maintenance
+}
+
+// TransferLeadership - hands leadership of the cluster to another node, an empty id lets the cluster choose
+func (cluster *Cluster) TransferLeadership(id string) error {
+	cluster.mux.Lock()
+	transfer, mode := cluster.onTransfer, cluster.mode
+	cluster.mux.Unlock()
+
+	if transfer == nil {
+		return fmt.Errorf("leadership transfer isn't supported in [%s] mode", mode)
+	}
+	return transfer(id)
+}
+
+// SetMaintenance - places this node into (or out of) maintenance, whilst in maintenance the node will give up and
+// not contest leadership, and the load balancers bound to the node are drained
+func (cluster *Cluster) SetMaintenance(enabled bool) error {
+	cluster.mux.Lock()
+	changed := cluster.maintenance != enabled
+	cluster.maintenance = enabled
+	maintenance := cluster.onMaintenance
+	cluster.mux.Unlock()
+
+	if !changed {
+		return nil
+	}
+	if enabled {
+		log.Warnf("This node is entering maintenance, it will not hold the VIP until maintenance is cleared")
+	} else {
+		log.Infof("This node is leaving maintenance")
+	}
+	if maintenance == nil {
+		return nil
+	}
+	return maintenance(enabled)
+}
+
+// InMaintenance - returns true when this node has been placed into maintenance
+func (cluster *Cluster) InMaintenance() bool {
+	cluster.mux.Lock()
+	defer cluster.mux.Unlock()
+	return cluster.maintenance
+}
+
+// watchMaintenance will call release once if this node is placed into maintenance before the context is cancelled
+func (cluster *Cluster) watchMaintenance(ctx context.Context, release func()) {
+	go func() {
+		ticker := time.NewTicker(maintenanceWatchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if cluster.InMaintenance() {
+					log.Warnf("This node is in maintenance, releasing leadership")
+					release()
+					return
+				}
+			}
+		}
+	}()
+}
+
+// waitMaintenance will block until this node isn't in maintenance, it returns false if the stop channel is closed first
+func (cluster *Cluster) waitMaintenance(stop <-chan struct{}) bool {
+	if !cluster.InMaintenance() {
+		return true
+	}
+	log.Warnf("This node is in maintenance, it will not contest leadership until maintenance is cleared")
+
+	ticker := time.NewTicker(maintenanceWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return false
+		case <-ticker.C:
+			if !cluster.InMaintenance() {
+				return true
+			}
+		}
+	}
+}
+
+// drainLoadBalancers stops the load balancers bound to this node accepting connections when it enters maintenance,
+// and stops them once their active connections have finished (or the drain timeout passes). They are started again
+// once maintenance is cleared
+func drainLoadBalancers(c *kubevip.Config, lm *loadbalancer.LBManager, drain bool) {
+	if drain {
+		log.Infof("Draining the load balancers bound to this node")
+		err := lm.DrainAll(drainTimeout)
+		if err != nil {
+			log.Warnf("%v", err)
+		}
+		return
+	}
+
+	for x := range c.LoadBalancers {
+		if c.LoadBalancers[x].BindToVip == false {
+			err := lm.Add("", &c.LoadBalancers[x])
+			if err != nil {
+				log.Warnf("Error creating loadbalancer [%s] type [%s] -> error [%s]", c.LoadBalancers[x].Name, c.LoadBalancers[x].Type, err)
+			}
+		}
+	}
+}
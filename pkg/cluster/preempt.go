@@ -0,0 +1,285 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// priorityAnnotation records the priority of the node holding the lease
+	priorityAnnotation = "kube-vip.io/priority"
+	// preemptAnnotation records a higher priority node asking the leader to release the lease
+	preemptAnnotation = "kube-vip.io/preempt"
+
+	// defaultPreemptDelay is how long a higher priority node must be present before it takes leadership
+	defaultPreemptDelay = 10 * time.Second
+	// preemptCheckInterval is how often the lease is checked for a preempting node
+	preemptCheckInterval = time.Second
+	// preemptClaimExpiry is how long a preempt claim is valid, it is refreshed whilst a node is waiting
+	preemptClaimExpiry = 10 * time.Second
+	// preemptDialTimeout is how long the Raft leader waits when checking a peer is reachable
+	preemptDialTimeout = 500 * time.Millisecond
+)
+
+// preemptClaim is written to the preempt annotation by a node wanting to take leadership
+type preemptClaim struct {
+	ID       string    `json:"id"`
+	Priority int       `json:"priority"`
+	Time     time.Time `json:"time"`
+}
+
+func preemptDelay(c *kubevip.Config) time.Duration {
+	if c.PreemptDelay > 0 {
+		return time.Duration(c.PreemptDelay) * time.Second
+	}
+	return defaultPreemptDelay
+}
+
+// announcePriority will record the priority of this node on the lease once it becomes the leader, and clear any
+// claim that has been made on it
+func (cluster *Cluster) announcePriority(ctx context.Context, c *kubevip.Config, sm *Manager) {
+	if !hasLease(&c.LeaderElection) {
+		return
+	}
+	priority := strconv.Itoa(c.Priority)
+	err := sm.annotateLease(ctx, c.LeaderElection.LeaseNamespace, c.LeaderElection.LeaseName, "", map[string]*string{
+		priorityAnnotation: &priority,
+		preemptAnnotation:  nil,
+	})
+	if err != nil {
+		electionLog.Warnf("Unable to record priority on lease [%s] -> error [%v]", c.LeaderElection.LeaseName, err)
+	}
+}
+
+// preemptLease runs alongside the leader election until the context is cancelled. As a leader this node will
+// release the lease (through release) when a higher priority node has claimed it, and as a follower this node
+// will claim the lease from a lower priority leader once the preempt delay has passed.
+func (cluster *Cluster) preemptLease(ctx context.Context, c *kubevip.Config, sm *Manager, id string, release func()) {
+	if c.NoPreempt {
+		return
+	}
+	if !hasLease(&c.LeaderElection) {
+		electionLog.Warnf("Priority preemption requires a lease lock, the [%s] lock type isn't supported", c.LeaderElection.LeaseLockType)
+		return
+	}
+	delay := preemptDelay(c)
+	le := &c.LeaderElection
+
+	go func() {
+		ticker := time.NewTicker(preemptCheckInterval)
+		defer ticker.Stop()
+
+		// The time this node first found a lower priority leader
+		var waiting time.Time
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			lease, err := sm.getLease(ctx, le.LeaseNamespace, le.LeaseName)
+			if err != nil {
+				electionLog.Debugf("Unable to read lease [%s] -> error [%v]", le.LeaseName, err)
+				continue
+			}
+			var holder string
+			if lease.Spec.HolderIdentity != nil {
+				holder = *lease.Spec.HolderIdentity
+			}
+
+			switch holder {
+			case "":
+				waiting = time.Time{}
+			case id:
+				var claim preemptClaim
+				if json.Unmarshal([]byte(lease.Annotations[preemptAnnotation]), &claim) != nil {
+					continue
+				}
+				if claim.ID != id && claim.Priority > c.Priority && time.Since(claim.Time) < preemptClaimExpiry {
+					electionLog.Infof("Node [%s] with priority [%d] is preempting this node with priority [%d], releasing leadership", claim.ID, claim.Priority, c.Priority)
+					release()
+					return
+				}
+			default:
+				// A leader that hasn't recorded a priority has the default priority of zero
+				holderPriority, _ := strconv.Atoi(lease.Annotations[priorityAnnotation])
+				if c.Priority <= holderPriority {
+					waiting = time.Time{}
+					continue
+				}
+				if waiting.IsZero() {
+					electionLog.Infof("Node [%s] with priority [%d] is leading, this node with priority [%d] will take leadership in [%s]", holder, holderPriority, c.Priority, delay)
+					waiting = time.Now()
+				}
+				if time.Since(waiting) < delay {
+					continue
+				}
+
+				err = sm.claimLease(ctx, le, preemptClaim{ID: id, Priority: c.Priority, Time: time.Now()})
+				if err != nil {
+					electionLog.Warnf("Unable to claim lease [%s] -> error [%v]", le.LeaseName, err)
+				}
+			}
+		}
+	}()
+}
+
+// claimLease writes the claim of this node to the preempt annotation of the lease. The write fails if the lease
+// has changed since it was read, as another node may have claimed it, so it is retried against the new lease where
+// a valid claim from a higher priority node is left in place.
+func (sm *Manager) claimLease(ctx context.Context, le *kubevip.LeaderElection, claim preemptClaim) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		lease, err := sm.getLease(ctx, le.LeaseNamespace, le.LeaseName)
+		if err != nil {
+			return err
+		}
+		var current preemptClaim
+		if json.Unmarshal([]byte(lease.Annotations[preemptAnnotation]), &current) == nil && current.ID != claim.ID &&
+			current.Priority > claim.Priority && time.Since(current.Time) < preemptClaimExpiry {
+			return nil
+		}
+		b, err := json.Marshal(claim)
+		if err != nil {
+			return err
+		}
+		value := string(b)
+		return sm.annotateLease(ctx, le.LeaseNamespace, le.LeaseName, lease.ResourceVersion, map[string]*string{preemptAnnotation: &value})
+	})
+}
+
+// raftPreemption tracks the higher priority peers whilst this node is the Raft leader, their reachability is
+// checked in the background so that an unreachable peer doesn't hold up the Raft leader
+type raftPreemption struct {
+	mux          sync.Mutex
+	reachable    map[string]time.Time // when each peer was first reachable
+	checking     map[string]bool      // peers whose reachability is being checked
+	transferring bool                 // a transfer of leadership is in progress
+}
+
+func newRaftPreemption() *raftPreemption {
+	return &raftPreemption{
+		reachable: make(map[string]time.Time),
+		checking:  make(map[string]bool),
+	}
+}
+
+// check will dial a peer in the background, recording when it first became reachable or forgetting it if it isn't
+func (p *raftPreemption) check(c *kubevip.Config, peer *kubevip.RaftPeer, address string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.checking[peer.ID] {
+		return
+	}
+	p.checking[peer.ID] = true
+
+	go func(id string, priority int) {
+		conn, err := net.DialTimeout("tcp", address, preemptDialTimeout)
+		if err == nil {
+			conn.Close()
+		}
+
+		p.mux.Lock()
+		defer p.mux.Unlock()
+		delete(p.checking, id)
+		if err != nil {
+			delete(p.reachable, id)
+			return
+		}
+		if _, ok := p.reachable[id]; !ok {
+			electionLog.Infof("Peer [%s] with priority [%d] is available, it will take leadership in [%s]", id, priority, preemptDelay(c))
+			p.reachable[id] = time.Now()
+		}
+	}(peer.ID, peer.Priority)
+}
+
+// since returns how long a peer has been reachable for
+func (p *raftPreemption) since(id string) (time.Duration, bool) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	first, ok := p.reachable[id]
+	return time.Since(first), ok
+}
+
+// forget stops tracking a peer
+func (p *raftPreemption) forget(id string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	delete(p.reachable, id)
+}
+
+// preemptRaft is called regularly whilst this node is the Raft leader, it will transfer leadership to the highest
+// priority peer that has been reachable for the preempt delay.
+func (cluster *Cluster) preemptRaft(raftServer *raft.Raft, c *kubevip.Config, preemption *raftPreemption) {
+	if c.NoPreempt {
+		return
+	}
+
+	future := raftServer.GetConfiguration()
+	if err := future.Error(); err != nil {
+		electionLog.Debugf("Unable to read the Raft configuration -> error [%v]", err)
+		return
+	}
+	servers := make(map[raft.ServerID]raft.Server)
+	for _, server := range future.Configuration().Servers {
+		servers[server.ID] = server
+	}
+
+	var preferred *kubevip.RaftPeer
+	for x := range c.RemotePeers {
+		peer := &c.RemotePeers[x]
+		server, ok := servers[raft.ServerID(peer.ID)]
+		if peer.ID == c.LocalPeer.ID || peer.Priority <= c.Priority || !ok || server.Suffrage != raft.Voter {
+			preemption.forget(peer.ID)
+			continue
+		}
+
+		// The result of the check is used by a later call
+		preemption.check(c, peer, string(server.Address))
+
+		if reachable, ok := preemption.since(peer.ID); ok && reachable >= preemptDelay(c) && (preferred == nil || peer.Priority > preferred.Priority) {
+			preferred = peer
+		}
+	}
+
+	if preferred == nil {
+		return
+	}
+
+	if preemption.transfer(raftServer, preferred, servers[raft.ServerID(preferred.ID)].Address) {
+		preemption.forget(preferred.ID)
+	}
+}
+
+// transfer will transfer leadership to a peer in the background, so that the Raft leader isn't held up whilst the
+// peer catches up. It returns false if a transfer is already in progress.
+func (p *raftPreemption) transfer(raftServer *raft.Raft, peer *kubevip.RaftPeer, address raft.ServerAddress) bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.transferring {
+		return false
+	}
+	p.transferring = true
+
+	electionLog.Infof("Transferring leadership to peer [%s] with priority [%d]", peer.ID, peer.Priority)
+	go func(id string) {
+		err := raftServer.LeadershipTransferToServer(raft.ServerID(id), address).Error()
+		if err != nil {
+			electionLog.Warnf("Unable to transfer leadership to peer [%s] -> error [%v]", id, err)
+		}
+
+		p.mux.Lock()
+		defer p.mux.Unlock()
+		p.transferring = false
+	}(peer.ID)
+	return true
+}
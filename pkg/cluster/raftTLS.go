@@ -0,0 +1,321 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+)
+
+// raftHandshakeTimeout is how long a peer has to complete the TLS handshake
+const raftHandshakeTimeout = 5 * time.Second
+
+// certReloader - holds the certificates used for the Raft transport, reloading them when the files change
+type certReloader struct {
+	certFile, keyFile, caFile string
+
+	mux     sync.Mutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time // the newest modification time of the files when they were loaded
+}
+
+// load will (re)load the certificates if any of the files have changed since they were last loaded
+func (r *certReloader) load() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	var newest time.Time
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	if r.cert != nil && !newest.After(r.modTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load Raft certificate [%s] -> error [%v]", r.certFile, err)
+	}
+	ca, err := ioutil.ReadFile(r.caFile)
+	if err != nil {
+		return fmt.Errorf("unable to load Raft CA [%s] -> error [%v]", r.caFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return fmt.Errorf("no certificates found in Raft CA [%s]", r.caFile)
+	}
+
+	if r.cert != nil {
+		raftLog.Infof("Reloaded the Raft transport certificates")
+	}
+	r.cert, r.pool, r.modTime = &cert, pool, newest
+	return nil
+}
+
+// current - returns the current certificate and CA, reloading them if needed. If the reload fails then the
+// previous certificates are kept, so that a partially written file doesn't break the cluster.
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool, error) {
+	err := r.load()
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.cert == nil {
+		return nil, nil, err
+	}
+	if err != nil {
+		raftLog.Warnf("%v, using the previous certificates", err)
+	}
+	return r.cert, r.pool, nil
+}
+
+// verify checks the certificate chain presented by a peer against the current CA
+func (r *certReloader) verify(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	_, pool, err := r.current()
+	if err != nil {
+		return err
+	}
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("no certificate presented")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for x := range rawCerts {
+		certs[x], err = x509.ParseCertificate(rawCerts[x])
+		if err != nil {
+			return err
+		}
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = certs[0].Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
+
+// tlsStreamLayer - implements the Raft stream layer with mutual TLS, every peer must present a certificate
+// signed by the CA whose common name or DNS names contain the ID of that peer. Connections are accepted and their
+// handshakes completed in the background, so a peer that never completes its handshake doesn't hold up the others.
+type tlsStreamLayer struct {
+	listener  net.Listener
+	advertise net.Addr
+	certs     *certReloader
+	peers     []kubevip.RaftPeer
+
+	accepted  chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newTLSStreamLayer(bindAddress string, advertise net.Addr, c *kubevip.Config) (*tlsStreamLayer, error) {
+	certs := &certReloader{
+		certFile: c.RaftTLSCert,
+		keyFile:  c.RaftTLSKey,
+		caFile:   c.RaftTLSCA,
+	}
+	if err := certs.load(); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", bindAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &tlsStreamLayer{
+		listener:  listener,
+		advertise: advertise,
+		certs:     certs,
+		peers:     append([]kubevip.RaftPeer{c.LocalPeer}, c.RemotePeers...),
+		accepted:  make(chan net.Conn),
+		closed:    make(chan struct{}),
+	}
+	go t.serve()
+	return t, nil
+}
+
+// config - returns the TLS configuration, the certificates are returned per handshake so that they can be reloaded
+// and the chain is verified by the certReloader (rather than crypto/tls) so that the CA can be reloaded.
+func (t *tlsStreamLayer) config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _, err := t.certs.current()
+			return cert, err
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _, err := t.certs.current()
+			return cert, err
+		},
+		ClientAuth:            tls.RequireAnyClientCert,
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: t.certs.verify,
+	}
+}
+
+// peerIDs - returns the ids of the peers at a host, a peer configured with a hostname is resolved. A port of zero
+// matches a peer on any port (the port of an incoming connection isn't the port the peer listens on)
+func (t *tlsStreamLayer) peerIDs(host string, port int) []string {
+	hostIP := net.ParseIP(host)
+	var ids []string
+	for x := range t.peers {
+		peer := &t.peers[x]
+		if port != 0 && peer.Port != port {
+			continue
+		}
+		if strings.EqualFold(peer.Address, host) {
+			ids = append(ids, peer.ID)
+			continue
+		}
+		if hostIP == nil {
+			continue
+		}
+		addresses := []string{peer.Address}
+		if net.ParseIP(peer.Address) == nil {
+			resolved, err := net.LookupHost(peer.Address)
+			if err != nil {
+				raftLog.Debugf("Unable to resolve Raft peer [%s] -> error [%v]", peer.Address, err)
+				continue
+			}
+			addresses = resolved
+		}
+		for _, address := range addresses {
+			if net.ParseIP(address).Equal(hostIP) {
+				ids = append(ids, peer.ID)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// serve accepts peer connections until the listener is closed, completing the handshake of each in the background
+func (t *tlsStreamLayer) serve() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			select {
+			case <-t.closed:
+				return
+			default:
+			}
+			raftLog.Warnf("Unable to accept Raft connection -> error [%v]", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		go t.accept(conn)
+	}
+}
+
+// accept completes the handshake of a peer connection, passing it to Accept. Peers that fail the handshake or
+// present the identity of a peer at another address are rejected
+func (t *tlsStreamLayer) accept(conn net.Conn) {
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	tlsConn, err := t.handshake(tls.Server(conn, t.config()), t.peerIDs(host, 0))
+	if err == io.EOF {
+		// A peer checking this node is reachable (see StartRaftCluster) will close without a handshake
+		raftLog.Debugf("Raft connection from [%s] closed before the handshake", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+	if err != nil {
+		raftLog.Warnf("Rejected Raft connection from [%s] -> error [%v]", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	select {
+	case t.accepted <- tlsConn:
+	case <-t.closed:
+		tlsConn.Close()
+	}
+}
+
+// Accept returns the next peer connection that has completed its handshake
+func (t *tlsStreamLayer) Accept() (net.Conn, error) {
+	select {
+	case conn := <-t.accepted:
+		return conn, nil
+	case <-t.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Dial creates a connection to a peer, the peer must present the identity configured for that address
+func (t *tlsStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	var ids []string
+	if host, port, err := net.SplitHostPort(string(address)); err == nil {
+		p, _ := strconv.Atoi(port)
+		ids = t.peerIDs(host, p)
+	}
+
+	conn, err := net.DialTimeout("tcp", string(address), timeout)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn, err := t.handshake(tls.Client(conn, t.config()), ids)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Raft connection to [%s] failed -> error [%v]", address, err)
+	}
+	return tlsConn, nil
+}
+
+// handshake completes the TLS handshake and checks that the peer presents one of the ids
+func (t *tlsStreamLayer) handshake(conn *tls.Conn, ids []string) (net.Conn, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("address isn't a configured peer")
+	}
+
+	conn.SetDeadline(time.Now().Add(raftHandshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	cert := conn.ConnectionState().PeerCertificates[0]
+	for _, id := range ids {
+		if cert.Subject.CommonName == id {
+			return conn, nil
+		}
+		for _, name := range cert.DNSNames {
+			if name == id {
+				return conn, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("certificate [%s] doesn't match the peer id %v", cert.Subject.CommonName, ids)
+}
+
+// Close closes the listener, and stops accepting connections
+func (t *tlsStreamLayer) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+	})
+	return t.listener.Close()
+}
+
+// Addr returns the address advertised to the other peers
+func (t *tlsStreamLayer) Addr() net.Addr {
+	return t.advertise
+}
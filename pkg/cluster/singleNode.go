@@ -1,11 +1,11 @@
 package cluster
 
 import (
-	log "github.com/sirupsen/logrus"
+	"context"
+	"os"
 
 	"github.com/plunder-app/kube-vip/pkg/kubevip"
 	"github.com/plunder-app/kube-vip/pkg/loadbalancer"
-	"github.com/plunder-app/kube-vip/pkg/vip"
 )
 
 // StartSingleNode will start a single node cluster
@@ -20,6 +20,10 @@ func (cluster *Cluster) StartSingleNode(c *kubevip.Config, disableVIP bool) erro
 	cluster.stop = make(chan bool, 1)
 	cluster.completed = make(chan bool, 1)
 
+	// use a Go context so we can stop monitoring for address conflicts and
+	// any ARP broadcasts when we stop the node
+	ctx, cancel := context.WithCancel(context.Background())
+
 	// Managers for Vip load balancers and none-vip loadbalancers
 	nonVipLB := loadbalancer.LBManager{}
 	VipLB := loadbalancer.LBManager{}
@@ -36,35 +40,56 @@ func (cluster *Cluster) StartSingleNode(c *kubevip.Config, disableVIP bool) erro
 		}
 	}
 
+	// Record the load balancers for the admin API, as a single node this node is always the leader
+	id, _ := os.Hostname()
+	cluster.setStatus(ModeSingleNode, id, nil, &VipLB, &nonVipLB)
+	cluster.startHealth(c, true)
+	cluster.setLeader(id)
+	// There is no other node to hold the VIP, so maintenance only drains the load balancers bound to this node
+	cluster.setControls(nil, func(enabled bool) error {
+		drainLoadBalancers(c, &nonVipLB, enabled)
+		return nil
+	})
+
 	if !disableVIP {
 		err := cluster.network.DeleteIP()
 		if err != nil {
 			log.Warnf("Attempted to clean existing VIP => %v", err)
 		}
 
-		err = cluster.network.AddIP()
-		if err != nil {
-			log.Warnf("%v", err)
+		err = cluster.runHooks(c, kubevip.HookBeforeAcquire)
+		if err == nil {
+			err = cluster.claimVIP(ctx, c)
 		}
+		if err != nil {
+			// There is no other node to hand over to, so the VIP is left to the conflicting host
+			log.Errorf("%v, the Virtual IP will not be added", err)
+		} else {
+			// Monitor for any other host claiming the VIP (there is no leadership to release)
+			cluster.monitorConflicts(ctx, c, nil)
 
-		// Once we have the VIP running, start the load balancer(s) that bind to the VIP
-		for x := range c.LoadBalancers {
+			// Once we have the VIP running, start the load balancer(s) that bind to the VIP
+			for x := range c.LoadBalancers {
 
-			if c.LoadBalancers[x].BindToVip == true {
-				err = VipLB.Add(c.VIP, &c.LoadBalancers[x])
-				if err != nil {
-					log.Warnf("Error creating loadbalancer [%s] type [%s] -> error [%s]", c.LoadBalancers[x].Name, c.LoadBalancers[x].Type, err)
+				if c.LoadBalancers[x].BindToVip == true {
+					err = VipLB.Add(c.VIP, &c.LoadBalancers[x])
+					if err != nil {
+						log.Warnf("Error creating loadbalancer [%s] type [%s] -> error [%s]", c.LoadBalancers[x].Name, c.LoadBalancers[x].Type, err)
+					}
 				}
 			}
+
+			err = cluster.runHooks(c, kubevip.HookAfterAcquire)
+			if err != nil {
+				log.Errorf("%v, the Virtual IP will be removed", err)
+				cluster.releaseVIP(c, &VipLB, true, cancel)
+			}
 		}
 	}
 
 	if c.GratuitousARP == true {
 		// Gratuitous ARP, will broadcast to new MAC <-> IP
-		err := vip.ARPSendGratuitous(c.VIP, c.Interface)
-		if err != nil {
-			log.Warnf("%v", err)
-		}
+		cluster.startARP(ctx, c)
 	}
 
 	go func() {
@@ -73,14 +98,11 @@ func (cluster *Cluster) StartSingleNode(c *kubevip.Config, disableVIP bool) erro
 			case <-cluster.stop:
 				log.Info("[LOADBALANCER] Stopping load balancers")
 
-				// Stop all load balancers associated with the VIP
-				err := VipLB.StopAll()
-				if err != nil {
-					log.Warnf("%v", err)
-				}
+				// Stop monitoring for address conflicts and any ARP broadcasts
+				cancel()
 
 				// Stop all load balancers associated with the Host
-				err = nonVipLB.StopAll()
+				err := nonVipLB.StopAll()
 				if err != nil {
 					log.Warnf("%v", err)
 				}
@@ -88,7 +110,12 @@ func (cluster *Cluster) StartSingleNode(c *kubevip.Config, disableVIP bool) erro
 				if !disableVIP {
 
 					log.Info("[VIP] Releasing the Virtual IP")
-					err = cluster.network.DeleteIP()
+					// The release hooks are only run if this node was holding the VIP
+					holding, _ := cluster.network.IsSet()
+					cluster.releaseVIP(c, &VipLB, holding, nil)
+				} else {
+					// Stop all load balancers associated with the VIP
+					err = VipLB.StopAll()
 					if err != nil {
 						log.Warnf("%v", err)
 					}
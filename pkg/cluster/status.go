@@ -0,0 +1,142 @@
+package cluster
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/plunder-app/kube-vip/pkg/loadbalancer"
+)
+
+// The modes a cluster can be running in
+const (
+	ModeSingleNode     = "singleNode"
+	ModeRaft           = "raft"
+	ModeLeaderElection = "leaderElection"
+)
+
+// statusDialTimeout is how long the status waits when checking a peer is reachable
+const statusDialTimeout = 500 * time.Millisecond
+
+// Status - the state of this node within the cluster, as returned by the admin API
+type Status struct {
+	Mode          string                `json:"mode"`
+	ID            string                `json:"id"`
+	Leader        string                `json:"leader"`
+	IsLeader      bool                  `json:"isLeader"`
+	Maintenance   bool                  `json:"maintenance"`
+	Term          uint64                `json:"term,omitempty"`
+	LastIndex     uint64                `json:"lastIndex,omitempty"`
+	CommitIndex   uint64                `json:"commitIndex,omitempty"`
+	AppliedIndex  uint64                `json:"appliedIndex,omitempty"`
+	Peers         []PeerStatus          `json:"peers,omitempty"`
+	VIP           string                `json:"vip"`
+	Interface     string                `json:"interface"`
+	HoldsVIP      bool                  `json:"holdsVIP"`
+	LoadBalancers []loadbalancer.Status `json:"loadBalancers"`
+}
+
+// PeerStatus - the state of a Raft peer, as seen by this node
+type PeerStatus struct {
+	ID        string `json:"id"`
+	Address   string `json:"address"`
+	Suffrage  string `json:"suffrage"`
+	Leader    bool   `json:"leader"`
+	Reachable bool   `json:"reachable"`
+}
+
+// setStatus records the mode of the cluster and its load balancers, so that they can be reported by the admin API
+func (cluster *Cluster) setStatus(mode, id string, raftServer *raft.Raft, vipLB, nonVipLB *loadbalancer.LBManager) {
+	cluster.mux.Lock()
+	defer cluster.mux.Unlock()
+	cluster.mode = mode
+	cluster.id = id
+	cluster.raft = raftServer
+	cluster.vipLB = vipLB
+	cluster.nonVipLB = nonVipLB
+}
+
+// setLeader records the identity of the current leader
+func (cluster *Cluster) setLeader(id string) {
+	cluster.mux.Lock()
+	cluster.leader = id
+	cluster.mux.Unlock()
+}
+
+// Status - returns the current state of this node within the cluster
+func (cluster *Cluster) Status() *Status {
+	cluster.mux.Lock()
+	status := &Status{
+		Mode:          cluster.mode,
+		ID:            cluster.id,
+		Leader:        cluster.leader,
+		Maintenance:   cluster.maintenance,
+		LoadBalancers: []loadbalancer.Status{},
+	}
+	raftServer := cluster.raft
+	vipLB, nonVipLB := cluster.vipLB, cluster.nonVipLB
+	cluster.mux.Unlock()
+
+	if cluster.network != nil {
+		status.VIP = cluster.network.IP()
+		status.Interface = cluster.network.Interface()
+		set, err := cluster.network.IsSet()
+		if err != nil {
+			log.Warnf("%v", err)
+		}
+		status.HoldsVIP = set
+	}
+
+	if raftServer != nil {
+		cluster.raftStatus(raftServer, status)
+	}
+	status.IsLeader = status.Leader != "" && status.Leader == status.ID
+
+	for _, lm := range []*loadbalancer.LBManager{vipLB, nonVipLB} {
+		if lm != nil {
+			status.LoadBalancers = append(status.LoadBalancers, lm.Status()...)
+		}
+	}
+	return status
+}
+
+// raftStatus adds the Raft term, indexes and peers to the status
+func (cluster *Cluster) raftStatus(raftServer *raft.Raft, status *Status) {
+	stats := raftServer.Stats()
+	status.Term, _ = strconv.ParseUint(stats["term"], 10, 64)
+	status.LastIndex, _ = strconv.ParseUint(stats["last_log_index"], 10, 64)
+	status.CommitIndex, _ = strconv.ParseUint(stats["commit_index"], 10, 64)
+	status.AppliedIndex, _ = strconv.ParseUint(stats["applied_index"], 10, 64)
+
+	leader := raftServer.Leader()
+	status.Leader = ""
+
+	future := raftServer.GetConfiguration()
+	if err := future.Error(); err != nil {
+		log.Warnf("Unable to read the Raft configuration -> error [%v]", err)
+		return
+	}
+	for _, server := range future.Configuration().Servers {
+		peer := PeerStatus{
+			ID:       string(server.ID),
+			Address:  string(server.Address),
+			Suffrage: server.Suffrage.String(),
+			Leader:   server.Address == leader,
+		}
+		if peer.Leader {
+			status.Leader = peer.ID
+		}
+
+		if peer.ID == status.ID {
+			peer.Reachable = true
+		} else {
+			conn, err := net.DialTimeout("tcp", peer.Address, statusDialTimeout)
+			if err == nil {
+				peer.Reachable = true
+				conn.Close()
+			}
+		}
+		status.Peers = append(status.Peers, peer)
+	}
+}
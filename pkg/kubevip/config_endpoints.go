@@ -1,13 +1,20 @@
 package kubevip
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"net/url"
 	"strconv"
+	"sync"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/plunder-app/kube-vip/pkg/logging"
+	"github.com/sirupsen/logrus"
 )
 
+// The logger of the load balancer backends
+var lbLog = logging.Logger(logging.LoadBalancer)
+
 func init() {
 	// Start the index negative as it will be incrememnted of first approach
 	endPointIndex = -1
@@ -20,7 +27,7 @@ func ValidateBackEndURLS(endpoints *[]BackEnd) error {
 	}
 
 	for i := range *endpoints {
-		log.Debugf("Parsing [%s]", (*endpoints)[i].RawURL)
+		lbLog.Debugf("Parsing [%s]", (*endpoints)[i].RawURL)
 		u, err := url.Parse((*endpoints)[i].RawURL)
 		if err != nil {
 			return err
@@ -45,99 +52,117 @@ func ValidateBackEndURLS(endpoints *[]BackEnd) error {
 	return nil
 }
 
-// ReturnEndpointAddr - returns an endpoint
-func (lb LoadBalancer) ReturnEndpointAddr(backendIndex *int) (*BackEnd, string, error) {
-	if len(lb.Backends) == 0 {
+// CurrentBackends - returns the backends of the load balancer, which mustn't be appended to or replaced in place
+func (lb *LoadBalancer) CurrentBackends() []BackEnd {
+	lb.backendsMux.RLock()
+	defer lb.backendsMux.RUnlock()
+	return lb.Backends
+}
+
+// SetBackends - replaces the backends of the load balancer
+func (lb *LoadBalancer) SetBackends(backends []BackEnd) {
+	lb.backendsMux.Lock()
+	defer lb.backendsMux.Unlock()
+	lb.Backends = backends
+}
+
+// ErrNoAliveBackends - is returned when every backend of a load balancer is down
+var ErrNoAliveBackends = errors.New("No Backends are alive")
+
+// ReturnEndpointAddr - returns an endpoint, the backends that are down are skipped rather than brought back up
+func (lb *LoadBalancer) ReturnEndpointAddr(backendIndex *int) (*BackEnd, string, error) {
+	backends := lb.CurrentBackends()
+	if len(backends) == 0 {
 		return nil, "", fmt.Errorf("No Backends configured")
 	}
 	if backendIndex == nil {
-		log.Warnf("[%s] give nil index, will use global index [%d]", lb.Name, endPointIndex)
+		lbLog.Warnf("[%s] give nil index, will use global index [%d]", lb.Name, endPointIndex)
 		backendIndex = &endPointIndex
 	}
-	if *backendIndex < len(lb.Backends)-1 {
-		*backendIndex++
-	} else {
-		// reset the index to the beginning
-		*backendIndex = 0
-	}
-	log.Debugf("[%s] select index [%d]", lb.Name, *backendIndex)
-	// TODO - weighting, decision algorythmn
-	if lb.Backends[*backendIndex].IsAlive() {
-		endpoint := fmt.Sprintf("%s:%d", lb.Backends[*backendIndex].Address, lb.Backends[*backendIndex].Port)
-		log.Debugf("[%s] return endpoint [%s]", lb.Name, endpoint)
-		return &lb.Backends[*backendIndex], endpoint, nil
-	} else {
-		allDown := true
-		for x := range lb.Backends {
-			if lb.Backends[x].IsAlive() {
-				allDown = false
-				break
-			}
+	// Each backend is tried once
+	for range backends {
+		if *backendIndex < len(backends)-1 {
+			*backendIndex++
+		} else {
+			// reset the index to the beginning
+			*backendIndex = 0
 		}
-		if allDown {
-			errMsg := fmt.Sprintf("[%s] have no alive backend, refresh alive with true for all backend", lb.Name)
-			log.Debugf(errMsg)
-			for x := range lb.Backends {
-				lb.Backends[x].SetAlive(&lb, true)
-			}
-			return lb.ReturnEndpointAddr(backendIndex)
+		lbLog.Debugf("[%s] select index [%d]", lb.Name, *backendIndex)
+		// TODO - weighting, decision algorythmn
+		if backends[*backendIndex].IsAlive() {
+			endpoint := net.JoinHostPort(backends[*backendIndex].Address, strconv.Itoa(backends[*backendIndex].Port))
+			lbLog.Debugf("[%s] return endpoint [%s]", lb.Name, endpoint)
+			return &backends[*backendIndex], endpoint, nil
 		}
 	}
-	return lb.ReturnEndpointAddr(backendIndex)
+	lbLog.Debugf("[%s] have no alive backend", lb.Name)
+	return nil, "", ErrNoAliveBackends
 }
 
-// ReturnEndpointURL - returns an endpoint
-func (lb LoadBalancer) ReturnEndpointURL(backendIndex *int) (*BackEnd, string, *url.URL, error) {
-	if len(lb.Backends) == 0 {
+// ReturnEndpointURL - returns an endpoint, the backends that are down are skipped rather than brought back up
+func (lb *LoadBalancer) ReturnEndpointURL(backendIndex *int) (*BackEnd, string, *url.URL, error) {
+	backends := lb.CurrentBackends()
+	if len(backends) == 0 {
 		return nil, "", nil, fmt.Errorf("No Backends configured")
 	}
 	if backendIndex == nil {
-		log.Warnf("[%s] give nil index, will use global index [%d]", lb.Name, endPointIndex)
+		lbLog.Warnf("[%s] give nil index, will use global index [%d]", lb.Name, endPointIndex)
 		backendIndex = &endPointIndex
 	}
-	if *backendIndex != len(lb.Backends)-1 {
-		*backendIndex++
-	} else {
-		// reset the index to the beginning
-		*backendIndex = 0
-	}
-	log.Debugf("[%s] select index [%d]", lb.Name, *backendIndex)
-	// TODO - weighting, decision algorythmn
-	if lb.Backends[ *backendIndex].IsAlive() {
-		endpoint := fmt.Sprintf("%s:%d", lb.Backends[ *backendIndex].Address, lb.Backends[ *backendIndex].Port)
-		log.Debugf("[%s] return endpoint [%s]", lb.Name, endpoint)
-		return &lb.Backends[ *backendIndex], endpoint, lb.Backends[ *backendIndex].ParsedURL, nil
-	} else  {
-		allDown := true
-		for x := range lb.Backends {
-			if lb.Backends[x].IsAlive() {
-				allDown = false
-				break
-			}
+	// Each backend is tried once
+	for range backends {
+		if *backendIndex < len(backends)-1 {
+			*backendIndex++
+		} else {
+			// reset the index to the beginning
+			*backendIndex = 0
 		}
-		if allDown {
-			errMsg := fmt.Sprintf("[%s] have no alive backend, refresh alive with true for all backend", lb.Name)
-			log.Debugf(errMsg)
-			for x := range lb.Backends {
-				lb.Backends[x].SetAlive(&lb, true)
-			}
-			return lb.ReturnEndpointURL(backendIndex)
+		lbLog.Debugf("[%s] select index [%d]", lb.Name, *backendIndex)
+		// TODO - weighting, decision algorythmn
+		if backends[*backendIndex].IsAlive() {
+			endpoint := net.JoinHostPort(backends[*backendIndex].Address, strconv.Itoa(backends[*backendIndex].Port))
+			lbLog.Debugf("[%s] return endpoint [%s]", lb.Name, endpoint)
+			return &backends[*backendIndex], endpoint, backends[*backendIndex].ParsedURL, nil
 		}
 	}
-	return lb.ReturnEndpointURL(backendIndex)
+	lbLog.Debugf("[%s] have no alive backend", lb.Name)
+	return nil, "", nil, ErrNoAliveBackends
+}
+
+// backendStateChanged - if set, is called whenever a backend changes between up and down
+var backendStateChanged func(lb *LoadBalancer, b *BackEnd, alive bool)
+var backendStateMux sync.RWMutex
+
+// SetBackendStateChanged - sets the function called whenever a backend changes between up and down, nil stops it
+// being called
+func SetBackendStateChanged(changed func(lb *LoadBalancer, b *BackEnd, alive bool)) {
+	backendStateMux.Lock()
+	defer backendStateMux.Unlock()
+	backendStateChanged = changed
 }
 
 // SetAlive - set backend alive
 func (b *BackEnd) SetAlive(lb *LoadBalancer, alive bool) {
-	fullAddress := fmt.Sprintf("%s:%d", b.Address, b.Port)
+	fullAddress := net.JoinHostPort(b.Address, strconv.Itoa(b.Port))
 	b.mux.Lock()
+	changed := b.Alive != alive
 	b.Alive = alive
 	if alive {
-		log.Debugf("[%s] backend [%s] status [up]", lb.Name, fullAddress)
+		lbLog.WithFields(logrus.Fields{"lb": lb.Name, "backend": fullAddress}).Debugf("[%s] backend [%s] status [up]", lb.Name, fullAddress)
 	} else {
-		log.Warnf("[%s] backend [%s] status [down]", lb.Name, fullAddress)
+		lbLog.WithFields(logrus.Fields{"lb": lb.Name, "backend": fullAddress}).Warnf("[%s] backend [%s] status [down]", lb.Name, fullAddress)
 	}
 	b.mux.Unlock()
+
+	if !changed {
+		return
+	}
+	backendStateMux.RLock()
+	notify := backendStateChanged
+	backendStateMux.RUnlock()
+	if notify != nil {
+		notify(lb, b, alive)
+	}
 }
 
 // IsAlive - return backend alive
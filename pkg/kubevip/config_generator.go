@@ -2,6 +2,7 @@ package kubevip
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -9,6 +10,7 @@ import (
 	"github.com/ghodss/yaml"
 	appv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // Environment variables
@@ -17,12 +19,66 @@ const (
 	//vipArp - defines if the arp broadcast should be enabled
 	vipArp = "vip_arp"
 
+	//vipArpBurstCount - defines the number of gratuitous arp packets sent on takeover
+	vipArpBurstCount = "vip_arpburstcount"
+
+	//vipArpBurstInterval - defines the milliseconds between the gratuitous arp packets sent on takeover
+	vipArpBurstInterval = "vip_arpburstinterval"
+
+	//vipArpRefreshInterval - defines the seconds between gratuitous arp packets once the burst is sent
+	vipArpRefreshInterval = "vip_arprefreshinterval"
+
+	//vipArpOperation - defines the type of gratuitous arp packet (reply/request/both)
+	vipArpOperation = "vip_arpoperation"
+
+	//vipArpInterfaces - defines additional interfaces to send gratuitous arp on (comma seperated)
+	vipArpInterfaces = "vip_arpinterfaces"
+
+	//vipDetectConflicts - defines if the network should be checked for other hosts using the vip
+	vipDetectConflicts = "vip_detectconflicts"
+
+	//vipRefuseOnConflict - defines if leadership should be refused when another host is using the vip
+	vipRefuseOnConflict = "vip_refuseonconflict"
+
+	//vipEvents - defines if kubernetes events should be recorded for vip transitions
+	vipEvents = "vip_events"
+
+	//vipHealthGates - defines local health gates (comma seperated URLs) that must pass to hold the vip
+	vipHealthGates = "vip_healthgates"
+
+	//vipHealthGatesInsecure - defines if the certificates of https health gates are not verified
+	vipHealthGatesInsecure = "vip_healthgatesinsecure"
+
+	//vipHooks - defines hooks (comma seperated event=URL) run when the vip is acquired or released
+	vipHooks = "vip_hooks"
+
 	//vipLeaderElection - defines if the kubernetes algorithim should be used
 	vipLeaderElection = "vip_leaderelection"
 
 	//vipLogLevel - defines the level of logging to produce (5 being the most verbose)
 	vipLogLevel = "vip_loglevel"
 
+	//vipLeaseName - defines the name of the lock used by leader election
+	vipLeaseName = "vip_leasename"
+
+	//vipLeaseNamespace - defines the namespace of the lock used by leader election
+	vipLeaseNamespace = "vip_leasenamespace"
+
+	//vipLeaseLockType - defines the type of resource used as the lock (leases/configmaps/endpoints)
+	vipLeaseLockType = "vip_leaselocktype"
+
+	//vipLeaseDuration - defines the seconds followers wait before taking an un-renewed lock
+	vipLeaseDuration = "vip_leaseduration"
+
+	//vipRenewDeadline - defines the seconds the leader retries renewing the lock before giving it up
+	vipRenewDeadline = "vip_renewdeadline"
+
+	//vipRetryPeriod - defines the seconds between attempts to acquire or renew the lock
+	vipRetryPeriod = "vip_retryperiod"
+
+	//vipAPIServers - defines the api server endpoints used for leader election (comma seperated)
+	vipAPIServers = "vip_apiservers"
+
 	//vipInterface - defines the interface that the vip should bind too
 	vipInterface = "vip_interface"
 
@@ -35,6 +91,15 @@ const (
 	//vipStartLeader - will start this instance as the leader of the cluster
 	vipStartLeader = "vip_startleader"
 
+	//vipPriority - defines the priority of this node to hold the vip
+	vipPriority = "vip_priority"
+
+	//vipPreemptDelay - defines the seconds a higher priority node waits before taking leadership
+	vipPreemptDelay = "vip_preemptdelay"
+
+	//vipNoPreempt - defines that leadership should stay with the current leader
+	vipNoPreempt = "vip_nopreempt"
+
 	//vipPeers defines the configuration of raft peer(s)
 	vipPeers = "vip_peers"
 
@@ -44,6 +109,21 @@ const (
 	//vipRemotePeers defines the configuration of the local raft peer
 	vipRemotePeers = "vip_remotepeers"
 
+	//vipRaftTLS defines that the raft transport will use mutual TLS
+	vipRaftTLS = "vip_rafttls"
+
+	//vipRaftTLSCA defines the path to the CA used to verify raft peers
+	vipRaftTLSCA = "vip_rafttlsca"
+
+	//vipRaftTLSCert defines the path to the certificate of this raft peer
+	vipRaftTLSCert = "vip_rafttlscert"
+
+	//vipRaftTLSKey defines the path to the private key of this raft peer
+	vipRaftTLSKey = "vip_rafttlskey"
+
+	//vipAdminAddress defines the local address of the admin API
+	vipAdminAddress = "vip_adminaddress"
+
 	//vipAddPeersToLB defines that RAFT peers should be added to the load-balancer
 	vipAddPeersToLB = "vip_addpeerstolb"
 
@@ -62,6 +142,12 @@ const (
 	//lbEnableProxyProtocol defines if enable send proxy protocol data to backends
 	lbEnableProxyProtocol = "lb_enableproxyprotocol"
 
+	//lbListeners defines the number of listeners sharing the load-balancer port
+	lbListeners = "lb_listeners"
+
+	//lbFreeBind defines if the load-balancer can bind to an address that isn't present yet
+	lbFreeBind = "lb_freebind"
+
 	//lbName defines the name of load-balancer
 	lbName = "lb_name"
 
@@ -77,6 +163,120 @@ const (
 	//lbBackends defines the backends of load-balancer
 	lbBackends = "lb_backends"
 
+	//lbDNSBackends defines the hostnames and SRV names resolved into backends (comma seperated)
+	lbDNSBackends = "lb_dnsbackends"
+
+	//lbDNSRefresh defines the seconds between resolving the DNS backends (default the TTL of the answers)
+	lbDNSRefresh = "lb_dnsrefresh"
+
+	//lbAccessLog defines the path access logs of the load-balancer are written to (or stdout)
+	lbAccessLog = "lb_accesslog"
+
+	//lbAccessLogFields defines the fields written to the access log (comma seperated)
+	lbAccessLogFields = "lb_accesslogfields"
+
+	//lbAccessLogSampleRate defines the fraction of connections written to the access log
+	lbAccessLogSampleRate = "lb_accesslogsamplerate"
+
+	//lbMaxConnections defines the maximum concurrent connections to the load-balancer
+	lbMaxConnections = "lb_maxconnections"
+
+	//lbMaxClientConnections defines the maximum concurrent connections to the load-balancer from a single client
+	lbMaxClientConnections = "lb_maxclientconnections"
+
+	//lbConnectionRate defines the new connections per second accepted by the load-balancer
+	lbConnectionRate = "lb_connectionrate"
+
+	//lbClientConnectionRate defines the new connections per second accepted by the load-balancer from a single client
+	lbClientConnectionRate = "lb_clientconnectionrate"
+
+	//lbConnectionBurst defines the new connections accepted at once above the connection rates
+	lbConnectionBurst = "lb_connectionburst"
+
+	//lbConnectTimeout defines the milliseconds to wait when connecting to a backend
+	lbConnectTimeout = "lb_connecttimeout"
+
+	//lbIdleTimeout defines the seconds a connection can go without data before it is closed
+	lbIdleTimeout = "lb_idletimeout"
+
+	//lbTotalTimeout defines the seconds after which a connection is closed
+	lbTotalTimeout = "lb_totaltimeout"
+
+	//lbKeepAlive defines the seconds between TCP keepalive probes (negative disables)
+	lbKeepAlive = "lb_keepalive"
+
+	//lbAffinity defines the session affinity of the load-balancer (sourceIP, cookie or header)
+	lbAffinity = "lb_affinity"
+
+	//lbAffinityTTL defines the seconds a client stays pinned to a backend (or the max age of the cookie)
+	lbAffinityTTL = "lb_affinityttl"
+
+	//lbAffinityCookie defines the name of the session affinity cookie
+	lbAffinityCookie = "lb_affinitycookie"
+
+	//lbAffinityHeader defines the request header used for session affinity
+	lbAffinityHeader = "lb_affinityheader"
+
+	//lbUpstreamCA defines the path to the CAs that sign the backend certificates
+	lbUpstreamCA = "lb_upstreamca"
+
+	//lbUpstreamCert defines the path to the client certificate presented to the backends
+	lbUpstreamCert = "lb_upstreamcert"
+
+	//lbUpstreamKey defines the path to the private key of the client certificate
+	lbUpstreamKey = "lb_upstreamkey"
+
+	//lbUpstreamServerName defines the server name sent to and verified against the backends
+	lbUpstreamServerName = "lb_upstreamservername"
+
+	//lbUpstreamVerify defines how the backend certificates are verified
+	lbUpstreamVerify = "lb_upstreamverify"
+
+	//lbOutlierConsecutiveFailures defines the failures in a row that eject a backend
+	lbOutlierConsecutiveFailures = "lb_outlierconsecutivefailures"
+
+	//lbOutlierFailureRate defines the percentage of failures within an interval that eject a backend
+	lbOutlierFailureRate = "lb_outlierfailurerate"
+
+	//lbOutlierMinimumRequests defines the connections within an interval before the failure rate is judged
+	lbOutlierMinimumRequests = "lb_outlierminimumrequests"
+
+	//lbOutlierInterval defines the seconds the failure rate is measured over
+	lbOutlierInterval = "lb_outlierinterval"
+
+	//lbOutlierBaseEjectionTime defines the seconds of the first ejection of a backend
+	lbOutlierBaseEjectionTime = "lb_outlierbaseejectiontime"
+
+	//lbOutlierMaxEjectionTime defines the most seconds a backend is ejected for
+	lbOutlierMaxEjectionTime = "lb_outliermaxejectiontime"
+
+	//lbOutlierMaxEjectionPercent defines the most of the backends that can be ejected at once
+	lbOutlierMaxEjectionPercent = "lb_outliermaxejectionpercent"
+
+	//lbSlowStart defines the seconds a returning backend is ramped up over
+	lbSlowStart = "lb_slowstart"
+
+	//lbBackendMaxConnections defines the most connections a backend is sent at once
+	lbBackendMaxConnections = "lb_backendmaxconnections"
+
+	//lbAllowedSources defines the CIDRs clients of the load-balancer must connect from (comma seperated)
+	lbAllowedSources = "lb_allowedsources"
+
+	//lbDeniedSources defines the CIDRs clients of the load-balancer can't connect from (comma seperated)
+	lbDeniedSources = "lb_deniedsources"
+
+	//lbAcceptProxyProtocol defines if the client address is taken from an incoming proxy protocol header
+	lbAcceptProxyProtocol = "lb_acceptproxyprotocol"
+
+	//lbProxyProtocolTrustedSources defines the CIDRs of the proxies that may send a proxy protocol header (comma seperated)
+	lbProxyProtocolTrustedSources = "lb_proxyprotocoltrustedsources"
+
+	//lbProxyProtocolVersion defines the version of the proxy protocol header sent to backends
+	lbProxyProtocolVersion = "lb_proxyprotocolversion"
+
+	//lbProxyProtocolTLVs defines if the TLVs of an incoming proxy protocol header are sent to backends
+	lbProxyProtocolTLVs = "lb_proxyprotocoltlvs"
+
 	//vipConfigMap defines the configmap that kube-vip will watch for service definitions
 	vipConfigMap = "vip_configmap"
 )
@@ -100,6 +300,18 @@ func ParseEnvironment(c *Config) error {
 		c.EnableLeaderElection = b
 	}
 
+	// Find the leader election lock settings
+	err := ParseEnvironmentLeaderElection(&c.LeaderElection)
+	if err != nil {
+		return err
+	}
+
+	// Find API server endpoints (comma seperated)
+	env = os.Getenv(vipAPIServers)
+	if env != "" {
+		c.APIServers = strings.Split(env, ",")
+	}
+
 	// Find vip address
 	env = os.Getenv(vipAddress)
 	if env != "" {
@@ -129,6 +341,36 @@ func ParseEnvironment(c *Config) error {
 		c.StartAsLeader = b
 	}
 
+	// Find Priority
+	env = os.Getenv(vipPriority)
+	if env != "" {
+		i, err := strconv.Atoi(env)
+		if err != nil {
+			return err
+		}
+		c.Priority = i
+	}
+
+	// Find Preempt Delay
+	env = os.Getenv(vipPreemptDelay)
+	if env != "" {
+		i, err := strconv.Atoi(env)
+		if err != nil {
+			return err
+		}
+		c.PreemptDelay = i
+	}
+
+	// Find No Preempt
+	env = os.Getenv(vipNoPreempt)
+	if env != "" {
+		b, err := strconv.ParseBool(env)
+		if err != nil {
+			return err
+		}
+		c.NoPreempt = b
+	}
+
 	// Find ARP
 	env = os.Getenv(vipArp)
 	if env != "" {
@@ -139,10 +381,85 @@ func ParseEnvironment(c *Config) error {
 		c.GratuitousARP = b
 	}
 
+	// Find ARP burst count
+	env = os.Getenv(vipArpBurstCount)
+	if env != "" {
+		i, err := strconv.Atoi(env)
+		if err != nil {
+			return err
+		}
+		c.ARPBurstCount = i
+	}
+
+	// Find ARP burst interval
+	env = os.Getenv(vipArpBurstInterval)
+	if env != "" {
+		i, err := strconv.Atoi(env)
+		if err != nil {
+			return err
+		}
+		c.ARPBurstInterval = i
+	}
+
+	// Find ARP refresh interval
+	env = os.Getenv(vipArpRefreshInterval)
+	if env != "" {
+		i, err := strconv.Atoi(env)
+		if err != nil {
+			return err
+		}
+		c.ARPRefreshInterval = i
+	}
+
+	// Find ARP operation
+	env = os.Getenv(vipArpOperation)
+	if env != "" {
+		if err := ValidateARPOperation(env); err != nil {
+			return err
+		}
+		c.ARPOperation = env
+	}
+
+	// Find additional ARP interfaces (comma seperated)
+	env = os.Getenv(vipArpInterfaces)
+	if env != "" {
+		c.ARPInterfaces = strings.Split(env, ",")
+	}
+
+	// Find Conflict Detection
+	env = os.Getenv(vipDetectConflicts)
+	if env != "" {
+		b, err := strconv.ParseBool(env)
+		if err != nil {
+			return err
+		}
+		c.DetectConflicts = b
+	}
+
+	// Find Events
+	env = os.Getenv(vipEvents)
+	if env != "" {
+		b, err := strconv.ParseBool(env)
+		if err != nil {
+			return err
+		}
+		c.EnableEvents = b
+	}
+
+	// Find Refuse on Conflict
+	env = os.Getenv(vipRefuseOnConflict)
+	if env != "" {
+		b, err := strconv.ParseBool(env)
+		if err != nil {
+			return err
+		}
+		c.RefuseOnConflict = b
+	}
+
 	//Removal of seperate peer
 	env = os.Getenv(vipLocalPeer)
 	if env != "" {
-		// Parse the string in format <id>:<address>:<port>
+		// Parse the string in format <id>:<address>:<port>[:<priority>]
 		peer, err := ParsePeerConfig(env)
 		if err != nil {
 			return err
@@ -159,10 +476,10 @@ func ParseEnvironment(c *Config) error {
 		// Parse the remote peers (comma seperated)
 		s := strings.Split(env, ",")
 		if len(s) == 0 {
-			return fmt.Errorf("The Remote Peer List [%s] is unable to be parsed, should be in comma seperated format <id>:<address>:<port>", env)
+			return fmt.Errorf("The Remote Peer List [%s] is unable to be parsed, should be in comma seperated format <id>:<address>:<port>[:<priority>]", env)
 		}
 		for x := range s {
-			// Parse the each remote peer string in format <id>:<address>:<port>
+			// Parse the each remote peer string in format <id>:<address>:<port>[:<priority>]
 			peer, err := ParsePeerConfig(s[x])
 			if err != nil {
 				return err
@@ -173,6 +490,70 @@ func ParseEnvironment(c *Config) error {
 		}
 	}
 
+	// Find Health Gates
+	env = os.Getenv(vipHealthGates)
+	if env != "" {
+		// Remove existing health gates
+		c.HealthGates = []HealthGate{}
+
+		var insecure bool
+		if e := os.Getenv(vipHealthGatesInsecure); e != "" {
+			b, err := strconv.ParseBool(e)
+			if err != nil {
+				return err
+			}
+			insecure = b
+		}
+		if err := c.ParseHealthGates(strings.Split(env, ","), insecure); err != nil {
+			return err
+		}
+	}
+
+	// Find Hooks
+	env = os.Getenv(vipHooks)
+	if env != "" {
+		// Remove existing hooks
+		c.Hooks = []Hook{}
+
+		for _, h := range strings.Split(env, ",") {
+			hook, err := ParseHook(h)
+			if err != nil {
+				return err
+			}
+			c.Hooks = append(c.Hooks, *hook)
+		}
+	}
+
+	// Find Raft TLS
+	env = os.Getenv(vipRaftTLS)
+	if env != "" {
+		b, err := strconv.ParseBool(env)
+		if err != nil {
+			return err
+		}
+		c.EnableRaftTLS = b
+	}
+
+	// Find the Raft TLS CA, certificate and key
+	env = os.Getenv(vipRaftTLSCA)
+	if env != "" {
+		c.RaftTLSCA = env
+	}
+	env = os.Getenv(vipRaftTLSCert)
+	if env != "" {
+		c.RaftTLSCert = env
+	}
+	env = os.Getenv(vipRaftTLSKey)
+	if env != "" {
+		c.RaftTLSKey = env
+	}
+
+	// Find the admin API address
+	env = os.Getenv(vipAdminAddress)
+	if env != "" {
+		c.AdminAddress = env
+	}
+
 	// Find Add Peers as Backends
 
 	env = os.Getenv(vipAddPeersToLB)
@@ -215,6 +596,60 @@ func ParseEnvironment(c *Config) error {
 	return parseEnvironmentLoadBalancer(c)
 }
 
+// ParseEnvironmentLeaderElection - will populate the leader election lock from environment variables
+func ParseEnvironmentLeaderElection(le *LeaderElection) error {
+
+	// Find the lease name
+	env := os.Getenv(vipLeaseName)
+	if env != "" {
+		le.LeaseName = env
+	}
+
+	// Find the lease namespace
+	env = os.Getenv(vipLeaseNamespace)
+	if env != "" {
+		le.LeaseNamespace = env
+	}
+
+	// Find the lease lock type
+	env = os.Getenv(vipLeaseLockType)
+	if env != "" {
+		le.LeaseLockType = env
+	}
+
+	// Find the lease duration
+	env = os.Getenv(vipLeaseDuration)
+	if env != "" {
+		i, err := strconv.Atoi(env)
+		if err != nil {
+			return err
+		}
+		le.LeaseDuration = i
+	}
+
+	// Find the renew deadline
+	env = os.Getenv(vipRenewDeadline)
+	if env != "" {
+		i, err := strconv.Atoi(env)
+		if err != nil {
+			return err
+		}
+		le.RenewDeadline = i
+	}
+
+	// Find the retry period
+	env = os.Getenv(vipRetryPeriod)
+	if env != "" {
+		i, err := strconv.Atoi(env)
+		if err != nil {
+			return err
+		}
+		le.RetryPeriod = i
+	}
+
+	return le.Validate()
+}
+
 func parseEnvironmentLoadBalancer(c *Config) error {
 	// Check if an existing load-balancer configuration already exists
 	if len(c.LoadBalancers) == 0 {
@@ -253,6 +688,28 @@ func parseEnvironmentLoadBalancer(c *Config) error {
 		c.LoadBalancers[0].BindToVip = b
 	}
 
+	// Find the number of listeners and if the LB can bind before its address is present
+	env = os.Getenv(lbListeners)
+	if env != "" {
+		i, err := strconv.Atoi(env)
+		if err != nil {
+			return err
+		}
+		if i < 0 {
+			return fmt.Errorf("The number of listeners [%d] can't be negative", i)
+		}
+		c.LoadBalancers[0].Listeners = i
+	}
+
+	env = os.Getenv(lbFreeBind)
+	if env != "" {
+		b, err := strconv.ParseBool(env)
+		if err != nil {
+			return err
+		}
+		c.LoadBalancers[0].FreeBind = b
+	}
+
 	// Find If enable send proxy protocol data to backends
 	env = os.Getenv(lbEnableProxyProtocol)
 	if env != "" {
@@ -293,13 +750,276 @@ func parseEnvironmentLoadBalancer(c *Config) error {
 				return err
 			}
 
-			c.LoadBalancers[0].Backends = append(c.LoadBalancers[0].Backends, *be)
+			c.LoadBalancers[0].Backends = append(c.LoadBalancers[0].Backends, BackEnd{Address: be.Address, Port: be.Port})
 
 		}
 	}
+
+	// Parse the DNS backends
+	env = os.Getenv(lbDNSBackends)
+	if env != "" {
+		c.LoadBalancers[0].DNSBackends = []DNSBackend{}
+		for _, name := range strings.Split(env, ",") {
+			d, err := ParseDNSBackend(strings.TrimSpace(name))
+			if err != nil {
+				return err
+			}
+			c.LoadBalancers[0].DNSBackends = append(c.LoadBalancers[0].DNSBackends, *d)
+		}
+	}
+
+	env = os.Getenv(lbDNSRefresh)
+	if env != "" {
+		i, err := strconv.Atoi(env)
+		if err != nil {
+			return err
+		}
+		c.LoadBalancers[0].DNSRefresh = i
+	}
+
+	// Parse access logging
+	env = os.Getenv(lbAccessLog)
+	if env != "" {
+		if c.LoadBalancers[0].AccessLog == nil {
+			c.LoadBalancers[0].AccessLog = &AccessLog{}
+		}
+		c.LoadBalancers[0].AccessLog.Path = env
+	}
+
+	env = os.Getenv(lbAccessLogFields)
+	if env != "" && c.LoadBalancers[0].AccessLog != nil {
+		c.LoadBalancers[0].AccessLog.Fields = strings.Split(env, ",")
+	}
+
+	env = os.Getenv(lbAccessLogSampleRate)
+	if env != "" && c.LoadBalancers[0].AccessLog != nil {
+		f, err := strconv.ParseFloat(env, 64)
+		if err != nil {
+			return err
+		}
+		c.LoadBalancers[0].AccessLog.SampleRate = f
+	}
+
+	if c.LoadBalancers[0].AccessLog != nil {
+		err := c.LoadBalancers[0].AccessLog.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Parse the source allow and deny lists
+	env = os.Getenv(lbAllowedSources)
+	if env != "" {
+		c.LoadBalancers[0].AllowedSources = strings.Split(env, ",")
+	}
+
+	env = os.Getenv(lbDeniedSources)
+	if env != "" {
+		c.LoadBalancers[0].DeniedSources = strings.Split(env, ",")
+	}
+
+	// Find if the client address is taken from proxy protocol headers
+	env = os.Getenv(lbAcceptProxyProtocol)
+	if env != "" {
+		b, err := strconv.ParseBool(env)
+		if err != nil {
+			return err
+		}
+		c.LoadBalancers[0].AcceptProxyProtocol = b
+	}
+
+	env = os.Getenv(lbProxyProtocolTrustedSources)
+	if env != "" {
+		c.LoadBalancers[0].ProxyProtocolTrustedSources = strings.Split(env, ",")
+	}
+
+	// Find the proxy protocol version and if TLVs are passed through to backends
+	env = os.Getenv(lbProxyProtocolVersion)
+	if env != "" {
+		i, err := strconv.ParseInt(env, 10, 32)
+		if err != nil {
+			return err
+		}
+		c.LoadBalancers[0].ProxyProtocolVersion = int(i)
+	}
+
+	env = os.Getenv(lbProxyProtocolTLVs)
+	if env != "" {
+		b, err := strconv.ParseBool(env)
+		if err != nil {
+			return err
+		}
+		c.LoadBalancers[0].ProxyProtocolTLVs = b
+	}
+
+	if err := c.LoadBalancers[0].ValidateProxyProtocol(); err != nil {
+		return err
+	}
+
+	if err := parseEnvironmentConnectionLimits(&c.LoadBalancers[0]); err != nil {
+		return err
+	}
+	if err := parseEnvironmentConnectionTimeouts(&c.LoadBalancers[0]); err != nil {
+		return err
+	}
+
+	// Find the upstream TLS of the load balancer, which is set by any of its variables
+	upstream := &UpstreamTLS{
+		CA:          os.Getenv(lbUpstreamCA),
+		Certificate: os.Getenv(lbUpstreamCert),
+		Key:         os.Getenv(lbUpstreamKey),
+		ServerName:  os.Getenv(lbUpstreamServerName),
+		Verify:      os.Getenv(lbUpstreamVerify),
+	}
+	if *upstream != (UpstreamTLS{}) {
+		if err := upstream.Validate(); err != nil {
+			return err
+		}
+		c.LoadBalancers[0].UpstreamTLS = upstream
+	}
+
+	if err := parseEnvironmentOutlierDetection(&c.LoadBalancers[0]); err != nil {
+		return err
+	}
+
+	// Find the session affinity of the load balancer
+	env = os.Getenv(lbAffinity)
+	if env != "" {
+		affinity := &SessionAffinity{
+			Type:       env,
+			CookieName: os.Getenv(lbAffinityCookie),
+			HeaderName: os.Getenv(lbAffinityHeader),
+		}
+		if ttl := os.Getenv(lbAffinityTTL); ttl != "" {
+			i, err := strconv.Atoi(ttl)
+			if err != nil {
+				return err
+			}
+			affinity.TTL = i
+		}
+		c.LoadBalancers[0].Affinity = affinity
+	}
+	if c.LoadBalancers[0].Affinity != nil {
+		return c.LoadBalancers[0].Affinity.Validate(c.LoadBalancers[0].Type)
+	}
 	return nil
 }
 
+func parseEnvironmentConnectionLimits(lb *LoadBalancer) error {
+	limits := lb.Limits
+	if limits == nil {
+		limits = &ConnectionLimits{}
+	}
+	found := false
+
+	for env, limit := range map[string]*int{
+		lbMaxConnections:       &limits.MaxConnections,
+		lbMaxClientConnections: &limits.MaxClientConnections,
+		lbConnectionBurst:      &limits.ConnectionBurst,
+	} {
+		if v := os.Getenv(env); v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return err
+			}
+			*limit, found = i, true
+		}
+	}
+
+	for env, rate := range map[string]*float64{
+		lbConnectionRate:       &limits.ConnectionRate,
+		lbClientConnectionRate: &limits.ClientConnectionRate,
+	} {
+		if v := os.Getenv(env); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return err
+			}
+			*rate, found = f, true
+		}
+	}
+
+	if found {
+		lb.Limits = limits
+	}
+	if lb.Limits != nil {
+		return lb.Limits.Validate()
+	}
+	return nil
+}
+
+func parseEnvironmentConnectionTimeouts(lb *LoadBalancer) error {
+	timeouts := lb.Timeouts
+	if timeouts == nil {
+		timeouts = &ConnectionTimeouts{}
+	}
+	found := false
+
+	for env, timeout := range map[string]*int{
+		lbConnectTimeout: &timeouts.ConnectTimeout,
+		lbIdleTimeout:    &timeouts.IdleTimeout,
+		lbTotalTimeout:   &timeouts.TotalTimeout,
+		lbKeepAlive:      &timeouts.KeepAlive,
+	} {
+		if v := os.Getenv(env); v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return err
+			}
+			*timeout, found = i, true
+		}
+	}
+
+	if found {
+		lb.Timeouts = timeouts
+	}
+	if lb.Timeouts != nil {
+		return lb.Timeouts.Validate()
+	}
+	return nil
+}
+
+func parseEnvironmentOutlierDetection(lb *LoadBalancer) error {
+	outliers := lb.OutlierDetection
+	if outliers == nil {
+		outliers = &OutlierDetection{}
+	}
+	found := false
+
+	for env, value := range outlierDetectionEnvironment(outliers) {
+		if v := os.Getenv(env); v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return err
+			}
+			*value, found = i, true
+		}
+	}
+
+	if found {
+		lb.OutlierDetection = outliers
+	}
+	if lb.OutlierDetection != nil {
+		return lb.OutlierDetection.Validate()
+	}
+	return nil
+}
+
+// outlierDetectionEnvironment returns the environment variable of each outlier detection setting
+func outlierDetectionEnvironment(o *OutlierDetection) map[string]*int {
+	return map[string]*int{
+		lbOutlierConsecutiveFailures: &o.ConsecutiveFailures,
+		lbOutlierFailureRate:         &o.FailureRate,
+		lbOutlierMinimumRequests:     &o.MinimumRequests,
+		lbOutlierInterval:            &o.Interval,
+		lbOutlierBaseEjectionTime:    &o.BaseEjectionTime,
+		lbOutlierMaxEjectionTime:     &o.MaxEjectionTime,
+		lbOutlierMaxEjectionPercent:  &o.MaxEjectionPercent,
+		lbSlowStart:                  &o.SlowStart,
+		lbBackendMaxConnections:      &o.MaxConnections,
+	}
+}
+
 // GenerateManifestFromConfig will take a kube-vip config and generate a manifest
 func GenerateManifestFromConfig(c *Config, imageVersion string) string {
 
@@ -309,10 +1029,70 @@ func GenerateManifestFromConfig(c *Config, imageVersion string) string {
 			Name:  vipArp,
 			Value: strconv.FormatBool(c.GratuitousARP),
 		},
+		{
+			Name:  vipArpBurstCount,
+			Value: strconv.Itoa(c.ARPBurstCount),
+		},
+		{
+			Name:  vipArpBurstInterval,
+			Value: strconv.Itoa(c.ARPBurstInterval),
+		},
+		{
+			Name:  vipArpRefreshInterval,
+			Value: strconv.Itoa(c.ARPRefreshInterval),
+		},
+		{
+			Name:  vipArpOperation,
+			Value: c.ARPOperation,
+		},
+		{
+			Name:  vipArpInterfaces,
+			Value: strings.Join(c.ARPInterfaces, ","),
+		},
+		{
+			Name:  vipDetectConflicts,
+			Value: strconv.FormatBool(c.DetectConflicts),
+		},
+		{
+			Name:  vipRefuseOnConflict,
+			Value: strconv.FormatBool(c.RefuseOnConflict),
+		},
 		{
 			Name:  vipLeaderElection,
 			Value: strconv.FormatBool(c.EnableLeaderElection),
 		},
+		{
+			Name:  vipEvents,
+			Value: strconv.FormatBool(c.EnableEvents),
+		},
+		{
+			Name:  vipLeaseName,
+			Value: c.LeaderElection.LeaseName,
+		},
+		{
+			Name:  vipLeaseNamespace,
+			Value: c.LeaderElection.LeaseNamespace,
+		},
+		{
+			Name:  vipLeaseLockType,
+			Value: c.LeaderElection.LeaseLockType,
+		},
+		{
+			Name:  vipLeaseDuration,
+			Value: strconv.Itoa(c.LeaderElection.LeaseDuration),
+		},
+		{
+			Name:  vipRenewDeadline,
+			Value: strconv.Itoa(c.LeaderElection.RenewDeadline),
+		},
+		{
+			Name:  vipRetryPeriod,
+			Value: strconv.Itoa(c.LeaderElection.RetryPeriod),
+		},
+		{
+			Name:  vipAPIServers,
+			Value: strings.Join(c.APIServers, ","),
+		},
 		{
 			Name:  vipPacket,
 			Value: strconv.FormatBool(c.EnablePacket),
@@ -337,13 +1117,45 @@ func GenerateManifestFromConfig(c *Config, imageVersion string) string {
 			Name:  vipStartLeader,
 			Value: strconv.FormatBool(c.StartAsLeader),
 		},
+		{
+			Name:  vipPriority,
+			Value: strconv.Itoa(c.Priority),
+		},
+		{
+			Name:  vipPreemptDelay,
+			Value: strconv.Itoa(c.PreemptDelay),
+		},
+		{
+			Name:  vipNoPreempt,
+			Value: strconv.FormatBool(c.NoPreempt),
+		},
+		{
+			Name:  vipRaftTLS,
+			Value: strconv.FormatBool(c.EnableRaftTLS),
+		},
+		{
+			Name:  vipRaftTLSCA,
+			Value: c.RaftTLSCA,
+		},
+		{
+			Name:  vipRaftTLSCert,
+			Value: c.RaftTLSCert,
+		},
+		{
+			Name:  vipRaftTLSKey,
+			Value: c.RaftTLSKey,
+		},
+		{
+			Name:  vipAdminAddress,
+			Value: c.AdminAddress,
+		},
 		{
 			Name:  vipAddPeersToLB,
 			Value: strconv.FormatBool(c.AddPeersAsBackends),
 		},
 		{
 			Name:  vipLocalPeer,
-			Value: fmt.Sprintf("%s:%s:%d", c.LocalPeer.ID, c.LocalPeer.Address, c.LocalPeer.Port),
+			Value: c.LocalPeer.String(),
 		},
 		{
 			Name:  lbEnable,
@@ -371,15 +1183,283 @@ func GenerateManifestFromConfig(c *Config, imageVersion string) string {
 		},
 	}
 
+	// Add the listeners of the load balancer
+	if c.LoadBalancers[0].Listeners != 0 {
+		newEnvironment = append(newEnvironment, appv1.EnvVar{
+			Name:  lbListeners,
+			Value: strconv.Itoa(c.LoadBalancers[0].Listeners),
+		})
+	}
+	if c.LoadBalancers[0].FreeBind {
+		newEnvironment = append(newEnvironment, appv1.EnvVar{
+			Name:  lbFreeBind,
+			Value: strconv.FormatBool(c.LoadBalancers[0].FreeBind),
+		})
+	}
+
+	// Add the access log of the load balancer
+	if c.LoadBalancers[0].AccessLog != nil {
+		accessLog := c.LoadBalancers[0].AccessLog
+		path := accessLog.Path
+		if path == "" {
+			path = "stdout"
+		}
+		newEnvironment = append(newEnvironment, appv1.EnvVar{
+			Name:  lbAccessLog,
+			Value: path,
+		})
+		if len(accessLog.Fields) != 0 {
+			newEnvironment = append(newEnvironment, appv1.EnvVar{
+				Name:  lbAccessLogFields,
+				Value: strings.Join(accessLog.Fields, ","),
+			})
+		}
+		if accessLog.SampleRate != 0 {
+			newEnvironment = append(newEnvironment, appv1.EnvVar{
+				Name:  lbAccessLogSampleRate,
+				Value: strconv.FormatFloat(accessLog.SampleRate, 'g', -1, 64),
+			})
+		}
+	}
+
+	// Add the source allow and deny lists of the load balancer
+	if len(c.LoadBalancers[0].AllowedSources) != 0 {
+		newEnvironment = append(newEnvironment, appv1.EnvVar{
+			Name:  lbAllowedSources,
+			Value: strings.Join(c.LoadBalancers[0].AllowedSources, ","),
+		})
+	}
+	if len(c.LoadBalancers[0].DeniedSources) != 0 {
+		newEnvironment = append(newEnvironment, appv1.EnvVar{
+			Name:  lbDeniedSources,
+			Value: strings.Join(c.LoadBalancers[0].DeniedSources, ","),
+		})
+	}
+	if c.LoadBalancers[0].AcceptProxyProtocol {
+		newEnvironment = append(newEnvironment, appv1.EnvVar{
+			Name:  lbAcceptProxyProtocol,
+			Value: strconv.FormatBool(c.LoadBalancers[0].AcceptProxyProtocol),
+		})
+	}
+	if len(c.LoadBalancers[0].ProxyProtocolTrustedSources) != 0 {
+		newEnvironment = append(newEnvironment, appv1.EnvVar{
+			Name:  lbProxyProtocolTrustedSources,
+			Value: strings.Join(c.LoadBalancers[0].ProxyProtocolTrustedSources, ","),
+		})
+	}
+
+	// Add the proxy protocol sent to backends
+	if c.LoadBalancers[0].ProxyProtocolVersion != 0 {
+		newEnvironment = append(newEnvironment, appv1.EnvVar{
+			Name:  lbProxyProtocolVersion,
+			Value: strconv.Itoa(c.LoadBalancers[0].ProxyProtocolVersion),
+		})
+	}
+	if c.LoadBalancers[0].ProxyProtocolTLVs {
+		newEnvironment = append(newEnvironment, appv1.EnvVar{
+			Name:  lbProxyProtocolTLVs,
+			Value: strconv.FormatBool(c.LoadBalancers[0].ProxyProtocolTLVs),
+		})
+	}
+
+	// Add the DNS backends of the load balancer
+	if len(c.LoadBalancers[0].DNSBackends) != 0 {
+		var names []string
+		for _, d := range c.LoadBalancers[0].DNSBackends {
+			names = append(names, d.String())
+		}
+		newEnvironment = append(newEnvironment, appv1.EnvVar{
+			Name:  lbDNSBackends,
+			Value: strings.Join(names, ","),
+		})
+	}
+	if c.LoadBalancers[0].DNSRefresh != 0 {
+		newEnvironment = append(newEnvironment, appv1.EnvVar{
+			Name:  lbDNSRefresh,
+			Value: strconv.Itoa(c.LoadBalancers[0].DNSRefresh),
+		})
+	}
+
+	// Add the connection limits of the load balancer
+	if limits := c.LoadBalancers[0].Limits; limits != nil {
+		for _, env := range []struct {
+			name  string
+			value string
+			set   bool
+		}{
+			{lbMaxConnections, strconv.Itoa(limits.MaxConnections), limits.MaxConnections != 0},
+			{lbMaxClientConnections, strconv.Itoa(limits.MaxClientConnections), limits.MaxClientConnections != 0},
+			{lbConnectionRate, strconv.FormatFloat(limits.ConnectionRate, 'g', -1, 64), limits.ConnectionRate != 0},
+			{lbClientConnectionRate, strconv.FormatFloat(limits.ClientConnectionRate, 'g', -1, 64), limits.ClientConnectionRate != 0},
+			{lbConnectionBurst, strconv.Itoa(limits.ConnectionBurst), limits.ConnectionBurst != 0},
+		} {
+			if env.set {
+				newEnvironment = append(newEnvironment, appv1.EnvVar{
+					Name:  env.name,
+					Value: env.value,
+				})
+			}
+		}
+	}
+
+	// Add the connection timeouts of the load balancer
+	if timeouts := c.LoadBalancers[0].Timeouts; timeouts != nil {
+		for _, env := range []struct {
+			name  string
+			value int
+		}{
+			{lbConnectTimeout, timeouts.ConnectTimeout},
+			{lbIdleTimeout, timeouts.IdleTimeout},
+			{lbTotalTimeout, timeouts.TotalTimeout},
+			{lbKeepAlive, timeouts.KeepAlive},
+		} {
+			if env.value != 0 {
+				newEnvironment = append(newEnvironment, appv1.EnvVar{
+					Name:  env.name,
+					Value: strconv.Itoa(env.value),
+				})
+			}
+		}
+	}
+
+	// Add the upstream TLS of the load balancer
+	if upstream := c.LoadBalancers[0].UpstreamTLS; upstream != nil {
+		verify := upstream.Verify
+		if verify == "" {
+			verify = TLSVerifyFull
+		}
+		for _, env := range []struct {
+			name  string
+			value string
+		}{
+			{lbUpstreamCA, upstream.CA},
+			{lbUpstreamCert, upstream.Certificate},
+			{lbUpstreamKey, upstream.Key},
+			{lbUpstreamServerName, upstream.ServerName},
+			{lbUpstreamVerify, verify},
+		} {
+			if env.value != "" {
+				newEnvironment = append(newEnvironment, appv1.EnvVar{
+					Name:  env.name,
+					Value: env.value,
+				})
+			}
+		}
+	}
+
+	// Add the outlier detection of the load balancer, which is enabled by any setting
+	if outliers := c.LoadBalancers[0].OutlierDetection; outliers != nil {
+		set := false
+		for _, env := range []string{lbOutlierConsecutiveFailures, lbOutlierFailureRate, lbOutlierMinimumRequests, lbOutlierInterval,
+			lbOutlierBaseEjectionTime, lbOutlierMaxEjectionTime, lbOutlierMaxEjectionPercent, lbBackendMaxConnections, lbSlowStart} {
+			value := *outlierDetectionEnvironment(outliers)[env]
+			if value != 0 || (!set && env == lbSlowStart) {
+				set = true
+				newEnvironment = append(newEnvironment, appv1.EnvVar{
+					Name:  env,
+					Value: strconv.Itoa(value),
+				})
+			}
+		}
+	}
+
+	// Add the session affinity of the load balancer
+	if affinity := c.LoadBalancers[0].Affinity; affinity != nil {
+		newEnvironment = append(newEnvironment, appv1.EnvVar{
+			Name:  lbAffinity,
+			Value: affinity.Type,
+		})
+		for _, env := range []struct {
+			name  string
+			value string
+		}{
+			{lbAffinityCookie, affinity.CookieName},
+			{lbAffinityHeader, affinity.HeaderName},
+		} {
+			if env.value != "" {
+				newEnvironment = append(newEnvironment, appv1.EnvVar{
+					Name:  env.name,
+					Value: env.value,
+				})
+			}
+		}
+		if affinity.TTL != 0 {
+			newEnvironment = append(newEnvironment, appv1.EnvVar{
+				Name:  lbAffinityTTL,
+				Value: strconv.Itoa(affinity.TTL),
+			})
+		}
+	}
+
+	// The pod and node are used as the object of any events
+	newEnvironment = append(newEnvironment,
+		appv1.EnvVar{
+			Name:      "POD_NAME",
+			ValueFrom: &appv1.EnvVarSource{FieldRef: &appv1.ObjectFieldSelector{FieldPath: "metadata.name"}},
+		},
+		appv1.EnvVar{
+			Name:      "POD_NAMESPACE",
+			ValueFrom: &appv1.EnvVarSource{FieldRef: &appv1.ObjectFieldSelector{FieldPath: "metadata.namespace"}},
+		},
+		appv1.EnvVar{
+			Name:      "NODE_NAME",
+			ValueFrom: &appv1.EnvVarSource{FieldRef: &appv1.ObjectFieldSelector{FieldPath: "spec.nodeName"}},
+		},
+	)
+
+	// Parse URL based health gates into a comma seperated string
+	var gates []string
+	var insecureGates bool
+	for x := range c.HealthGates {
+		switch c.HealthGates[x].Type {
+		case "http", "https":
+			gates = append(gates, c.HealthGates[x].Address)
+			insecureGates = insecureGates || c.HealthGates[x].InsecureSkipVerify
+		case "tcp":
+			gates = append(gates, fmt.Sprintf("tcp://%s", c.HealthGates[x].Address))
+		}
+	}
+	if len(gates) != 0 {
+		newEnvironment = append(newEnvironment, appv1.EnvVar{
+			Name:  vipHealthGates,
+			Value: strings.Join(gates, ","),
+		})
+	}
+	if insecureGates {
+		newEnvironment = append(newEnvironment, appv1.EnvVar{
+			Name:  vipHealthGatesInsecure,
+			Value: "true",
+		})
+	}
+
+	// Parse URL based hooks into a comma seperated string
+	var hooks []string
+	for x := range c.Hooks {
+		switch c.Hooks[x].Type {
+		case "http":
+			hooks = append(hooks, fmt.Sprintf("%s=%s", c.Hooks[x].Event, c.Hooks[x].URL))
+		case "exec":
+			if len(c.Hooks[x].Command) == 1 {
+				hooks = append(hooks, fmt.Sprintf("%s=exec://%s", c.Hooks[x].Event, c.Hooks[x].Command[0]))
+			}
+		}
+	}
+	if len(hooks) != 0 {
+		newEnvironment = append(newEnvironment, appv1.EnvVar{
+			Name:  vipHooks,
+			Value: strings.Join(hooks, ","),
+		})
+	}
+
 	// Parse peers into a comma seperated string
 	if len(c.RemotePeers) != 0 {
 		var peers string
 		for x := range c.RemotePeers {
 			if x != 0 {
-				peers = fmt.Sprintf("%s,%s:%s:%d", peers, c.RemotePeers[x].ID, c.RemotePeers[x].Address, c.RemotePeers[x].Port)
+				peers = fmt.Sprintf("%s,%s", peers, c.RemotePeers[x].String())
 
 			} else {
-				peers = fmt.Sprintf("%s:%s:%d", c.RemotePeers[x].ID, c.RemotePeers[x].Address, c.RemotePeers[x].Port)
+				peers = c.RemotePeers[x].String()
 
 			}
 			//peers = fmt.Sprintf("%s,%s:%s:%d", peers, c.RemotePeers[x].ID, c.RemotePeers[x].Address, c.RemotePeers[x].Port)
@@ -392,6 +1472,14 @@ func GenerateManifestFromConfig(c *Config, imageVersion string) string {
 		newEnvironment = append(newEnvironment, peerEnvirontment)
 	}
 
+	// The probes use the admin API, so are only added when it is enabled
+	liveness, readiness := GenerateProbes(c.AdminAddress)
+	args := []string{"start"}
+	if c.AdminAddress == "" {
+		// An empty environment variable is ignored, so the admin API is disabled by its flag
+		args = append(args, "--adminAddress=")
+	}
+
 	newManifest := &appv1.Pod{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Pod",
@@ -415,10 +1503,10 @@ func GenerateManifestFromConfig(c *Config, imageVersion string) string {
 							},
 						},
 					},
-					Args: []string{
-						"start",
-					},
-					Env: newEnvironment,
+					Args:           args,
+					Env:            newEnvironment,
+					LivenessProbe:  liveness,
+					ReadinessProbe: readiness,
 					VolumeMounts: []appv1.VolumeMount{
 						{
 							Name:      "kubeconfig",
@@ -457,3 +1545,44 @@ func GenerateManifestFromConfig(c *Config, imageVersion string) string {
 	b, _ := yaml.Marshal(newManifest)
 	return string(b)
 }
+
+// GenerateProbes will generate the liveness (/healthz) and readiness (/readyz) probes of the admin API at the
+// address, nil probes are returned if the address is empty (the admin API is disabled)
+func GenerateProbes(address string) (liveness, readiness *appv1.Probe) {
+	if address == "" {
+		return nil, nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, nil
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, nil
+	}
+	// The pod uses the host network, so the kubelet can reach the admin API on the local address
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+
+	probe := func(path string) *appv1.Probe {
+		return &appv1.Probe{
+			Handler: appv1.Handler{
+				HTTPGet: &appv1.HTTPGetAction{
+					Host:   host,
+					Path:   path,
+					Port:   intstr.FromInt(portNumber),
+					Scheme: appv1.URISchemeHTTP,
+				},
+			},
+			PeriodSeconds:    10,
+			TimeoutSeconds:   5,
+			FailureThreshold: 3,
+		}
+	}
+	liveness, readiness = probe("/healthz"), probe("/readyz")
+	// Raft waits for the elections to complete on a cold start
+	liveness.InitialDelaySeconds = 15
+	readiness.InitialDelaySeconds = 5
+	return liveness, readiness
+}
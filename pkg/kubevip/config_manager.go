@@ -3,6 +3,8 @@ package kubevip
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -13,30 +15,379 @@ import (
 
 var endPointIndex int // Holds the previous endpoint (for determining decisions on next endpoint)
 
-//ParseBackendConfig -
+//ParseBackendConfig - parses a backend in the format address:port, an IPv6 address is in brackets
 func ParseBackendConfig(ep string) (*BackEnd, error) {
-	endpoint := strings.Split(ep, ":")
-	if len(endpoint) != 2 {
-		return nil, fmt.Errorf("Ensure a backend is in in the format address:port, e.g. 10.0.0.1:8080")
+	address, port, err := net.SplitHostPort(ep)
+	if err != nil {
+		return nil, fmt.Errorf("Ensure a backend is in in the format address:port, e.g. 10.0.0.1:8080 or [fd00::1]:8080")
 	}
-	p, err := strconv.Atoi(endpoint[1])
+	p, err := strconv.Atoi(port)
 	if err != nil {
 		return nil, err
 	}
-	return &BackEnd{Address: endpoint[0], Port: p}, nil
+	return &BackEnd{Address: address, Port: p}, nil
+}
+
+//ParseDNSBackend - parses a DNS backend in the format [scheme://]hostname:port or [scheme://]_service._proto.name
+func ParseDNSBackend(name string) (*DNSBackend, error) {
+	d := &DNSBackend{}
+	if s := strings.SplitN(name, "://", 2); len(s) == 2 {
+		d.Scheme, name = s[0], s[1]
+	}
+	if strings.HasPrefix(name, "_") {
+		d.Name = name
+	} else {
+		host, port, err := net.SplitHostPort(name)
+		if err != nil {
+			return nil, fmt.Errorf("Ensure a DNS backend is in the format hostname:port or _service._proto.name, e.g. api.example.com:6443")
+		}
+		d.Name = host
+		if d.Port, err = strconv.Atoi(port); err != nil {
+			return nil, err
+		}
+	}
+	return d, d.Validate()
+}
+
+//Validate - ensures the DNS backend is valid
+func (d *DNSBackend) Validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("A DNS backend needs a name")
+	}
+	switch d.Scheme {
+	case "", "http", "https":
+	default:
+		return fmt.Errorf("Unknown DNS backend scheme [%s], it should be http or https", d.Scheme)
+	}
+	return nil
+}
+
+//String - returns the DNS backend in the format parsed by ParseDNSBackend
+func (d DNSBackend) String() string {
+	name := d.Name
+	if !strings.HasPrefix(name, "_") {
+		name = net.JoinHostPort(name, strconv.Itoa(d.Port))
+	}
+	if d.Scheme != "" {
+		name = d.Scheme + "://" + name
+	}
+	return name
 }
 
-//ParsePeerConfig -
+//ParsePeerConfig - parses a peer in the format id:address:port[:priority], an IPv6 address is in brackets
 func ParsePeerConfig(ep string) (*RaftPeer, error) {
-	endpoint := strings.Split(ep, ":")
-	if len(endpoint) != 3 {
-		return nil, fmt.Errorf("Ensure a peer is in in the format id:address:port, e.g. server1:10.0.0.1:8080")
+	formatErr := fmt.Errorf("Ensure a peer is in in the format id:address:port[:priority], e.g. server1:10.0.0.1:8080, server1:10.0.0.1:8080:100 or server1:[fd00::1]:8080")
+	endpoint := strings.SplitN(ep, ":", 2)
+	if len(endpoint) != 2 {
+		return nil, formatErr
+	}
+	peer := &RaftPeer{ID: endpoint[0]}
+	address, port, err := net.SplitHostPort(endpoint[1])
+	if err != nil {
+		// The priority follows the port
+		last := strings.LastIndex(endpoint[1], ":")
+		if last == -1 {
+			return nil, formatErr
+		}
+		if address, port, err = net.SplitHostPort(endpoint[1][:last]); err != nil {
+			return nil, formatErr
+		}
+		if peer.Priority, err = strconv.Atoi(endpoint[1][last+1:]); err != nil {
+			return nil, fmt.Errorf("Unable to parse the priority of peer [%s] -> error [%v]", ep, err)
+		}
+	}
+	if peer.Port, err = strconv.Atoi(port); err != nil {
+		return nil, err
+	}
+	peer.Address = address
+	return peer, nil
+}
+
+//HostPort - returns the address and port of a peer, an IPv6 address is in brackets
+func (p RaftPeer) HostPort() string {
+	return net.JoinHostPort(p.Address, strconv.Itoa(p.Port))
+}
+
+//String - returns the peer in the format id:address:port[:priority], which is parsed by ParsePeerConfig
+func (p RaftPeer) String() string {
+	if p.Priority != 0 {
+		return fmt.Sprintf("%s:%s:%d", p.ID, p.HostPort(), p.Priority)
+	}
+	return fmt.Sprintf("%s:%s", p.ID, p.HostPort())
+}
+
+//ValidateARPOperation - ensures the gratuitous ARP operation is one that can be sent, empty is a reply
+func ValidateARPOperation(operation string) error {
+	switch strings.ToLower(operation) {
+	case "", "reply", "request", "both":
+		return nil
+	}
+	return fmt.Errorf("Unknown ARP operation [%s], should be one of reply/request/both", operation)
+}
+
+//ParseHealthGate - parses a health gate from a URL, e.g. https://localhost:6443/healthz or tcp://localhost:6443
+func ParseHealthGate(gate string) (*HealthGate, error) {
+	u, err := url.Parse(gate)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return &HealthGate{Name: gate, Type: u.Scheme, Address: gate}, nil
+	case "tcp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("Ensure a tcp health gate is in the format tcp://address:port, e.g. tcp://localhost:6443")
+		}
+		return &HealthGate{Name: gate, Type: u.Scheme, Address: u.Host}, nil
+	}
+	return nil, fmt.Errorf("Unable to parse health gate [%s], ensure it's prefixed with http(s):// or tcp://", gate)
+}
+
+//ParseHook - parses a hook from the format event=URL, the URL is either a webhook (http(s)://) or the path of a
+//command to run (exec://), e.g. afterAcquire=https://monitor/vip or beforeRelease=exec:///usr/local/bin/flush.sh
+func ParseHook(hook string) (*Hook, error) {
+	parts := strings.SplitN(hook, "=", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Unable to parse hook [%s], ensure it's in the format event=URL", hook)
 	}
-	p, err := strconv.Atoi(endpoint[2])
+	h := &Hook{Name: hook, Event: parts[0]}
+
+	u, err := url.Parse(parts[1])
 	if err != nil {
 		return nil, err
 	}
-	return &RaftPeer{ID: endpoint[0], Address: endpoint[1], Port: p}, nil
+	switch u.Scheme {
+	case "http", "https":
+		h.Type, h.URL = "http", parts[1]
+	case "exec":
+		if u.Path == "" {
+			return nil, fmt.Errorf("Ensure an exec hook is in the format exec:///path/to/command")
+		}
+		h.Type, h.Command = "exec", []string{u.Path}
+	default:
+		return nil, fmt.Errorf("Unable to parse hook [%s], ensure the URL is prefixed with http(s):// or exec://", hook)
+	}
+	return h, h.Validate()
+}
+
+//Validate - ensures the hook has a known event, type and failure policy, and what it runs
+func (h *Hook) Validate() error {
+	switch h.Event {
+	case HookBeforeAcquire, HookAfterAcquire, HookBeforeRelease, HookAfterRelease:
+	default:
+		return fmt.Errorf("Unknown hook event [%s], expected %s, %s, %s or %s", h.Event, HookBeforeAcquire, HookAfterAcquire, HookBeforeRelease, HookAfterRelease)
+	}
+	switch strings.ToLower(h.Type) {
+	case "exec":
+		if len(h.Command) == 0 {
+			return fmt.Errorf("The exec hook [%s] has no command to run", h.Name)
+		}
+	case "http", "https":
+		if h.URL == "" {
+			return fmt.Errorf("The http hook [%s] has no URL", h.Name)
+		}
+	default:
+		return fmt.Errorf("Unknown hook type [%s], expected exec or http", h.Type)
+	}
+	switch h.FailurePolicy {
+	case "", "ignore", "fail":
+	default:
+		return fmt.Errorf("Unknown hook failure policy [%s], expected ignore or fail", h.FailurePolicy)
+	}
+	if h.Timeout < 0 {
+		return fmt.Errorf("The timeout [%d] of hook [%s] can't be negative", h.Timeout, h.Name)
+	}
+	return nil
+}
+
+//ValidateHooks - ensures every hook of the configuration is valid, wherever it was configured
+func (c *Config) ValidateHooks() error {
+	for x := range c.Hooks {
+		if err := c.Hooks[x].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//ParseHooks will add hooks from their URL format (see ParseHook) to the configuration
+func (c *Config) ParseHooks(hooks []string) error {
+	for i := range hooks {
+		h, err := ParseHook(hooks[i])
+		if err != nil {
+			return err
+		}
+		c.Hooks = append(c.Hooks, *h)
+	}
+	return nil
+}
+
+//Validate - ensures the access log only has known fields and a sample rate between 0 and 1
+func (a *AccessLog) Validate() error {
+	for _, f := range a.Fields {
+		known := false
+		for _, field := range AccessLogFields {
+			known = known || f == field
+		}
+		if !known {
+			return fmt.Errorf("Unknown access log field [%s], expected one of %s", f, strings.Join(AccessLogFields, ", "))
+		}
+	}
+	if a.SampleRate < 0 || a.SampleRate > 1 {
+		return fmt.Errorf("The access log sample rate [%g] should be between 0 and 1", a.SampleRate)
+	}
+	if a.MaxSize < 0 || a.MaxBackups < 0 {
+		return fmt.Errorf("The access log maxSize and maxBackups can't be negative")
+	}
+	return nil
+}
+
+//Validate - ensures none of the connection limits are negative
+func (l *ConnectionLimits) Validate() error {
+	if l.MaxConnections < 0 || l.MaxClientConnections < 0 || l.ConnectionBurst < 0 {
+		return fmt.Errorf("The connection limits can't be negative")
+	}
+	if l.ConnectionRate < 0 || l.ClientConnectionRate < 0 {
+		return fmt.Errorf("The connection rates can't be negative")
+	}
+	return nil
+}
+
+//Validate - ensures the connection timeouts are valid
+func (t *ConnectionTimeouts) Validate() error {
+	if t.ConnectTimeout < 0 || t.IdleTimeout < 0 || t.TotalTimeout < 0 {
+		return fmt.Errorf("The connection timeouts can't be negative")
+	}
+	return nil
+}
+
+//Validate - ensures the upstream TLS is valid
+func (u *UpstreamTLS) Validate() error {
+	switch u.Verify {
+	case "", TLSVerifyFull, TLSVerifyCA, TLSVerifyNone:
+	default:
+		return fmt.Errorf("Unknown upstream TLS verification [%s], it should be %s, %s or %s", u.Verify, TLSVerifyFull, TLSVerifyCA, TLSVerifyNone)
+	}
+	if (u.Certificate == "") != (u.Key == "") {
+		return fmt.Errorf("The upstream TLS certificate and key should be set together")
+	}
+	return nil
+}
+
+//Validate - ensures the outlier detection is valid
+func (o *OutlierDetection) Validate() error {
+	if o.FailureRate < 0 || o.FailureRate > 100 || o.MaxEjectionPercent < 0 || o.MaxEjectionPercent > 100 {
+		return fmt.Errorf("The outlier detection percentages should be between 0 and 100")
+	}
+	if o.MinimumRequests < 0 || o.Interval < 0 || o.BaseEjectionTime < 0 || o.MaxEjectionTime < 0 || o.SlowStart < 0 ||
+		o.MaxConnections < 0 {
+		return fmt.Errorf("The outlier detection times, minimum requests and max connections can't be negative")
+	}
+	return nil
+}
+
+//Validate - ensures the session affinity is valid for the type of load balancer
+func (a *SessionAffinity) Validate(lbType string) error {
+	switch a.Type {
+	case AffinitySourceIP:
+	case AffinityCookie, AffinityHeader:
+		if !strings.EqualFold(lbType, "http") {
+			return fmt.Errorf("The [%s] session affinity is only supported by http load balancers", a.Type)
+		}
+		if a.Type == AffinityHeader && a.HeaderName == "" {
+			return fmt.Errorf("The header session affinity needs the name of a header")
+		}
+	default:
+		return fmt.Errorf("Unknown session affinity [%s], expected one of %s, %s, %s", a.Type, AffinitySourceIP, AffinityCookie, AffinityHeader)
+	}
+	if a.TTL < 0 {
+		return fmt.Errorf("The session affinity TTL can't be negative")
+	}
+	return nil
+}
+
+//ValidateProxyProtocol - ensures the PROXY protocol version, TLVs and trusted sources of a load balancer are valid
+func (lb *LoadBalancer) ValidateProxyProtocol() error {
+	switch lb.ProxyProtocolVersion {
+	case 0, 1, 2:
+	default:
+		return fmt.Errorf("Unknown PROXY protocol version [%d], it should be 1 or 2", lb.ProxyProtocolVersion)
+	}
+	if lb.ProxyProtocolTLVs && lb.ProxyProtocolVersion == 1 {
+		return fmt.Errorf("PROXY protocol TLVs can only be passed through with version 2")
+	}
+	_, err := ParseSources(lb.ProxyProtocolTrustedSources)
+	return err
+}
+
+//ParseSources - parses a list of CIDRs, an IP is parsed as a CIDR containing only that address
+func ParseSources(sources []string) ([]*net.IPNet, error) {
+	var cidrs []*net.IPNet
+	for _, source := range sources {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		if ip := net.ParseIP(source); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			cidrs = append(cidrs, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(source)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse the source [%s], ensure it's an IP or CIDR (e.g. 10.0.0.0/8)", source)
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil
+}
+
+// leaderElectionJitter matches the jitter applied to the retry period by the Kubernetes leader election
+const leaderElectionJitter = 1.2
+
+//SetDefaults - will set any unset leader election values to the defaults passed
+func (le *LeaderElection) SetDefaults(name, namespace string, leaseDuration, renewDeadline, retryPeriod int) {
+	if le.LeaseName == "" {
+		le.LeaseName = name
+	}
+	if le.LeaseNamespace == "" {
+		le.LeaseNamespace = namespace
+	}
+	if le.LeaseLockType == "" {
+		le.LeaseLockType = "leases"
+	}
+	if le.LeaseDuration == 0 {
+		le.LeaseDuration = leaseDuration
+	}
+	if le.RenewDeadline == 0 {
+		le.RenewDeadline = renewDeadline
+	}
+	if le.RetryPeriod == 0 {
+		le.RetryPeriod = retryPeriod
+	}
+}
+
+//Validate - ensures the leader election values are usable, and that their timings work with each other
+func (le *LeaderElection) Validate() error {
+	switch le.LeaseLockType {
+	case "", "leases", "configmaps", "endpoints", "configmapsleases", "endpointsleases":
+	default:
+		return fmt.Errorf("Unknown lease lock type [%s], should be one of leases/configmaps/endpoints/configmapsleases/endpointsleases", le.LeaseLockType)
+	}
+	if le.LeaseDuration < 0 || le.RenewDeadline < 0 || le.RetryPeriod < 0 {
+		return fmt.Errorf("Lease duration [%d], renew deadline [%d] and retry period [%d] can't be negative", le.LeaseDuration, le.RenewDeadline, le.RetryPeriod)
+	}
+	// Only check the relationships between the values that are set, the defaults are known to be valid
+	if le.LeaseDuration != 0 && le.RenewDeadline != 0 && le.LeaseDuration <= le.RenewDeadline {
+		return fmt.Errorf("Lease duration [%d] must be greater than the renew deadline [%d]", le.LeaseDuration, le.RenewDeadline)
+	}
+	if le.RenewDeadline != 0 && le.RetryPeriod != 0 && float64(le.RenewDeadline) <= leaderElectionJitter*float64(le.RetryPeriod) {
+		return fmt.Errorf("Renew deadline [%d] must be greater than %.1f times the retry period [%d]", le.RenewDeadline, leaderElectionJitter, le.RetryPeriod)
+	}
+	return nil
 }
 
 //OpenConfig will attempt to read a file and parse it's contents into a configuration
@@ -61,6 +412,9 @@ func OpenConfig(path string) (*Config, error) {
 		if err != nil {
 			return nil, err
 		}
+		if err = ValidateARPOperation(c.ARPOperation); err != nil {
+			return nil, err
+		}
 		return &c, nil
 
 	}
@@ -76,6 +430,10 @@ func (c *Config) PrintConfig() {
 
 //ParseFlags will write the current configuration to a specified [path]
 func (c *Config) ParseFlags(localPeer string, remotePeers, backends []string) error {
+	if err := ValidateARPOperation(c.ARPOperation); err != nil {
+		return err
+	}
+
 	// Parse localPeer
 	p, err := ParsePeerConfig(localPeer)
 	if err != nil {
@@ -100,12 +458,26 @@ func (c *Config) ParseFlags(localPeer string, remotePeers, backends []string) er
 		if err != nil {
 			return err
 		}
-		c.LoadBalancers[0].Backends = append(c.LoadBalancers[0].Backends, *b)
+		c.LoadBalancers[0].Backends = append(c.LoadBalancers[0].Backends, BackEnd{Address: b.Address, Port: b.Port})
 	}
 
 	return nil
 }
 
+//ParseHealthGates will add health gates from their URL format (see ParseHealthGate) to the configuration, insecure
+//skips the verification of the certificates presented to https gates
+func (c *Config) ParseHealthGates(gates []string, insecure bool) error {
+	for i := range gates {
+		g, err := ParseHealthGate(gates[i])
+		if err != nil {
+			return err
+		}
+		g.InsecureSkipVerify = insecure && g.Type == "https"
+		c.HealthGates = append(c.HealthGates, *g)
+	}
+	return nil
+}
+
 //SampleConfig will create an example configuration and write it to the specified [path]
 func SampleConfig() {
 
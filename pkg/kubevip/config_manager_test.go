@@ -0,0 +1,204 @@
+package kubevip
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHook(t *testing.T) {
+	tests := []struct {
+		name    string
+		hook    string
+		want    Hook
+		wantErr bool
+	}{
+		{name: "webhook", hook: "afterAcquire=https://monitor/vip", want: Hook{Name: "afterAcquire=https://monitor/vip", Event: HookAfterAcquire, Type: "http", URL: "https://monitor/vip"}},
+		{name: "exec", hook: "beforeRelease=exec:///usr/local/bin/flush.sh", want: Hook{Name: "beforeRelease=exec:///usr/local/bin/flush.sh", Event: HookBeforeRelease, Type: "exec", Command: []string{"/usr/local/bin/flush.sh"}}},
+		{name: "exec without path", hook: "beforeAcquire=exec://", wantErr: true},
+		{name: "unknown event", hook: "onAcquire=https://monitor/vip", wantErr: true},
+		{name: "unknown scheme", hook: "afterAcquire=ftp://monitor/vip", wantErr: true},
+		{name: "no URL", hook: "afterAcquire", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook, err := ParseHook(tt.hook)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHook(%q) error = %v, wantErr %v", tt.hook, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(*hook, tt.want) {
+				t.Errorf("ParseHook(%q) = %+v, want %+v", tt.hook, *hook, tt.want)
+			}
+		})
+	}
+}
+
+func TestHookValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		hook    Hook
+		wantErr bool
+	}{
+		{name: "exec", hook: Hook{Event: HookBeforeAcquire, Type: "exec", Command: []string{"true"}}},
+		{name: "http", hook: Hook{Event: HookAfterRelease, Type: "http", URL: "http://monitor", FailurePolicy: "fail", Timeout: 5}},
+		{name: "exec without command", hook: Hook{Event: HookBeforeAcquire, Type: "exec"}, wantErr: true},
+		{name: "http without URL", hook: Hook{Event: HookBeforeAcquire, Type: "https"}, wantErr: true},
+		{name: "unknown type", hook: Hook{Event: HookBeforeAcquire, Type: "grpc", URL: "grpc://monitor"}, wantErr: true},
+		{name: "unknown failure policy", hook: Hook{Event: HookBeforeAcquire, Type: "exec", Command: []string{"true"}, FailurePolicy: "retry"}, wantErr: true},
+		{name: "negative timeout", hook: Hook{Event: HookBeforeAcquire, Type: "exec", Command: []string{"true"}, Timeout: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.hook.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateARPOperation(t *testing.T) {
+	for _, op := range []string{"", "reply", "request", "both", "Request"} {
+		if err := ValidateARPOperation(op); err != nil {
+			t.Errorf("ValidateARPOperation(%q) error = %v", op, err)
+		}
+	}
+	if err := ValidateARPOperation("announce"); err == nil {
+		t.Errorf("ValidateARPOperation(%q) should fail", "announce")
+	}
+}
+
+func TestParseBackendConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		address string
+		port    int
+		wantErr bool
+	}{
+		{name: "ipv4", backend: "10.0.0.1:6443", address: "10.0.0.1", port: 6443},
+		{name: "hostname", backend: "api.example.com:443", address: "api.example.com", port: 443},
+		{name: "ipv6", backend: "[fd00::1]:6443", address: "fd00::1", port: 6443},
+		{name: "ipv6 without brackets", backend: "fd00::1:6443", wantErr: true},
+		{name: "no port", backend: "10.0.0.1", wantErr: true},
+		{name: "invalid port", backend: "10.0.0.1:https", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			be, err := ParseBackendConfig(tt.backend)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBackendConfig(%q) error = %v, wantErr %v", tt.backend, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if be.Address != tt.address || be.Port != tt.port {
+				t.Errorf("ParseBackendConfig(%q) = %s:%d, want %s:%d", tt.backend, be.Address, be.Port, tt.address, tt.port)
+			}
+		})
+	}
+}
+
+func TestParsePeerConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		peer    string
+		want    RaftPeer
+		wantErr bool
+	}{
+		{name: "ipv4", peer: "server1:10.0.0.1:10000", want: RaftPeer{ID: "server1", Address: "10.0.0.1", Port: 10000}},
+		{name: "ipv4 with priority", peer: "server1:10.0.0.1:10000:100", want: RaftPeer{ID: "server1", Address: "10.0.0.1", Port: 10000, Priority: 100}},
+		{name: "ipv6", peer: "server1:[fd00::1]:10000", want: RaftPeer{ID: "server1", Address: "fd00::1", Port: 10000}},
+		{name: "ipv6 with priority", peer: "server1:[fd00::1]:10000:50", want: RaftPeer{ID: "server1", Address: "fd00::1", Port: 10000, Priority: 50}},
+		{name: "hostname", peer: "server1:node1.example.com:10000", want: RaftPeer{ID: "server1", Address: "node1.example.com", Port: 10000}},
+		{name: "no address", peer: "server1", wantErr: true},
+		{name: "no port", peer: "server1:10.0.0.1", wantErr: true},
+		{name: "invalid priority", peer: "server1:10.0.0.1:10000:high", wantErr: true},
+		{name: "invalid port", peer: "server1:10.0.0.1:raft", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer, err := ParsePeerConfig(tt.peer)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePeerConfig(%q) error = %v, wantErr %v", tt.peer, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if *peer != tt.want {
+				t.Errorf("ParsePeerConfig(%q) = %+v, want %+v", tt.peer, *peer, tt.want)
+			}
+			// The peer is written back in the format it was parsed from
+			if peer.String() != tt.peer {
+				t.Errorf("ParsePeerConfig(%q).String() = %q", tt.peer, peer.String())
+			}
+		})
+	}
+}
+
+func TestParseHealthGate(t *testing.T) {
+	tests := []struct {
+		name    string
+		gate    string
+		want    HealthGate
+		wantErr bool
+	}{
+		{name: "http", gate: "http://localhost:8080/healthz", want: HealthGate{Name: "http://localhost:8080/healthz", Type: "http", Address: "http://localhost:8080/healthz"}},
+		{name: "https", gate: "https://localhost:6443/healthz", want: HealthGate{Name: "https://localhost:6443/healthz", Type: "https", Address: "https://localhost:6443/healthz"}},
+		{name: "tcp", gate: "tcp://localhost:6443", want: HealthGate{Name: "tcp://localhost:6443", Type: "tcp", Address: "localhost:6443"}},
+		{name: "tcp without host", gate: "tcp://", wantErr: true},
+		{name: "no scheme", gate: "localhost:6443", wantErr: true},
+		{name: "unknown scheme", gate: "udp://localhost:53", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gate, err := ParseHealthGate(tt.gate)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHealthGate(%q) error = %v, wantErr %v", tt.gate, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(*gate, tt.want) {
+				t.Errorf("ParseHealthGate(%q) = %+v, want %+v", tt.gate, *gate, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHealthGatesInsecure(t *testing.T) {
+	c := &Config{}
+	if err := c.ParseHealthGates([]string{"https://localhost:6443/healthz", "tcp://localhost:6443"}, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, gate := range c.HealthGates {
+		// Only a https gate has a certificate to skip verifying
+		if want := gate.Type == "https"; gate.InsecureSkipVerify != want {
+			t.Errorf("health gate [%s] InsecureSkipVerify = %v, want %v", gate.Name, gate.InsecureSkipVerify, want)
+		}
+	}
+}
+
+func TestLeaderElectionValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		le      LeaderElection
+		wantErr bool
+	}{
+		{name: "defaults", le: LeaderElection{}},
+		{name: "timings", le: LeaderElection{LeaseLockType: "leases", LeaseDuration: 15, RenewDeadline: 10, RetryPeriod: 2}},
+		{name: "only the lease duration", le: LeaderElection{LeaseDuration: 60}},
+		{name: "unknown lock type", le: LeaderElection{LeaseLockType: "secrets"}, wantErr: true},
+		{name: "negative", le: LeaderElection{RetryPeriod: -1}, wantErr: true},
+		{name: "lease duration within the renew deadline", le: LeaderElection{LeaseDuration: 10, RenewDeadline: 10}, wantErr: true},
+		{name: "renew deadline within the jittered retry period", le: LeaderElection{RenewDeadline: 6, RetryPeriod: 5}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.le.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
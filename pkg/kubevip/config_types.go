@@ -11,12 +11,32 @@ type Config struct {
 	// EnableLeaderElection will use the Kubernetes leader election algorithim
 	EnableLeaderElection bool `yaml:"enableLeaderElection"`
 
+	// LeaderElection are the settings of the lock used by the Kubernetes leader election
+	LeaderElection LeaderElection `yaml:"leaderElection,omitempty"`
+
+	// APIServers are the API server endpoints (host:port or URL) used for leader election outside of a cluster,
+	// endpoints local to this host are preferred followed by the first reachable endpoint (default: hostname:6443)
+	APIServers []string `yaml:"apiServers,omitempty"`
+
 	// LocalPeer is the configuration of this host
 	LocalPeer RaftPeer `yaml:"localPeer"`
 
 	// Peers are all of the peers within the RAFT cluster
 	RemotePeers []RaftPeer `yaml:"remotePeers"`
 
+	// EnableRaftTLS will encrypt and authenticate the RAFT transport with mutual TLS, each peer certificate must
+	// contain the ID of that peer as its common name or a DNS name
+	EnableRaftTLS bool `yaml:"enableRaftTLS"`
+
+	// RaftTLSCA is the path to the CA used to verify the certificates of the RAFT peers
+	RaftTLSCA string `yaml:"raftTLSCA,omitempty"`
+
+	// RaftTLSCert is the path to the certificate of this RAFT peer (it is reloaded when the file changes)
+	RaftTLSCert string `yaml:"raftTLSCert,omitempty"`
+
+	// RaftTLSKey is the path to the private key of this RAFT peer (it is reloaded when the file changes)
+	RaftTLSKey string `yaml:"raftTLSKey,omitempty"`
+
 	// AddPeersAsBackends, this will automatically add RAFT peers as backends to a loadbalancer
 	AddPeersAsBackends bool `yaml:"addPeersAsBackends"`
 
@@ -26,12 +46,42 @@ type Config struct {
 	// GratuitousARP will broadcast an ARP update when the VIP changes host
 	GratuitousARP bool `yaml:"gratuitousARP"`
 
+	// ARPBurstCount is the number of gratuitous ARP packets sent when this node takes over the VIP
+	ARPBurstCount int `yaml:"arpBurstCount,omitempty"`
+
+	// ARPBurstInterval is the time in milliseconds between each packet of the takeover burst
+	ARPBurstInterval int `yaml:"arpBurstInterval,omitempty"`
+
+	// ARPRefreshInterval is the time in seconds between gratuitous ARP packets after the burst (negative disables)
+	ARPRefreshInterval int `yaml:"arpRefreshInterval,omitempty"`
+
+	// ARPOperation is the type of gratuitous ARP packet that is sent, either reply (default), request or both
+	ARPOperation string `yaml:"arpOperation,omitempty"`
+
+	// ARPInterfaces are additional interfaces (such as bond slaves or VLANs) to send gratuitous ARP on
+	ARPInterfaces []string `yaml:"arpInterfaces,omitempty"`
+
+	// DetectConflicts will probe the network for the VIP before it is added, and monitor for other hosts claiming it
+	DetectConflicts bool `yaml:"detectConflicts"`
+
+	// RefuseOnConflict will stop this node taking leadership when another host is answering for the VIP
+	RefuseOnConflict bool `yaml:"refuseOnConflict"`
+
 	// SingleNode will start the cluster as a single Node (Raft disabled)
 	SingleNode bool `yaml:"singleNode"`
 
 	// StartAsLeader, this will start this node as the leader before other nodes connect
 	StartAsLeader bool `yaml:"startAsLeader"`
 
+	// Priority of this node to hold the VIP, a node with a higher priority will take leadership from the current leader
+	Priority int `yaml:"priority,omitempty"`
+
+	// PreemptDelay is the time in seconds a higher priority node must be present before it takes leadership
+	PreemptDelay int `yaml:"preemptDelay,omitempty"`
+
+	// NoPreempt will keep leadership with the current leader, regardless of the priority of other nodes
+	NoPreempt bool `yaml:"noPreempt"`
+
 	// Interface is the network interface to bind to (default: First Adapter)
 	Interface string `yaml:"interface,omitempty"`
 
@@ -49,6 +99,103 @@ type Config struct {
 
 	// LoadBalancers are the various services we can load balance over
 	LoadBalancers []LoadBalancer `yaml:"loadBalancers,omitempty"`
+
+	// HealthGates are local checks that must pass for this node to hold the VIP
+	HealthGates []HealthGate `yaml:"healthGates,omitempty"`
+
+	// Hooks are actions run when this node acquires or releases the VIP
+	Hooks []Hook `yaml:"hooks,omitempty"`
+
+	// EnableEvents will record Kubernetes events when the VIP is acquired or released, a backend changes state or
+	// ARP fails (leader election only). Events are recorded on the pod in POD_NAME/POD_NAMESPACE, or the node.
+	EnableEvents bool `yaml:"enableEvents"`
+
+	// AdminAddress is the local address of the admin HTTP API, used by `kube-vip status` (empty disables the API)
+	AdminAddress string `yaml:"adminAddress,omitempty"`
+}
+
+// The events a Hook can be run on
+const (
+	HookBeforeAcquire = "beforeAcquire"
+	HookAfterAcquire  = "afterAcquire"
+	HookBeforeRelease = "beforeRelease"
+	HookAfterRelease  = "afterRelease"
+)
+
+// Hook is an action (such as updating a firewall or notifying a webhook) run when this node acquires or releases the VIP
+type Hook struct {
+	// Name of a Hook
+	Name string `yaml:"name"`
+
+	// Event the Hook is run on, either beforeAcquire, afterAcquire, beforeRelease or afterRelease
+	Event string `yaml:"event"`
+
+	// Type of Hook, either exec or http (a webhook)
+	Type string `yaml:"type"`
+
+	// Command is the command and arguments that are run (exec), details of the event are passed as KUBE_VIP_*
+	// environment variables
+	Command []string `yaml:"command,omitempty"`
+
+	// URL of the webhook, details of the event are POSTed as JSON (http)
+	URL string `yaml:"url,omitempty"`
+
+	// Timeout is the time in seconds before the Hook is considered failed
+	Timeout int `yaml:"timeout,omitempty"`
+
+	// FailurePolicy is either ignore (default) or fail, a failing hook with the fail policy stops this node
+	// holding the VIP (it has no effect on the release hooks)
+	FailurePolicy string `yaml:"failurePolicy,omitempty"`
+}
+
+// HealthGate is a local health check, when it fails this node will give up (and not contest) leadership
+type HealthGate struct {
+	// Name of a HealthGate
+	Name string `yaml:"name"`
+
+	// Type of HealthGate, either tcp, http, https or exec
+	Type string `yaml:"type"`
+
+	// Address is the address:port (tcp) or the URL (http/https) that is checked
+	Address string `yaml:"address,omitempty"`
+
+	// Command is the command and arguments that are run (exec), an exit code of zero is healthy
+	Command []string `yaml:"command,omitempty"`
+
+	// Interval is the time in seconds between each check
+	Interval int `yaml:"interval,omitempty"`
+
+	// Timeout is the time in seconds before a check is considered failed
+	Timeout int `yaml:"timeout,omitempty"`
+
+	// FailureThreshold is the number of consecutive failed checks before the gate is unhealthy
+	FailureThreshold int `yaml:"failureThreshold,omitempty"`
+
+	// InsecureSkipVerify will not verify the certificate presented to an https check
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify,omitempty"`
+}
+
+// LeaderElection details the lock used by the Kubernetes leader election, unset values use the defaults of
+// the mode kube-vip is running in
+type LeaderElection struct {
+	// LeaseName is the name of the lock
+	LeaseName string `yaml:"leaseName,omitempty"`
+
+	// LeaseNamespace is the namespace the lock is created in
+	LeaseNamespace string `yaml:"leaseNamespace,omitempty"`
+
+	// LeaseLockType is the type of resource used as the lock, either leases (default), configmaps, endpoints,
+	// configmapsleases or endpointsleases (the last two are used when migrating older clusters to leases)
+	LeaseLockType string `yaml:"leaseLockType,omitempty"`
+
+	// LeaseDuration is the time in seconds that followers wait before trying to take an un-renewed lock
+	LeaseDuration int `yaml:"leaseDuration,omitempty"`
+
+	// RenewDeadline is the time in seconds that the leader will retry renewing the lock before giving it up
+	RenewDeadline int `yaml:"renewDeadline,omitempty"`
+
+	// RetryPeriod is the time in seconds between each attempt to acquire or renew the lock
+	RetryPeriod int `yaml:"retryPeriod,omitempty"`
 }
 
 // RaftPeer details the configuration of all cluster peers
@@ -61,6 +208,9 @@ type RaftPeer struct {
 
 	// Listening port of this peer instance
 	Port int `yaml:"port"`
+
+	// Priority of this peer instance to hold the VIP (see Config.Priority)
+	Priority int `yaml:"priority,omitempty"`
 }
 
 // LoadBalancer contains the configuration of a load balancing instance
@@ -77,6 +227,14 @@ type LoadBalancer struct {
 	// BindToVip will bind the load balancer port to the VIP itself
 	BindToVip bool `yaml:"bindToVip"`
 
+	// Listeners is the number of listeners (TCP and HTTP) sharing the port with SO_REUSEPORT, each accepting
+	// connections on its own goroutine so they're spread across cores (default 1)
+	Listeners int `yaml:"listeners,omitempty"`
+
+	// FreeBind will allow the load balancer to bind to an address that isn't present yet (IP_FREEBIND), such as a
+	// VIP that is yet to be added to this node
+	FreeBind bool `yaml:"freeBind,omitempty"`
+
 	// http://www.haproxy.org/download/1.8/doc/proxy-protocol.txt
 	// EnableProxyProtocol, will send proxy protocol data to backends
 	EnableProxyProtocol bool `yaml:"enableProxyProtocol"`
@@ -86,6 +244,235 @@ type LoadBalancer struct {
 
 	//Backends, is an array of backend servers
 	Backends []BackEnd `yaml:"backends"`
+
+	//DNSBackends, are resolved into backends, each address becoming a backend that is added or removed as the
+	// answers change (backends with a hostname as their address are also resolved)
+	DNSBackends []DNSBackend `yaml:"dnsBackends,omitempty"`
+
+	//DNSRefresh, is the seconds between resolving the DNS backends (default the TTL of the answers, kept between 5
+	// and 300 seconds)
+	DNSRefresh int `yaml:"dnsRefresh,omitempty"`
+
+	// AccessLog, if set, will log every connection (TCP) or request (HTTP) handled by this LoadBalancer
+	AccessLog *AccessLog `yaml:"accessLog,omitempty"`
+
+	// Limits, if set, will restrict the connections all clients (or a single client) can make to this LoadBalancer
+	Limits *ConnectionLimits `yaml:"limits,omitempty"`
+
+	// Timeouts, if set, will change the timeouts and TCP keepalive of the connections proxied by this LoadBalancer (TCP)
+	Timeouts *ConnectionTimeouts `yaml:"timeouts,omitempty"`
+
+	// Affinity, if set, will send the connections (or requests) of a client to the same backend whilst it is up
+	Affinity *SessionAffinity `yaml:"affinity,omitempty"`
+
+	// UpstreamTLS, if set, configures the TLS connections to the backends, which are those with a https URL for a
+	// http load balancer and every backend for a tls load balancer
+	UpstreamTLS *UpstreamTLS `yaml:"upstreamTLS,omitempty"`
+
+	// OutlierDetection, if set, will eject backends that keep failing rather than marking a backend down on its
+	// first failure
+	OutlierDetection *OutlierDetection `yaml:"outlierDetection,omitempty"`
+
+	// AllowedSources are the CIDRs (or IPs) that clients must connect from, if empty any client is allowed
+	AllowedSources []string `yaml:"allowedSources,omitempty"`
+
+	// DeniedSources are the CIDRs (or IPs) that clients can't connect from, they take precedence over AllowedSources
+	DeniedSources []string `yaml:"deniedSources,omitempty"`
+
+	// AcceptProxyProtocol will take the client address from the PROXY protocol header sent by a proxy in front of
+	// this LoadBalancer (TCP and HTTP), connections without a header use the address of the connection
+	AcceptProxyProtocol bool `yaml:"acceptProxyProtocol,omitempty"`
+
+	// ProxyProtocolTrustedSources are the CIDRs (or IPs) of the proxies that may send a PROXY protocol header, a
+	// header from any other source is rejected, if empty any source is trusted
+	ProxyProtocolTrustedSources []string `yaml:"proxyProtocolTrustedSources,omitempty"`
+
+	// ProxyProtocolVersion is the version (1 or 2) of the PROXY protocol header sent to backends (default 2)
+	ProxyProtocolVersion int `yaml:"proxyProtocolVersion,omitempty"`
+
+	// ProxyProtocolTLVs will pass the TLVs of an incoming PROXY protocol header through to backends (version 2 only)
+	ProxyProtocolTLVs bool `yaml:"proxyProtocolTLVs,omitempty"`
+
+	// backendsMux guards Backends once the LoadBalancer is running, as they are replaced rather than updated (e.g.
+	// when the answers of a DNS backend change)
+	backendsMux sync.RWMutex
+}
+
+// ConnectionLimits restrict the concurrent and new connections to a LoadBalancer, a client is identified by the
+// source IP of the connection (not a PROXY protocol header) and a zero value is unlimited
+type ConnectionLimits struct {
+	// MaxConnections is the maximum number of concurrent connections from all clients
+	MaxConnections int `yaml:"maxConnections,omitempty"`
+
+	// MaxClientConnections is the maximum number of concurrent connections from a single client
+	MaxClientConnections int `yaml:"maxClientConnections,omitempty"`
+
+	// ConnectionRate is the number of new connections per second accepted from all clients
+	ConnectionRate float64 `yaml:"connectionRate,omitempty"`
+
+	// ClientConnectionRate is the number of new connections per second accepted from a single client
+	ClientConnectionRate float64 `yaml:"clientConnectionRate,omitempty"`
+
+	// ConnectionBurst is the number of new connections accepted at once above the rates (default the rate rounded up)
+	ConnectionBurst int `yaml:"connectionBurst,omitempty"`
+}
+
+// ConnectionTimeouts are the timeouts and TCP keepalive of the connections proxied by a LoadBalancer, a zero value
+// is the default
+type ConnectionTimeouts struct {
+	// ConnectTimeout is the time in milliseconds to wait when connecting to a backend (default 500)
+	ConnectTimeout int `yaml:"connectTimeout,omitempty"`
+
+	// IdleTimeout is the time in seconds a connection can go without data in either direction before it is closed
+	// (default none)
+	IdleTimeout int `yaml:"idleTimeout,omitempty"`
+
+	// TotalTimeout is the time in seconds after which a connection is closed however active it is (default none)
+	TotalTimeout int `yaml:"totalTimeout,omitempty"`
+
+	// KeepAlive is the time in seconds between TCP keepalive probes on both the client and backend connections
+	// (default 15, negative disables)
+	KeepAlive int `yaml:"keepAlive,omitempty"`
+}
+
+// OutlierDetection ejects backends after consecutive failures or a high failure rate, each ejection of a backend
+// lasts twice as long as the last, a zero value is the default
+type OutlierDetection struct {
+	// ConsecutiveFailures is the number of failures in a row that eject a backend (default 5, negative disables)
+	ConsecutiveFailures int `yaml:"consecutiveFailures,omitempty"`
+
+	// FailureRate is the percentage of failed connections (or requests) within an interval that ejects a backend
+	// (default disabled)
+	FailureRate int `yaml:"failureRate,omitempty"`
+
+	// MinimumRequests is the number of connections (or requests) within an interval before the failure rate of a
+	// backend is judged (default 10)
+	MinimumRequests int `yaml:"minimumRequests,omitempty"`
+
+	// Interval is the time in seconds the failure rate is measured over (default 10)
+	Interval int `yaml:"interval,omitempty"`
+
+	// BaseEjectionTime is the time in seconds of the first ejection of a backend (default 30)
+	BaseEjectionTime int `yaml:"baseEjectionTime,omitempty"`
+
+	// MaxEjectionTime is the longest time in seconds a backend is ejected for (default 300)
+	MaxEjectionTime int `yaml:"maxEjectionTime,omitempty"`
+
+	// MaxEjectionPercent is the most of the backends that can be ejected at once (default 50)
+	MaxEjectionPercent int `yaml:"maxEjectionPercent,omitempty"`
+
+	// SlowStart is the time in seconds over which a returning backend is ramped up to its full share of new
+	// connections (default none)
+	SlowStart int `yaml:"slowStart,omitempty"`
+
+	// MaxConnections is the most connections (or requests) a backend is sent at once, a backend with that many is
+	// skipped until one of them finishes (default unlimited)
+	MaxConnections int `yaml:"maxConnections,omitempty"`
+}
+
+// The verification modes of upstream TLS
+const (
+	// TLSVerifyFull verifies the certificate chain and the server name of a backend
+	TLSVerifyFull = "full"
+	// TLSVerifyCA verifies the certificate chain of a backend but not its server name
+	TLSVerifyCA = "ca"
+	// TLSVerifyNone doesn't verify the certificate of a backend
+	TLSVerifyNone = "none"
+)
+
+// UpstreamTLS is the TLS client configuration used to connect to the backends of a load balancer
+type UpstreamTLS struct {
+	// CA is the path to a bundle of the CAs that sign the backend certificates (default the system roots)
+	CA string `yaml:"ca,omitempty"`
+
+	// Certificate is the path to the client certificate presented to the backends (mutual TLS)
+	Certificate string `yaml:"certificate,omitempty"`
+
+	// Key is the path to the private key of the client certificate
+	Key string `yaml:"key,omitempty"`
+
+	// ServerName is sent as the SNI and verified against the backend certificates (default the backend host)
+	ServerName string `yaml:"serverName,omitempty"`
+
+	// Verify is how the backend certificates are verified, full, ca or none (default full)
+	Verify string `yaml:"verify,omitempty"`
+}
+
+// The types of session affinity
+const (
+	// AffinitySourceIP pins a client by its source IP (TCP, UDP and HTTP)
+	AffinitySourceIP = "sourceIP"
+	// AffinityCookie pins a client by a cookie set on the first response (HTTP)
+	AffinityCookie = "cookie"
+	// AffinityHeader pins a client by the value of a request header (HTTP)
+	AffinityHeader = "header"
+)
+
+// SessionAffinity pins the connections (or requests) of a client to a backend, if the backend goes down the client
+// is pinned to another one
+type SessionAffinity struct {
+	// Type is how a client is identified, sourceIP, cookie or header
+	Type string `yaml:"type"`
+
+	// TTL is the time in seconds a client stays pinned after its last connection (default 10800), or the max age of
+	// the cookie (default the browser session)
+	TTL int `yaml:"ttl,omitempty"`
+
+	// CookieName is the name of the cookie that pins a client (default KUBEVIP_BACKEND)
+	CookieName string `yaml:"cookieName,omitempty"`
+
+	// HeaderName is the request header whose value pins a client, e.g. X-Session-ID
+	HeaderName string `yaml:"headerName,omitempty"`
+}
+
+// The fields that can be written to an access log
+const (
+	AccessLogClient      = "client"
+	AccessLogBackend     = "backend"
+	AccessLogBytesIn     = "bytesIn"
+	AccessLogBytesOut    = "bytesOut"
+	AccessLogDuration    = "duration"
+	AccessLogTermination = "termination"
+	AccessLogMethod      = "method"
+	AccessLogHost        = "host"
+	AccessLogPath        = "path"
+	AccessLogStatus      = "status"
+)
+
+// AccessLogFields - all of the fields that can be written to an access log, the HTTP only fields (method, host,
+// path and status) are ignored by TCP load balancers
+var AccessLogFields = []string{AccessLogClient, AccessLogBackend, AccessLogBytesIn, AccessLogBytesOut, AccessLogDuration,
+	AccessLogTermination, AccessLogMethod, AccessLogHost, AccessLogPath, AccessLogStatus}
+
+// AccessLog configures where and how the connections of a LoadBalancer are logged
+type AccessLog struct {
+	// Path of the file access logs are written to, if empty (or stdout) they're written to stdout
+	Path string `yaml:"path,omitempty"`
+
+	// MaxSize is the size in megabytes a file is rotated at (default 100)
+	MaxSize int `yaml:"maxSize,omitempty"`
+
+	// MaxBackups is the number of rotated files that are kept (default 3)
+	MaxBackups int `yaml:"maxBackups,omitempty"`
+
+	// Fields that are written to each entry (default all)
+	Fields []string `yaml:"fields,omitempty"`
+
+	// SampleRate is the fraction of connections that are logged, between 0 and 1 (default 1, log everything)
+	SampleRate float64 `yaml:"sampleRate,omitempty"`
+}
+
+// DNSBackend is a name that is resolved into backends
+type DNSBackend struct {
+	// Name is a hostname, whose addresses are backends, or a SRV name (which starts with an underscore, e.g.
+	// _https._tcp.example.com) whose targets are backends
+	Name string `yaml:"name"`
+
+	// Port of the backends of a hostname, the targets of a SRV name have their own (default the backend port)
+	Port int `yaml:"port,omitempty"`
+
+	// Scheme of the backends of a http load balancer, http or https (default http)
+	Scheme string `yaml:"scheme,omitempty"`
 }
 
 // BackEnd is a server we will load balance over
@@ -0,0 +1,303 @@
+package loadbalancer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+)
+
+const (
+	// default size in megabytes an access log file is rotated at
+	defaultAccessLogMaxSize = 100
+	// default number of rotated access log files that are kept
+	defaultAccessLogMaxBackups = 3
+)
+
+// The reasons a connection (or request) was terminated
+const (
+	terminationClientClosed  = "clientClosed"
+	terminationBackendClosed = "backendClosed"
+	terminationClientError   = "clientError"
+	terminationBackendError  = "backendError"
+	terminationNoBackend     = "noBackend"
+	terminationDenied        = "denied"
+	terminationIdleTimeout   = "idleTimeout"
+	terminationTimeout       = "timeout"
+	terminationComplete      = "complete"
+)
+
+// accessLogger writes an entry for every connection (or request) of a load balancer as a line of JSON
+type accessLogger struct {
+	mux        sync.Mutex
+	lb         string
+	out        io.WriteCloser
+	fields     []string
+	sampleRate float64
+}
+
+// accessEntry is the detail of a single connection (or request)
+type accessEntry struct {
+	start       time.Time
+	client      string
+	backend     string
+	bytesIn     int64 // client -> backend
+	bytesOut    int64 // backend -> client
+	termination string
+
+	// HTTP only
+	method string
+	host   string
+	path   string
+	status int
+}
+
+// newAccessLogger - returns the access logger of a load balancer, or nil if access logging isn't enabled
+func newAccessLogger(lb *kubevip.LoadBalancer) (*accessLogger, error) {
+	if lb.AccessLog == nil {
+		return nil, nil
+	}
+	config := lb.AccessLog
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	a := &accessLogger{
+		lb:         lb.Name,
+		fields:     config.Fields,
+		sampleRate: config.SampleRate,
+	}
+	if len(a.fields) == 0 {
+		a.fields = kubevip.AccessLogFields
+	}
+	if a.sampleRate == 0 {
+		a.sampleRate = 1
+	}
+
+	path := config.Path
+	switch path {
+	case "", "stdout", "-":
+		path = "stdout"
+		a.out = nopCloser{os.Stdout}
+	default:
+		maxSize, maxBackups := config.MaxSize, config.MaxBackups
+		if maxSize == 0 {
+			maxSize = defaultAccessLogMaxSize
+		}
+		if maxBackups == 0 {
+			maxBackups = defaultAccessLogMaxBackups
+		}
+		f, err := openRotatingFile(config.Path, int64(maxSize)*1024*1024, maxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to open access log [%s] for load balancer [%s] -> %v", config.Path, lb.Name, err)
+		}
+		a.out = f
+	}
+	log.WithField("lb", lb.Name).Infof("Access logging to [%s] with sample rate [%g]", path, a.sampleRate)
+	return a, nil
+}
+
+// newAccessEntry - starts the entry of a connection (or request) from a client
+func newAccessEntry(client string) *accessEntry {
+	return &accessEntry{start: time.Now(), client: client}
+}
+
+// write - writes the entry of a finished connection, subject to sampling (it is safe to call on a nil logger)
+func (a *accessLogger) write(e *accessEntry) {
+	if a == nil || (a.sampleRate < 1 && rand.Float64() >= a.sampleRate) {
+		return
+	}
+
+	// The fields are written in the configured order, which encoding/json doesn't preserve for maps
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeJSON(&buf, e.start.UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"lb":`)
+	writeJSON(&buf, a.lb)
+	for _, field := range a.fields {
+		var value interface{}
+		switch field {
+		case kubevip.AccessLogClient:
+			value = e.client
+		case kubevip.AccessLogBackend:
+			value = e.backend
+		case kubevip.AccessLogBytesIn:
+			value = e.bytesIn
+		case kubevip.AccessLogBytesOut:
+			value = e.bytesOut
+		case kubevip.AccessLogDuration:
+			value = time.Since(e.start).Seconds()
+		case kubevip.AccessLogTermination:
+			value = e.termination
+		}
+		// HTTP fields are only written for HTTP requests
+		if e.method != "" {
+			switch field {
+			case kubevip.AccessLogMethod:
+				value = e.method
+			case kubevip.AccessLogHost:
+				value = e.host
+			case kubevip.AccessLogPath:
+				value = e.path
+			case kubevip.AccessLogStatus:
+				value = e.status
+			}
+		}
+		if value == nil {
+			continue
+		}
+		buf.WriteString(`,"`)
+		buf.WriteString(field)
+		buf.WriteString(`":`)
+		writeJSON(&buf, value)
+	}
+	buf.WriteString("}\n")
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if _, err := a.out.Write(buf.Bytes()); err != nil {
+		log.WithField("lb", a.lb).Warnf("Unable to write access log [%v]", err)
+	}
+}
+
+// close - closes the output of the access log (it is safe to call on a nil logger)
+func (a *accessLogger) close() error {
+	if a == nil {
+		return nil
+	}
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.out.Close()
+}
+
+func writeJSON(buf *bytes.Buffer, value interface{}) {
+	b, _ := json.Marshal(value)
+	buf.Write(b)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// rotatingFile is a file that is rotated (renamed to path.1, path.2 ...) once it reaches a maximum size
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	// Shift the existing backups, the oldest is overwritten
+	for i := r.maxBackups - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// Write - writes to the file, rotating it first if the write would exceed the maximum size
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close - closes the file
+func (r *rotatingFile) Close() error {
+	return r.file.Close()
+}
+
+// accessResponseWriter records the status and size of a HTTP response
+type accessResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush - allows streamed responses to be flushed through the recorder
+func (w *accessResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack - allows upgraded connections (e.g. websockets) to be proxied through the recorder
+func (w *accessResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("The response writer doesn't support hijacking")
+	}
+	w.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// accessRequestBody records the size of a HTTP request body
+type accessRequestBody struct {
+	io.ReadCloser
+	bytes int64
+}
+
+func (b *accessRequestBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+	return n, err
+}
@@ -0,0 +1,95 @@
+package loadbalancer
+
+import (
+	"expvar"
+	"net"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+	"github.com/sirupsen/logrus"
+)
+
+// connectionsDenied is the number of connections (or requests and UDP sessions) denied by the source lists of
+// each load balancer, exposed through expvar (/debug/vars)
+var connectionsDenied = expvar.NewMap("lb_connections_denied")
+
+// sourceACL allows or denies clients by their source IP
+type sourceACL struct {
+	lb      string
+	allowed []*net.IPNet
+	denied  []*net.IPNet
+}
+
+// newSourceACL - returns the source lists of a load balancer, or nil if any client is allowed
+func newSourceACL(lb *kubevip.LoadBalancer) (*sourceACL, error) {
+	if len(lb.AllowedSources) == 0 && len(lb.DeniedSources) == 0 {
+		return nil, nil
+	}
+	allowed, err := kubevip.ParseSources(lb.AllowedSources)
+	if err != nil {
+		return nil, err
+	}
+	denied, err := kubevip.ParseSources(lb.DeniedSources)
+	if err != nil {
+		return nil, err
+	}
+	return &sourceACL{lb: lb.Name, allowed: allowed, denied: denied}, nil
+}
+
+// permits - returns if a client may connect, a denied client is counted (it is safe to call on nil source lists)
+func (a *sourceACL) permits(addr net.Addr) bool {
+	if a == nil {
+		return true
+	}
+	ip := addrIP(addr)
+	if a.permitsIP(ip) {
+		return true
+	}
+	connectionsDenied.Add(a.lb, 1)
+	log.WithFields(logrus.Fields{"lb": a.lb, "client": addr.String()}).Debugf("Client [%s] isn't allowed by the sources of load balancer [%s]", ip, a.lb)
+	return false
+}
+
+// permitsIP - returns if the IP isn't denied and, when there are allowed sources, is within one of them
+func (a *sourceACL) permitsIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range a.denied {
+		if cidr.Contains(ip) {
+			return false
+		}
+	}
+	if len(a.allowed) == 0 {
+		return true
+	}
+	for _, cidr := range a.allowed {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// addrIP returns the IP of an address, or nil if it has none
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	if addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
+
+// remoteAddr is the address of a HTTP client
+type remoteAddr string
+
+func (a remoteAddr) Network() string { return "tcp" }
+func (a remoteAddr) String() string  { return string(a) }
@@ -0,0 +1,50 @@
+package loadbalancer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+)
+
+func TestSourceACLPermitsIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		denied  []string
+		ip      string
+		want    bool
+	}{
+		{name: "allowed", allowed: []string{"10.0.0.0/8"}, ip: "10.1.2.3", want: true},
+		{name: "not allowed", allowed: []string{"10.0.0.0/8"}, ip: "192.168.0.1", want: false},
+		{name: "denied", denied: []string{"192.168.0.0/16"}, ip: "192.168.0.1", want: false},
+		{name: "not denied", denied: []string{"192.168.0.0/16"}, ip: "10.1.2.3", want: true},
+		{name: "denied within allowed", allowed: []string{"10.0.0.0/8"}, denied: []string{"10.1.0.0/16"}, ip: "10.1.2.3", want: false},
+		{name: "allowed outside denied", allowed: []string{"10.0.0.0/8"}, denied: []string{"10.1.0.0/16"}, ip: "10.2.0.1", want: true},
+		{name: "single address", allowed: []string{"10.0.0.1"}, ip: "10.0.0.1", want: true},
+		{name: "ipv6 allowed", allowed: []string{"fd00::/8"}, ip: "fd00::1", want: true},
+		{name: "ipv4 against ipv6", allowed: []string{"fd00::/8"}, ip: "10.0.0.1", want: false},
+		{name: "no address", allowed: []string{"10.0.0.0/8"}, ip: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acl, err := newSourceACL(&kubevip.LoadBalancer{Name: "test", AllowedSources: tt.allowed, DeniedSources: tt.denied})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := acl.permitsIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("permitsIP(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceACLNil(t *testing.T) {
+	acl, err := newSourceACL(&kubevip.LoadBalancer{Name: "test"})
+	if err != nil || acl != nil {
+		t.Fatalf("newSourceACL() = %v, %v, want nil source lists", acl, err)
+	}
+	if !acl.permits(&net.TCPAddr{IP: net.ParseIP("10.0.0.1")}) {
+		t.Error("nil source lists should permit any client")
+	}
+}
@@ -0,0 +1,189 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+)
+
+const (
+	// defaultAffinityTTL is how long a client stays pinned after its last connection, matching the default of
+	// Kubernetes services with ClientIP session affinity
+	defaultAffinityTTL = 10800 * time.Second
+	// defaultAffinityCookie is the name of the cookie that pins a HTTP client
+	defaultAffinityCookie = "KUBEVIP_BACKEND"
+)
+
+// selectBackend returns the backend (and its address) of the next connection
+type selectBackend func() (*kubevip.BackEnd, string, error)
+
+// sessionAffinity pins clients to the backend they were first sent to, whilst that backend is up
+type sessionAffinity struct {
+	mux     sync.Mutex
+	lb      *kubevip.LoadBalancer
+	config  kubevip.SessionAffinity
+	ttl     time.Duration
+	clients map[string]*affinityEntry
+}
+
+// affinityEntry is the backend a client is pinned to
+type affinityEntry struct {
+	backend  string
+	lastSeen time.Time
+}
+
+// newSessionAffinity - returns the session affinity of a load balancer, or nil if it doesn't have any
+func newSessionAffinity(lb *kubevip.LoadBalancer) (*sessionAffinity, error) {
+	if lb.Affinity == nil {
+		return nil, nil
+	}
+	if err := lb.Affinity.Validate(lb.Type); err != nil {
+		return nil, err
+	}
+	a := &sessionAffinity{
+		lb:      lb,
+		config:  *lb.Affinity,
+		ttl:     time.Duration(lb.Affinity.TTL) * time.Second,
+		clients: make(map[string]*affinityEntry),
+	}
+	if a.config.CookieName == "" {
+		a.config.CookieName = defaultAffinityCookie
+	}
+	if a.ttl == 0 && a.config.Type != kubevip.AffinityCookie {
+		a.ttl = defaultAffinityTTL
+	}
+	return a, nil
+}
+
+// backend - returns the backend the client is pinned to if it is up, otherwise the next backend which the client is
+// then pinned to (it is safe to call on a nil affinity, which always returns the next backend)
+func (a *sessionAffinity) backend(client string, next selectBackend) (*kubevip.BackEnd, string, error) {
+	if a == nil || client == "" {
+		return next()
+	}
+	now := time.Now()
+
+	a.mux.Lock()
+	entry, ok := a.clients[client]
+	if ok {
+		if be := findBackend(a.lb, entry.backend); be != nil && be.IsAlive() {
+			entry.lastSeen = now
+			a.mux.Unlock()
+			return be, entry.backend, nil
+		}
+	}
+	a.mux.Unlock()
+
+	be, ep, err := next()
+	if err != nil {
+		return nil, "", err
+	}
+	a.mux.Lock()
+	if ok {
+		log.WithField("lb", a.lb.Name).Debugf("Client [%s] has moved from backend [%s] to [%s]", client, entry.backend, ep)
+	}
+	a.clients[client] = &affinityEntry{backend: ep, lastSeen: now}
+	a.mux.Unlock()
+	return be, ep, nil
+}
+
+// prune forgets the clients that haven't connected within the TTL (it is safe to call on a nil affinity)
+func (a *sessionAffinity) prune() {
+	if a == nil {
+		return
+	}
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	for client, entry := range a.clients {
+		if time.Since(entry.lastSeen) > a.ttl {
+			delete(a.clients, client)
+		}
+	}
+}
+
+// cookieBackend - returns the backend named by the cookie of the request if it is up, otherwise the next backend
+// which is set as the cookie of the response
+func (a *sessionAffinity) cookieBackend(w http.ResponseWriter, req *http.Request, next selectBackend) (*kubevip.BackEnd, string, error) {
+	if cookie, err := req.Cookie(a.config.CookieName); err == nil {
+		backends := a.lb.CurrentBackends()
+		for x := range backends {
+			be := &backends[x]
+			if ep := backendAddress(be); backendCookie(ep) == cookie.Value && be.IsAlive() {
+				return be, ep, nil
+			}
+		}
+	}
+
+	be, ep, err := next()
+	if err != nil {
+		return nil, "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     a.config.CookieName,
+		Value:    backendCookie(ep),
+		Path:     "/",
+		MaxAge:   int(a.ttl.Seconds()),
+		HttpOnly: true,
+	})
+	return be, ep, nil
+}
+
+// httpBackend - returns the backend of a request, which is pinned by the session affinity of the load balancer
+func (lb *LBInstance) httpBackend(w http.ResponseWriter, req *http.Request) (*kubevip.BackEnd, string, *url.URL, error) {
+	next := lb.roundRobin
+
+	var be *kubevip.BackEnd
+	var ep string
+	var err error
+	switch {
+	case lb.affinity == nil:
+		be, ep, err = next()
+	case lb.affinity.config.Type == kubevip.AffinityCookie:
+		be, ep, err = lb.affinity.cookieBackend(w, req, next)
+	case lb.affinity.config.Type == kubevip.AffinityHeader:
+		be, ep, err = lb.affinity.backend(req.Header.Get(lb.affinity.config.HeaderName), next)
+	default:
+		be, ep, err = lb.affinity.backend(clientIP(remoteAddr(req.RemoteAddr)), next)
+	}
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return be, ep, be.ParsedURL, nil
+}
+
+// nextBackend - returns the backend of the next connection from a client, which is pinned by any source IP affinity
+func (lb *LBInstance) nextBackend(client string) selectBackend {
+	return func() (*kubevip.BackEnd, string, error) {
+		return lb.affinity.backend(client, lb.roundRobin)
+	}
+}
+
+// backendAddress returns the address of a backend
+func backendAddress(be *kubevip.BackEnd) string {
+	return net.JoinHostPort(be.Address, strconv.Itoa(be.Port))
+}
+
+// findBackend returns the backend of a load balancer with the address, or nil if it has been removed
+func findBackend(lb *kubevip.LoadBalancer, endpoint string) *kubevip.BackEnd {
+	backends := lb.CurrentBackends()
+	for x := range backends {
+		if backendAddress(&backends[x]) == endpoint {
+			return &backends[x]
+		}
+	}
+	return nil
+}
+
+// backendCookie returns the cookie of a backend, which identifies it without revealing its address
+func backendCookie(endpoint string) string {
+	h := fnv.New64a()
+	h.Write([]byte(endpoint))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
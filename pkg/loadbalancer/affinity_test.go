@@ -0,0 +1,112 @@
+package loadbalancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+)
+
+func TestSessionAffinityBackend(t *testing.T) {
+	lb := &kubevip.LoadBalancer{Name: "test", Type: "tcp", Affinity: &kubevip.SessionAffinity{Type: kubevip.AffinitySourceIP}, Backends: []kubevip.BackEnd{
+		{Address: "10.0.0.1", Port: 80, Alive: true},
+		{Address: "10.0.0.2", Port: 80, Alive: true},
+	}}
+	a, err := newSessionAffinity(lb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := -1
+	next := func() (*kubevip.BackEnd, string, error) { return lb.ReturnEndpointAddr(&index) }
+
+	_, first, err := a.backend("192.168.0.1", next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, err := a.backend("192.168.0.2", next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == other {
+		t.Fatalf("both clients were sent to [%s], the round robin should spread new clients", first)
+	}
+
+	// A client stays pinned whilst its backend is up
+	for x := 0; x < 3; x++ {
+		if _, ep, _ := a.backend("192.168.0.1", next); ep != first {
+			t.Fatalf("client was sent to [%s], want its pinned backend [%s]", ep, first)
+		}
+	}
+
+	// Once its backend is down the client moves, and is then pinned to its new backend
+	findBackend(lb, first).SetAlive(lb, false)
+	_, moved, err := a.backend("192.168.0.1", next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved == first {
+		t.Fatalf("client is still sent to its down backend [%s]", first)
+	}
+	findBackend(lb, first).SetAlive(lb, true)
+	if _, ep, _ := a.backend("192.168.0.1", next); ep != moved {
+		t.Errorf("client was sent to [%s], want its new backend [%s]", ep, moved)
+	}
+
+	// A client whose backend has been removed moves
+	lb.SetBackends([]kubevip.BackEnd{{Address: "10.0.0.3", Port: 80, Alive: true}})
+	if _, ep, _ := a.backend("192.168.0.1", next); ep != "10.0.0.3:80" {
+		t.Errorf("client was sent to [%s], want the remaining backend", ep)
+	}
+}
+
+func TestSessionAffinityCookie(t *testing.T) {
+	lb := &kubevip.LoadBalancer{Name: "test", Type: "http", Affinity: &kubevip.SessionAffinity{Type: kubevip.AffinityCookie}, Backends: []kubevip.BackEnd{
+		{Address: "10.0.0.1", Port: 80, Alive: true},
+		{Address: "10.0.0.2", Port: 80, Alive: true},
+	}}
+	a, err := newSessionAffinity(lb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := -1
+	next := func() (*kubevip.BackEnd, string, error) { return lb.ReturnEndpointAddr(&index) }
+
+	w := httptest.NewRecorder()
+	_, first, err := a.cookieBackend(w, httptest.NewRequest(http.MethodGet, "/", nil), next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != defaultAffinityCookie {
+		t.Fatalf("response cookies = %v, want the affinity cookie", cookies)
+	}
+
+	// A request with the cookie is sent to the same backend, and isn't given a new cookie
+	for x := 0; x < 3; x++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		if _, ep, _ := a.cookieBackend(w, req, next); ep != first {
+			t.Fatalf("request was sent to [%s], want the backend of its cookie [%s]", ep, first)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Fatal("a request with a valid cookie shouldn't be given a new one")
+		}
+	}
+}
+
+func TestSessionAffinityNil(t *testing.T) {
+	lb := &kubevip.LoadBalancer{Name: "test", Type: "tcp", Backends: []kubevip.BackEnd{
+		{Address: "10.0.0.1", Port: 80, Alive: true},
+		{Address: "10.0.0.2", Port: 80, Alive: true},
+	}}
+	index := -1
+	next := func() (*kubevip.BackEnd, string, error) { return lb.ReturnEndpointAddr(&index) }
+	var a *sessionAffinity
+	_, first, _ := a.backend("192.168.0.1", next)
+	_, second, _ := a.backend("192.168.0.1", next)
+	if first == second {
+		t.Errorf("nil affinity sent the client to [%s] twice, want the round robin", first)
+	}
+}
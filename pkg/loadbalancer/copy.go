@@ -0,0 +1,93 @@
+package loadbalancer
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// copyBufferSize is the size of the pooled buffers used to copy each direction of a connection
+const copyBufferSize = 32 * 1024
+
+// copyBuffers are shared by all connections, rather than allocating a buffer for each direction of each connection
+var copyBuffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, copyBufferSize)
+		return &b
+	},
+}
+
+// copyActivity - copies from src to dst until src closes, returning errIdleTimeout once neither direction of the
+// connection has copied data for the idle timeout, or errTotalTimeout once the connection reaches the total timeout.
+// When both ends are TCP connections and there is no idle timeout the data is spliced between them in the kernel,
+// otherwise it is copied through a pooled buffer.
+func copyActivity(dst, src net.Conn, a *activity) (int64, error) {
+	_, srcTCP := rawConn(src).(*net.TCPConn)
+	dstTCP, dstOK := dst.(*net.TCPConn)
+	if srcTCP && dstOK && a.idle == 0 {
+		return spliceActivity(dstTCP, src, a)
+	}
+	return bufferActivity(dst, src, a)
+}
+
+// spliceActivity copies between TCP connections, which uses splice(2) on Linux (and falls back to a copy elsewhere),
+// a PROXY protocol connection writes out the data it has buffered before splicing from the TCP connection beneath.
+// An idle timeout isn't supported as a spliced write that times out loses the data already read, whereas any total
+// timeout ends the connection
+func spliceActivity(dst *net.TCPConn, src net.Conn, a *activity) (int64, error) {
+	if !a.deadline.IsZero() {
+		src.SetReadDeadline(a.deadline)
+		dst.SetWriteDeadline(a.deadline)
+	}
+	// io.Copy uses the WriterTo of src, which ends in the ReadFrom of dst
+	written, err := io.Copy(dst, src)
+	if err != nil && isTimeout(err) {
+		return written, errTotalTimeout
+	}
+	return written, err
+}
+
+// bufferActivity copies through a pooled buffer
+func bufferActivity(dst, src net.Conn, a *activity) (int64, error) {
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+
+	if a.idle == 0 && a.deadline.IsZero() {
+		// Hiding any ReaderFrom or WriterTo ensures the pooled buffer is used
+		return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+	}
+	var written int64
+	for {
+		src.SetReadDeadline(a.nextDeadline())
+		n, err := src.Read(*buf)
+		if n > 0 {
+			a.touch()
+			dst.SetWriteDeadline(a.nextDeadline())
+			w, werr := dst.Write((*buf)[:n])
+			written += int64(w)
+			if werr != nil {
+				if isTimeout(werr) {
+					if expired := a.expired(); expired != nil {
+						return written, expired
+					}
+					return written, errIdleTimeout
+				}
+				return written, werr
+			}
+			a.touch()
+		}
+		if err != nil {
+			if err == io.EOF {
+				return written, nil
+			}
+			// The other direction may have been active whilst this one waited
+			if isTimeout(err) {
+				if expired := a.expired(); expired != nil {
+					return written, expired
+				}
+				continue
+			}
+			return written, err
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package loadbalancer
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// benchmarkChunk is the data written to the source for each iteration of a benchmark
+const benchmarkChunk = 64 * 1024
+
+// tcpPair returns both ends of a loopback TCP connection
+func tcpPair(b *testing.B) (*net.TCPConn, *net.TCPConn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	server := <-accepted
+	if server == nil {
+		b.Fatal("unable to accept the connection")
+	}
+	return client.(*net.TCPConn), server.(*net.TCPConn)
+}
+
+// benchmarkStream copies b.N chunks from one TCP connection to another, as a single long lived connection does
+func benchmarkStream(b *testing.B, copyFn func(dst, src net.Conn) (int64, error)) {
+	writer, src := tcpPair(b)
+	dst, sink := tcpPair(b)
+	defer src.Close()
+	defer sink.Close()
+
+	go func() {
+		chunk := make([]byte, benchmarkChunk)
+		for i := 0; i < b.N; i++ {
+			if _, err := writer.Write(chunk); err != nil {
+				break
+			}
+		}
+		writer.Close()
+	}()
+	done := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, sink)
+		close(done)
+	}()
+
+	b.SetBytes(benchmarkChunk)
+	b.ReportAllocs()
+	b.ResetTimer()
+	if _, err := copyFn(dst, src); err != nil {
+		b.Fatal(err)
+	}
+	dst.Close()
+	<-done
+}
+
+// benchmarkConnections copies a chunk through a new connection each iteration, as many short lived connections do.
+// The connections are pipes, which can't be spliced
+func benchmarkConnections(b *testing.B, copyFn func(dst, src net.Conn) (int64, error)) {
+	chunk := make([]byte, benchmarkChunk)
+	b.SetBytes(benchmarkChunk)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		writer, src := net.Pipe()
+		dst, sink := net.Pipe()
+		go func() {
+			writer.Write(chunk)
+			writer.Close()
+		}()
+		go func() {
+			io.Copy(io.Discard, sink)
+		}()
+		if _, err := copyFn(dst, src); err != nil {
+			b.Fatal(err)
+		}
+		dst.Close()
+	}
+}
+
+// ioCopy is the forwarding before buffers were pooled and connections spliced, the connections are wrapped so that
+// io.Copy can't use their ReadFrom or WriteTo (which splice) and allocates a buffer for every copy as it did
+func ioCopy(dst, src net.Conn) (int64, error) {
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, make([]byte, 32*1024))
+}
+
+func activityCopy(a *activity) func(dst, src net.Conn) (int64, error) {
+	return func(dst, src net.Conn) (int64, error) {
+		return copyActivity(dst, src, a)
+	}
+}
+
+func BenchmarkCopyStream(b *testing.B) {
+	b.Run("ioCopy", func(b *testing.B) {
+		benchmarkStream(b, ioCopy)
+	})
+	b.Run("splice", func(b *testing.B) {
+		benchmarkStream(b, activityCopy(&activity{}))
+	})
+	b.Run("pooledBuffer", func(b *testing.B) {
+		benchmarkStream(b, func(dst, src net.Conn) (int64, error) {
+			return bufferActivity(dst, src, &activity{})
+		})
+	})
+	b.Run("idleTimeout", func(b *testing.B) {
+		benchmarkStream(b, activityCopy(newActivity(connTimeouts{idle: time.Minute})))
+	})
+}
+
+func BenchmarkCopyConnections(b *testing.B) {
+	b.Run("ioCopy", func(b *testing.B) {
+		benchmarkConnections(b, ioCopy)
+	})
+	b.Run("pooledBuffer", func(b *testing.B) {
+		benchmarkConnections(b, activityCopy(&activity{}))
+	})
+}
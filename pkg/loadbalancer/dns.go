@@ -0,0 +1,349 @@
+package loadbalancer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// defaultDNSRefresh is how often DNS backends are resolved when the TTL of the answers isn't known
+	defaultDNSRefresh = 30 * time.Second
+	// minDNSRefresh and maxDNSRefresh bound the TTL of the answers, so that a zero TTL doesn't resolve constantly
+	minDNSRefresh = 5 * time.Second
+	maxDNSRefresh = 5 * time.Minute
+	// dnsQueryTimeout is how long a nameserver has to answer the query for a TTL
+	dnsQueryTimeout = 2 * time.Second
+	// resolvConf lists the nameservers queried for the TTL of the answers
+	resolvConf = "/etc/resolv.conf"
+)
+
+// dnsBackends resolves the DNS backends of a load balancer, and replaces its backends when the answers change
+type dnsBackends struct {
+	lb         *kubevip.LoadBalancer
+	configured []kubevip.BackEnd // the backends of the configuration, restored when the load balancer stops
+	names      []kubevip.DNSBackend
+	static     []backendSpec
+	refresh    time.Duration // zero if the TTL of the answers is used
+	resolver   *net.Resolver
+	answers    map[string][]backendSpec // the last answer for each name, kept if resolving the name fails
+	resolved   bool                     // the backends have been resolved before
+}
+
+// backendSpec is a backend that is (re)built whenever the backends are replaced
+type backendSpec struct {
+	address string
+	port    int
+	rawURL  string
+}
+
+// newDNSBackends - returns the DNS backends of a load balancer, which includes any backend whose address is a
+// hostname, or nil if it doesn't have any
+func newDNSBackends(lb *kubevip.LoadBalancer) (*dnsBackends, error) {
+	d := &dnsBackends{
+		lb:         lb,
+		configured: lb.CurrentBackends(),
+		refresh:    time.Duration(lb.DNSRefresh) * time.Second,
+		resolver:   net.DefaultResolver,
+		answers:    make(map[string][]backendSpec),
+	}
+	for _, name := range lb.DNSBackends {
+		if err := name.Validate(); err != nil {
+			return nil, err
+		}
+		d.names = append(d.names, name)
+	}
+
+	for x := range d.configured {
+		be := &d.configured[x]
+		name := kubevip.DNSBackend{Name: be.Address, Port: be.Port}
+		if strings.EqualFold(lb.Type, "http") {
+			// The address of a http backend is the host of its URL, an invalid URL is reported when it starts
+			if u, err := url.Parse(be.RawURL); err == nil && u.Host != "" {
+				name.Name, name.Scheme = u.Hostname(), u.Scheme
+				if port, err := strconv.Atoi(u.Port()); err == nil {
+					name.Port = port
+				} else if net.ParseIP(name.Name) == nil {
+					// A resolved backend is given the port of the scheme, which a URL with a hostname relied on
+					name.Port = 80
+					if u.Scheme == "https" {
+						name.Port = 443
+					}
+				}
+			}
+		}
+		if name.Name == "" || net.ParseIP(name.Name) != nil {
+			d.static = append(d.static, backendSpec{address: name.Name, port: name.Port, rawURL: be.RawURL})
+			continue
+		}
+		d.names = append(d.names, name)
+	}
+
+	if len(d.names) == 0 {
+		return nil, nil
+	}
+	return d, nil
+}
+
+// resolve - resolves the DNS backends and replaces the backends of the load balancer if the answers have changed,
+// returning how long until they should be resolved again
+func (d *dnsBackends) resolve(ctx context.Context) time.Duration {
+	ttl := time.Duration(0)
+	for _, name := range d.names {
+		key := name.String()
+		specs, nameTTL, err := d.lookup(ctx, name)
+		if err != nil {
+			log.WithField("lb", d.lb.Name).Warnf("Unable to resolve DNS backend [%s], keeping its previous backends [%v]", key, err)
+			nameTTL = defaultDNSRefresh
+		} else {
+			d.answers[key] = specs
+		}
+		if ttl == 0 || nameTTL < ttl {
+			ttl = nameTTL
+		}
+	}
+	d.update()
+
+	if d.refresh != 0 {
+		return d.refresh
+	}
+	return clampDNSRefresh(ttl)
+}
+
+// clampDNSRefresh bounds the TTL of the answers to how often DNS backends can be resolved
+func clampDNSRefresh(ttl time.Duration) time.Duration {
+	if ttl < minDNSRefresh {
+		return minDNSRefresh
+	}
+	if ttl > maxDNSRefresh {
+		return maxDNSRefresh
+	}
+	return ttl
+}
+
+// run - resolves the DNS backends until the load balancer is stopped, when the backends of the configuration are
+// restored so that they are resolved again if it is restarted
+func (d *dnsBackends) run(ctx context.Context, next time.Duration) {
+	t := time.NewTimer(next)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			d.lb.SetBackends(d.configured)
+			return
+		case <-t.C:
+			t.Reset(d.resolve(ctx))
+		}
+	}
+}
+
+// lookup returns the backends of a name, and the TTL of its answer (or the default if the TTL isn't known)
+func (d *dnsBackends) lookup(ctx context.Context, name kubevip.DNSBackend) ([]backendSpec, time.Duration, error) {
+	var specs []backendSpec
+	add := func(host string, port int) error {
+		addrs, err := d.resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return err
+		}
+		for _, addr := range addrs {
+			spec := backendSpec{address: addr.IP.String(), port: port}
+			if strings.EqualFold(d.lb.Type, "http") {
+				scheme := name.Scheme
+				if scheme == "" {
+					scheme = "http"
+				}
+				spec.rawURL = fmt.Sprintf("%s://%s/", scheme, net.JoinHostPort(spec.address, strconv.Itoa(port)))
+			}
+			specs = append(specs, spec)
+		}
+		return nil
+	}
+
+	if strings.HasPrefix(name.Name, "_") {
+		_, srvs, err := d.resolver.LookupSRV(ctx, "", "", name.Name)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, srv := range srvs {
+			if err := add(srv.Target, int(srv.Port)); err != nil {
+				return nil, 0, err
+			}
+		}
+		return specs, lookupTTL(ctx, name.Name, dnsmessage.TypeSRV), nil
+	}
+
+	port := name.Port
+	if port == 0 {
+		if port = d.lb.BackendPort; port == 0 {
+			port = d.lb.Port
+		}
+	}
+	if err := add(name.Name, port); err != nil {
+		return nil, 0, err
+	}
+	return specs, lookupTTL(ctx, name.Name, dnsmessage.TypeA), nil
+}
+
+// update replaces the backends of the load balancer if they have changed, a backend that is kept keeps its state
+func (d *dnsBackends) update() {
+	specs := append([]backendSpec{}, d.static...)
+	var resolved []backendSpec
+	seen := map[string]bool{}
+	for _, answer := range d.answers {
+		for _, spec := range answer {
+			if ep := net.JoinHostPort(spec.address, strconv.Itoa(spec.port)); !seen[ep] {
+				seen[ep] = true
+				resolved = append(resolved, spec)
+			}
+		}
+	}
+	// The resolved backends are sorted, so that the order of the answers doesn't matter
+	sort.Slice(resolved, func(i, j int) bool {
+		if resolved[i].address != resolved[j].address {
+			return resolved[i].address < resolved[j].address
+		}
+		return resolved[i].port < resolved[j].port
+	})
+	specs = append(specs, resolved...)
+
+	current := map[string]*kubevip.BackEnd{}
+	previous := d.lb.CurrentBackends()
+	for x := range previous {
+		current[backendAddress(&previous[x])] = &previous[x]
+	}
+	changed := len(current) != len(specs)
+	for _, spec := range specs {
+		if _, ok := current[net.JoinHostPort(spec.address, strconv.Itoa(spec.port))]; !ok {
+			changed = true
+		}
+	}
+	if !changed {
+		d.resolved = true
+		return
+	}
+
+	backends := make([]kubevip.BackEnd, len(specs))
+	for x, spec := range specs {
+		ep := net.JoinHostPort(spec.address, strconv.Itoa(spec.port))
+		backends[x].Address, backends[x].Port, backends[x].RawURL = spec.address, spec.port, spec.rawURL
+		backends[x].Alive = true
+		if be, ok := current[ep]; ok {
+			backends[x].Alive = be.IsAlive()
+			delete(current, ep)
+		} else if d.resolved {
+			log.WithField("lb", d.lb.Name).Infof("Backend [%s] has been added by DNS", ep)
+		}
+		if spec.rawURL != "" {
+			backends[x].ParsedURL, _ = url.Parse(spec.rawURL)
+		}
+	}
+	for ep := range current {
+		if d.resolved {
+			log.WithField("lb", d.lb.Name).Infof("Backend [%s] has been removed by DNS", ep)
+		}
+	}
+	d.lb.SetBackends(backends)
+	d.resolved = true
+}
+
+// lookupTTL returns the lowest TTL of the answer to a query for a name, or the default if it isn't known (e.g. the
+// name is in the hosts file or is found through a search domain)
+func lookupTTL(ctx context.Context, name string, qtype dnsmessage.Type) time.Duration {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return defaultDNSRefresh
+	}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(rand.Intn(1 << 16)), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return defaultDNSRefresh
+	}
+
+	for _, server := range nameservers() {
+		ttl, ok := queryTTL(ctx, server, packed, query.Header.ID, qtype)
+		if ok {
+			return ttl
+		}
+	}
+	return defaultDNSRefresh
+}
+
+// queryTTL sends a query to a nameserver, returning the lowest TTL of the records of the type in its answer
+func queryTTL(ctx context.Context, server string, query []byte, id uint16, qtype dnsmessage.Type) (time.Duration, bool) {
+	ctx, cancel := context.WithTimeout(ctx, dnsQueryTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(server, "53"))
+	if err != nil {
+		return 0, false
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	if _, err := conn.Write(query); err != nil {
+		return 0, false
+	}
+	buffer := make([]byte, udpBufferSize)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return 0, false
+	}
+
+	var p dnsmessage.Parser
+	header, err := p.Start(buffer[:n])
+	if err != nil || header.ID != id || header.RCode != dnsmessage.RCodeSuccess {
+		return 0, false
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return 0, false
+	}
+	answers, err := p.AllAnswers()
+	if err != nil {
+		return 0, false
+	}
+	ttl, found := uint32(0), false
+	for _, answer := range answers {
+		if answer.Header.Type != qtype {
+			continue
+		}
+		if !found || answer.Header.TTL < ttl {
+			ttl, found = answer.Header.TTL, true
+		}
+	}
+	return time.Duration(ttl) * time.Second, found
+}
+
+// nameservers returns the nameservers of the resolver configuration
+func nameservers() []string {
+	f, err := os.Open(resolvConf)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
@@ -0,0 +1,165 @@
+package loadbalancer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+)
+
+// backendAddresses returns the addresses of the backends of a load balancer, in order
+func backendAddresses(lb *kubevip.LoadBalancer) []string {
+	var addresses []string
+	backends := lb.CurrentBackends()
+	for x := range backends {
+		addresses = append(addresses, backendAddress(&backends[x]))
+	}
+	return addresses
+}
+
+func equalAddresses(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for x := range got {
+		if got[x] != want[x] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNewDNSBackends(t *testing.T) {
+	tests := []struct {
+		name   string
+		lb     *kubevip.LoadBalancer
+		names  []string
+		static []string
+	}{
+		{
+			name: "addresses only",
+			lb:   &kubevip.LoadBalancer{Type: "tcp", Backends: []kubevip.BackEnd{{Address: "10.0.0.1", Port: 6443}}},
+		},
+		{
+			name:   "hostname backend",
+			lb:     &kubevip.LoadBalancer{Type: "tcp", Backends: []kubevip.BackEnd{{Address: "10.0.0.1", Port: 6443}, {Address: "api.example.com", Port: 6443}}},
+			names:  []string{"api.example.com:6443"},
+			static: []string{"10.0.0.1"},
+		},
+		{
+			name:  "dns backends",
+			lb:    &kubevip.LoadBalancer{Type: "tcp", DNSBackends: []kubevip.DNSBackend{{Name: "_https._tcp.example.com"}}},
+			names: []string{"_https._tcp.example.com"},
+		},
+		{
+			name:   "http URL with a hostname",
+			lb:     &kubevip.LoadBalancer{Type: "http", Backends: []kubevip.BackEnd{{RawURL: "https://api.example.com/"}, {RawURL: "http://10.0.0.1:8080/"}}},
+			names:  []string{"https://api.example.com:443"},
+			static: []string{"10.0.0.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newDNSBackends(tt.lb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.names) == 0 {
+				if d != nil {
+					t.Fatal("a load balancer without hostnames shouldn't have DNS backends")
+				}
+				return
+			}
+			var names, static []string
+			for _, name := range d.names {
+				names = append(names, name.String())
+			}
+			for _, spec := range d.static {
+				static = append(static, spec.address)
+			}
+			if !equalAddresses(names, tt.names) || !equalAddresses(static, tt.static) {
+				t.Errorf("names = %v, static = %v, want %v and %v", names, static, tt.names, tt.static)
+			}
+			if d.refresh != 0 {
+				t.Errorf("refresh = %s, want the TTL of the answers to be used", d.refresh)
+			}
+		})
+	}
+}
+
+func TestClampDNSRefresh(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{ttl: 0, want: minDNSRefresh},
+		{ttl: time.Second, want: minDNSRefresh},
+		{ttl: time.Minute, want: time.Minute},
+		{ttl: time.Hour, want: maxDNSRefresh},
+	}
+	for _, tt := range tests {
+		if got := clampDNSRefresh(tt.ttl); got != tt.want {
+			t.Errorf("clampDNSRefresh(%s) = %s, want %s", tt.ttl, got, tt.want)
+		}
+	}
+}
+
+func TestDNSBackendsUpdate(t *testing.T) {
+	lb := &kubevip.LoadBalancer{Name: "test", Type: "tcp", DNSRefresh: 5, Backends: []kubevip.BackEnd{{Address: "10.0.0.1", Port: 6443, Alive: true}, {Address: "api.example.com", Port: 6443}}}
+	d, err := newDNSBackends(lb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.refresh != 5*time.Second {
+		t.Errorf("refresh = %s, want 5s", d.refresh)
+	}
+
+	// The resolved backends follow the static backends, and are sorted whatever the order of the answers
+	d.answers["api.example.com:6443"] = []backendSpec{{address: "10.0.1.2", port: 6443}, {address: "10.0.1.1", port: 6443}}
+	d.update()
+	want := []string{"10.0.0.1:6443", "10.0.1.1:6443", "10.0.1.2:6443"}
+	if got := backendAddresses(lb); !equalAddresses(got, want) {
+		t.Fatalf("backends = %v, want %v", got, want)
+	}
+
+	// A backend that is kept keeps its state, a new backend is up
+	findBackend(lb, "10.0.1.1:6443").SetAlive(lb, false)
+	d.answers["api.example.com:6443"] = []backendSpec{{address: "10.0.1.1", port: 6443}, {address: "10.0.1.3", port: 6443}}
+	d.update()
+	want = []string{"10.0.0.1:6443", "10.0.1.1:6443", "10.0.1.3:6443"}
+	if got := backendAddresses(lb); !equalAddresses(got, want) {
+		t.Fatalf("backends = %v, want %v", got, want)
+	}
+	if findBackend(lb, "10.0.1.1:6443").IsAlive() {
+		t.Error("a kept backend should keep its state")
+	}
+	if !findBackend(lb, "10.0.1.3:6443").IsAlive() {
+		t.Error("a new backend should be up")
+	}
+
+	// The same answers don't replace the backends
+	before := &lb.CurrentBackends()[0]
+	d.update()
+	if &lb.CurrentBackends()[0] != before {
+		t.Error("unchanged answers shouldn't replace the backends")
+	}
+}
+
+func TestDNSBackendsRestore(t *testing.T) {
+	lb := &kubevip.LoadBalancer{Name: "test", Type: "tcp", Backends: []kubevip.BackEnd{{Address: "api.example.com", Port: 6443}}}
+	d, err := newDNSBackends(lb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.answers["api.example.com:6443"] = []backendSpec{{address: "10.0.1.1", port: 6443}}
+	d.update()
+
+	// Once the load balancer stops the configured backends are restored, so they are resolved when it restarts
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	d.run(ctx, time.Hour)
+	if got, want := backendAddresses(lb), []string{"api.example.com:6443"}; !equalAddresses(got, want) {
+		t.Errorf("backends = %v, want %v", got, want)
+	}
+}
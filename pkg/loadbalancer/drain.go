@@ -0,0 +1,100 @@
+package loadbalancer
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// httpShutdownTimeout is how long a stopped http load balancer waits for its active requests
+const httpShutdownTimeout = 5 * time.Second
+
+// connTracker tracks the active connections of a load balancer, so that they can be drained when it is stopped
+type connTracker struct {
+	mux   sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{conns: make(map[net.Conn]struct{})}
+}
+
+// add - starts tracking a connection
+func (t *connTracker) add(conn net.Conn) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.conns[conn] = struct{}{}
+	t.wg.Add(1)
+}
+
+// done - stops tracking a connection once it has finished
+func (t *connTracker) done(conn net.Conn) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if _, ok := t.conns[conn]; ok {
+		delete(t.conns, conn)
+		t.wg.Done()
+	}
+}
+
+// wait - waits for the active connections to finish, returning false if they haven't within the timeout
+func (t *connTracker) wait(timeout time.Duration) bool {
+	finished := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// closeAll - closes the active connections, returning how many there were
+func (t *connTracker) closeAll() int {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	for conn := range t.conns {
+		conn.Close()
+	}
+	return len(t.conns)
+}
+
+//Drain - stops the load balancer accepting new connections and waits for the active connections to finish, any
+//that are still active after the timeout are closed, then the load balancer is stopped
+func (l *LBInstance) Drain(timeout time.Duration) error {
+	l.drainTimeout = timeout
+	// Cancelling the context closes the listeners
+	l.cancel()
+	if !l.conns.wait(timeout) {
+		closed := l.conns.closeAll()
+		log.WithField("lb", l.instance.Name).Warnf("Closed [%d] connections still active after draining for [%s]", closed, timeout)
+	}
+	return l.Stop()
+}
+
+//DrainAll - drains all of the load balancers at once (see Drain)
+func (lm *LBManager) DrainAll(timeout time.Duration) error {
+	lm.mux.Lock()
+	defer lm.mux.Unlock()
+	log.Debugf("Draining [%d] loadbalancer instances", len(lm.loadBalancer))
+
+	errs := make(chan error, len(lm.loadBalancer))
+	for x := range lm.loadBalancer {
+		go func(l *LBInstance) {
+			errs <- l.Drain(timeout)
+		}(lm.loadBalancer[x])
+	}
+	var err error
+	for range lm.loadBalancer {
+		if e := <-errs; e != nil {
+			err = e
+		}
+	}
+	// Reset the loadbalancer entries
+	lm.loadBalancer = nil
+	return err
+}
@@ -1,17 +1,17 @@
 package loadbalancer
 
 import (
-	"io"
+	"errors"
 	"net"
 	"sync"
 
 	"github.com/pires/go-proxyproto"
 	"github.com/plunder-app/kube-vip/pkg/kubevip"
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 )
 
 // proxy protocol version, default 2
-const proxyProtocolVersion = 2
+const defaultProxyProtocolVersion = 2
 
 // 1. Load balancer port is exposed
 // 2. We listen
@@ -23,87 +23,100 @@ const proxyProtocolVersion = 2
 // 7. We write response to load balancer
 // [goto loop]
 
-func persistentConnection(frontendConnection net.Conn, lb *kubevip.LoadBalancer, backendIndex *int) {
+func (lb *LBInstance) persistentConnection(frontendConnection net.Conn, next selectBackend) {
 
 	var endpoint net.Conn
 	// Makes sure we close the connections to the endpoint when we've completed
 	defer frontendConnection.Close()
+	connLog := log.WithFields(logrus.Fields{"lb": lb.instance.Name, "client": frontendConnection.RemoteAddr().String()})
 
-	for {
+	// The access log entry is written once the connection has finished
+	entry := newAccessEntry(frontendConnection.RemoteAddr().String())
+	defer lb.accessLog.write(entry)
+
+	timeouts := newConnTimeouts(lb.instance)
+	timeouts.setKeepAlive(frontendConnection)
+
+	// Each backend is tried once, as a backend failing its TLS handshake fails straight away
+	for attempt := 0; ; attempt++ {
+		if attempt != 0 && attempt >= len(lb.instance.CurrentBackends()) {
+			connLog.Errorf("All Backends have failed")
+			entry.termination = terminationNoBackend
+			return
+		}
 
 		// Connect to Endpoint
-		be, ep, err := lb.ReturnEndpointAddr(backendIndex)
+		be, ep, err := next()
 		if err != nil {
-			log.Errorf("No Backends available")
+			connLog.Errorf("No Backends available")
+			entry.termination = terminationNoBackend
 			return
 		}
 
-		// We now dial to an endpoint with a timeout of half a second
-		// TODO - make this adjustable
-		endpoint, err = net.DialTimeout("tcp", ep, dialTMOUT)
+		// A backend that is pinned to the client (or became full since it was chosen) may have no room for it
+		if !lb.outliers.acquire(ep) {
+			connLog.WithField("backend", ep).Warnf("Backend [%s] is at its connection limit", ep)
+			continue
+		}
+
+		// We now dial to an endpoint with the connect timeout (default half a second)
+		endpoint, err = lb.dialBackend(connLog, timeouts, frontendConnection, ep)
 		if err != nil {
-			be.SetAlive(lb, false)
-			log.Debugf("unreachable, error: %v", err)
-			log.Warnf("[%s]---X [FAILED] X-->[%s]", frontendConnection.RemoteAddr(), ep)
+			lb.outliers.release(ep)
+			lb.outliers.failure(lb.instance, be, ep)
+			connLog.WithField("backend", ep).Debugf("unreachable, error: %v", err)
+			connLog.WithField("backend", ep).Warnf("[%s]---X [FAILED] X-->[%s]", frontendConnection.RemoteAddr(), ep)
 		} else {
-			log.Debugf("[%s]---->[ACCEPT]---->[%s]", frontendConnection.RemoteAddr(), ep)
+			lb.outliers.success(ep)
+			connLog = connLog.WithField("backend", ep)
+			connLog.Debugf("[%s]---->[ACCEPT]---->[%s]", frontendConnection.RemoteAddr(), ep)
+			entry.backend = ep
 			defer endpoint.Close()
+			defer lb.outliers.release(ep)
 			break
 		}
 	}
 
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-
-	// Begin copying incoming (frontend -> to an endpoint)
-	go func() {
-		writeProxyProtocol(lb.EnableProxyProtocol, endpoint, frontendConnection)
-		bytes, err := io.Copy(endpoint, frontendConnection)
-		log.Debugf("[%d] bytes of data sent to endpoint", bytes)
-		if err != nil {
-			log.Warnf("Error sending data to endpoint [%s] [%v]", endpoint.RemoteAddr(), err)
+	// The termination reason is whichever side of the connection finished first, or the timeout or error that
+	// ended a half-closed connection
+	var termMux sync.Mutex
+	halfClosed := false
+	terminate := func(reason string, half bool) {
+		termMux.Lock()
+		defer termMux.Unlock()
+		if entry.termination == "" || (halfClosed && !half) {
+			entry.termination, halfClosed = reason, half
 		}
-		wg.Done()
-	}()
-	// go func() {
-	// Begin copying recieving (endpoint -> back to frontend)
-	bytes, err := io.Copy(frontendConnection, endpoint)
-	log.Debugf("[%d] bytes of data sent to client", bytes)
-	if err != nil {
-		log.Warnf("Error sending data to frontend [%s] [%s]", frontendConnection.RemoteAddr(), err)
 	}
-	// 	wg.Done()
-	// 	endpoint.Close()
-	// }()
-	wg.Wait()
-}
-
-func persistentUDPConnection(frontendConnection net.Conn, lb *kubevip.LoadBalancer, backendIndex *int) {
-
-	var endpoint net.Conn
-	// Makes sure we close the connections to the endpoint when we've completed
-	defer frontendConnection.Close()
 
-	for {
-
-		// Connect to Endpoint
-		be, ep, err := lb.ReturnEndpointAddr(backendIndex)
-		if err != nil {
-			log.Errorf("No Backends available")
-			return
-		}
-
-		// We now dial to an endpoint with a timeout of half a second
-		// TODO - make this adjustable
-		endpoint, err = net.DialTimeout("udp", ep, dialTMOUT)
-		if err != nil {
-			be.SetAlive(lb, false)
-			log.Debugf("unreachable, error: %v", err)
-			log.Warnf("[%s]---X [FAILED] X-->[%s]", frontendConnection.RemoteAddr(), ep)
-		} else {
-			log.Debugf("[%s]---->[ACCEPT]---->[%s]", frontendConnection.RemoteAddr(), ep)
-			defer endpoint.Close()
-			break
+	// Closing both connections stops the copying in both directions
+	var closed sync.Once
+	closeBoth := func() {
+		closed.Do(func() {
+			frontendConnection.Close()
+			endpoint.Close()
+		})
+	}
+	connActivity := newActivity(timeouts)
+
+	// finish ends one direction of the connection, once its source has closed the destination is half-closed so
+	// the other direction can still finish, otherwise the whole connection is closed
+	finish := func(dst net.Conn, err error, closedReason, errorReason string) {
+		switch err {
+		case nil:
+			terminate(closedReason, true)
+			if closeWrite(dst) != nil {
+				closeBoth()
+			}
+		case errIdleTimeout:
+			terminate(terminationIdleTimeout, false)
+			closeBoth()
+		case errTotalTimeout:
+			terminate(terminationTimeout, false)
+			closeBoth()
+		default:
+			terminate(errorReason, false)
+			closeBoth()
 		}
 	}
 
@@ -112,37 +125,58 @@ func persistentUDPConnection(frontendConnection net.Conn, lb *kubevip.LoadBalanc
 
 	// Begin copying incoming (frontend -> to an endpoint)
 	go func() {
-		writeProxyProtocol(lb.EnableProxyProtocol, endpoint, frontendConnection)
-		bytes, err := io.Copy(endpoint, frontendConnection)
-		log.Debugf("[%d] bytes of data sent to endpoint", bytes)
-		if err != nil {
-			log.Warnf("Error sending data to endpoint [%s] [%v]", endpoint.RemoteAddr(), err)
+		bytes, err := copyActivity(endpoint, frontendConnection, connActivity)
+		entry.bytesIn = bytes
+		connLog.Debugf("[%d] bytes of data sent to endpoint", bytes)
+		if err != nil && err != errIdleTimeout && err != errTotalTimeout && !errors.Is(err, net.ErrClosed) {
+			connLog.Warnf("Error sending data to endpoint [%s] [%v]", endpoint.RemoteAddr(), err)
 		}
+		finish(endpoint, err, terminationClientClosed, terminationClientError)
 		wg.Done()
 	}()
-	// go func() {
+
 	// Begin copying recieving (endpoint -> back to frontend)
-	bytes, err := io.Copy(frontendConnection, endpoint)
-	log.Debugf("[%d] bytes of data sent to client", bytes)
-	if err != nil {
-		log.Warnf("Error sending data to frontend [%s] [%s]", frontendConnection.RemoteAddr(), err)
+	bytes, err := copyActivity(frontendConnection, endpoint, connActivity)
+	entry.bytesOut = bytes
+	connLog.Debugf("[%d] bytes of data sent to client", bytes)
+	if err != nil && err != errIdleTimeout && err != errTotalTimeout && !errors.Is(err, net.ErrClosed) {
+		connLog.Warnf("Error sending data to frontend [%s] [%s]", frontendConnection.RemoteAddr(), err)
 	}
-	// 	wg.Done()
-	// 	endpoint.Close()
-	// }()
+	finish(frontendConnection, err, terminationBackendClosed, terminationBackendError)
 	wg.Wait()
+	if entry.termination == terminationIdleTimeout || entry.termination == terminationTimeout {
+		connLog.Debugf("Connection closed by the [%s]", entry.termination)
+	}
 }
 
 // http://www.haproxy.org/download/1.8/doc/proxy-protocol.txt
 // https://github.com/pires/go-proxyproto/blob/main/header.go#L53
-func writeProxyProtocol (enableProxyProtocol bool, dst, src net.Conn)  {
-	if !enableProxyProtocol {
+// The addresses are those of the source connection, which are the original addresses if it arrived with a PROXY
+// protocol header
+func writeProxyProtocol(connLog *logrus.Entry, lb *kubevip.LoadBalancer, dst, src net.Conn) {
+	if !lb.EnableProxyProtocol {
 		return
 	}
-	header := proxyproto.HeaderProxyFromAddrs(proxyProtocolVersion, src.RemoteAddr(), src.LocalAddr())
+	version := defaultProxyProtocolVersion
+	if lb.ProxyProtocolVersion != 0 {
+		version = lb.ProxyProtocolVersion
+	}
+	header := proxyproto.HeaderProxyFromAddrs(byte(version), src.RemoteAddr(), src.LocalAddr())
+
+	// Pass through the TLVs of an incoming header
+	if pc, ok := src.(*proxyproto.Conn); ok && lb.ProxyProtocolTLVs && version == 2 && pc.ProxyHeader() != nil {
+		tlvs, err := pc.ProxyHeader().TLVs()
+		if err == nil {
+			err = header.SetTLVs(tlvs)
+		}
+		if err != nil {
+			connLog.Warnf("Unable to pass the proxyproto TLVs to endpoint [%s] [%v]", dst.RemoteAddr(), err)
+		}
+	}
+
 	bytes, err := header.WriteTo(dst)
-	log.Debugf("[%d] bytes of proxyproto data sent to endpoint", bytes)
+	connLog.Debugf("[%d] bytes of proxyproto data sent to endpoint", bytes)
 	if err != nil {
-		log.Warnf("Error sending proxyproto data to endpoint [%s] [%v]", dst.RemoteAddr(), err)
+		connLog.Warnf("Error sending proxyproto data to endpoint [%s] [%v]", dst.RemoteAddr(), err)
 	}
 }
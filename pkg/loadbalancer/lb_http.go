@@ -6,42 +6,96 @@ import (
 	"net"
 	"net/http"
 	"net/http/httputil"
-	"time"
+	"strconv"
 
 	"github.com/plunder-app/kube-vip/pkg/kubevip"
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 )
 
 func (lb *LBInstance) startHTTP(bindAddress string) error {
-	frontEnd := fmt.Sprintf("%s:%d", bindAddress, lb.instance.Port)
-	log.Infof("Starting HTTP Load Balancer for service [%s]", frontEnd)
+	frontEnd := net.JoinHostPort(bindAddress, strconv.Itoa(lb.instance.Port))
+	log.WithField("lb", lb.instance.Name).Infof("Starting HTTP Load Balancer for service [%s]", frontEnd)
 
 	// Validate the back end URLS
-	err := kubevip.ValidateBackEndURLS(&lb.instance.Backends)
+	backends := lb.instance.CurrentBackends()
+	err := kubevip.ValidateBackEndURLS(&backends)
 	if err != nil {
 		return err
 	}
+	// The transport is shared by the requests, so connections to the backends are reused
+	transport := lb.upstreamTransport()
+
+	handler := func(rw http.ResponseWriter, req *http.Request) {
+		// The access log entry is written once the request has finished
+		w := &accessResponseWriter{ResponseWriter: rw}
+		entry := newAccessEntry(req.RemoteAddr)
+		entry.method, entry.host, entry.path = req.Method, req.Host, req.URL.Path
+		var body *accessRequestBody
+		if lb.accessLog != nil && req.Body != nil {
+			body = &accessRequestBody{ReadCloser: req.Body}
+			req.Body = body
+		}
+		defer func() {
+			if body != nil {
+				entry.bytesIn = body.bytes
+			}
+			entry.bytesOut, entry.status = w.bytes, w.status
+			if entry.status == 0 {
+				// Nothing was written, the server replies with an empty 200
+				entry.status = http.StatusOK
+			}
+			if entry.termination == "" {
+				entry.termination = terminationComplete
+				if req.Context().Err() != nil {
+					entry.termination = terminationClientClosed
+				}
+			}
+			lb.accessLog.write(entry)
+		}()
+
+		// The remote address is the client from any PROXY protocol header
+		if !lb.acl.permits(remoteAddr(req.RemoteAddr)) {
+			entry.termination = terminationDenied
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
 
-	handler := func(w http.ResponseWriter, req *http.Request) {
 		// get endpoint
-		be, ep, epURL, err := lb.instance.ReturnEndpointURL(lb.backendIndex)
+		be, ep, epURL, err := lb.httpBackend(w, req)
 		if err != nil {
-			log.Errorf("No Backends available")
+			log.WithFields(logrus.Fields{"lb": lb.instance.Name, "client": req.RemoteAddr}).Errorf("No Backends available")
+			entry.termination = terminationNoBackend
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		entry.backend = ep
+		reqLog := log.WithFields(logrus.Fields{"lb": lb.instance.Name, "backend": ep, "client": req.RemoteAddr})
+		// A backend that is pinned to the client (or became full since it was chosen) may have no room for it
+		if !lb.outliers.acquire(ep) {
+			reqLog.Warnf("Backend [%s] is at its connection limit", ep)
+			entry.termination = terminationNoBackend
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
 			return
 		}
+		defer lb.outliers.release(ep)
 		conn, err := net.DialTimeout("tcp", ep, dialTMOUT)
+		dialed := err == nil
 		if err != nil {
-			be.SetAlive(lb.instance, false)
-			log.Debugf("unreachable, error: %v", err)
+			lb.outliers.failure(lb.instance, be, ep)
+			reqLog.Debugf("unreachable, error: %v", err)
 		} else {
 			conn.Close()
 		}
 
 		// create the reverse proxy
 		proxy := httputil.NewSingleHostReverseProxy(epURL)
+		proxy.Transport = transport
 		proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
-			log.Warnf("proxy, error: %v", err)
-			be.SetAlive(lb.instance, false)
+			reqLog.Warnf("proxy, error: %v", err)
+			entry.termination = terminationBackendError
+			if lb.outliers == nil {
+				be.SetAlive(lb.instance, false)
+			}
 			w.WriteHeader(http.StatusBadGateway)
 			fmt.Fprintf(w, http.StatusText(http.StatusBadGateway))
 		}
@@ -56,18 +110,27 @@ func (lb *LBInstance) startHTTP(bindAddress string) error {
 		req.Host = epURL.Host
 
 		// Print out the response (if debug logging)
-		if log.GetLevel() >= log.DebugLevel {
-			log.Debugf("Host: %s", req.Host)
-			log.Debugf("Request: %s", req.Method)
-			log.Debugf("URI: %s", req.RequestURI)
+		if log.Logger.IsLevelEnabled(logrus.DebugLevel) {
+			reqLog.Debugf("Host: %s", req.Host)
+			reqLog.Debugf("Request: %s", req.Method)
+			reqLog.Debugf("URI: %s", req.RequestURI)
 
 			for key, value := range req.Header {
-				log.Debugf("Header: %s, Value: %s", key, value)
+				reqLog.Debugf("Header: %s, Value: %s", key, value)
 			}
 		}
 
 		// Note that ServeHttp is non blocking and uses a go routine under the hood
 		proxy.ServeHTTP(w, req)
+
+		// Server errors count towards ejecting the backend, unless the client went away or the dial already failed
+		if lb.outliers != nil && dialed && req.Context().Err() == nil {
+			if entry.termination == terminationBackendError || w.status >= http.StatusInternalServerError {
+				lb.outliers.failure(lb.instance, be, ep)
+			} else {
+				lb.outliers.success(ep)
+			}
+		}
 	}
 
 	mux := http.NewServeMux()
@@ -75,31 +138,51 @@ func (lb *LBInstance) startHTTP(bindAddress string) error {
 	log.Infof("Starting server listening [%s]", lb.instance.Name)
 
 	server := &http.Server{Addr: frontEnd, Handler: mux}
+	listeners, err := lb.listen(frontEnd)
+	if err != nil {
+		return err
+	}
 
-	go func() error {
-		if err := server.ListenAndServe(); err != nil {
-			return err
-		}
-		return nil
-	}()
+	// The client behind a proxy is only known from its PROXY protocol header, so its requests are checked instead
+	acl := lb.acl
+	if lb.instance.AcceptProxyProtocol {
+		acl = nil
+	}
+	for _, listener := range listeners {
+		go func(listener net.Listener) error {
+			// Connections that are denied or exceed the limits are closed before they reach the server
+			if err := server.Serve(lb.proxyListener(&limitListener{Listener: listener, acl: acl, limiter: lb.limiter})); err != nil {
+				return err
+			}
+			return nil
+		}(listener)
+	}
 
-	// If the stop channel is closed then the server will be gracefully shut down
-	<-lb.stop
-	log.Infof("Stopping the load balancer [%s] bound to [%s] with 5sec timeout", lb.instance.Name, frontEnd)
+	// If the load balancer is stopped then the server will be gracefully shut down, waiting for the active requests
+	// (for the drain timeout if it is being drained) before closing them
+	go func() {
+		<-lb.ctx.Done()
+		timeout := httpShutdownTimeout
+		if lb.drainTimeout > 0 {
+			timeout = lb.drainTimeout
+		}
+		log.WithField("lb", lb.instance.Name).Infof("Stopping the load balancer [%s] bound to [%s] with [%s] timeout", lb.instance.Name, frontEnd, timeout)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := server.Shutdown(ctx); err != nil {
-		return err
-	}
-	close(lb.stopped)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.WithField("lb", lb.instance.Name).Warnf("Closing the requests still active after [%s]", timeout)
+			server.Close()
+		}
+		close(lb.stopped)
+	}()
 	return nil
 }
 
 //StartHTTP - begins the HTTP load balancer
 func StartHTTP(lb *kubevip.LoadBalancer, address string) error {
-	frontEnd := fmt.Sprintf("%s:%d", address, lb.Port)
-	log.Infof("Starting HTTP Load Balancer for service [%s]", frontEnd)
+	frontEnd := net.JoinHostPort(address, strconv.Itoa(lb.Port))
+	log.WithField("lb", lb.Name).Infof("Starting HTTP Load Balancer for service [%s]", frontEnd)
 
 	// Validate the back end URLS
 	err := kubevip.ValidateBackEndURLS(&lb.Backends)
@@ -111,13 +194,15 @@ func StartHTTP(lb *kubevip.LoadBalancer, address string) error {
 		// get endpoint
 		be, ep, epURL, err := lb.ReturnEndpointURL(nil)
 		if err != nil {
-			log.Errorf("No Backends available")
+			log.WithFields(logrus.Fields{"lb": lb.Name, "client": req.RemoteAddr}).Errorf("No Backends available")
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
 			return
 		}
+		reqLog := log.WithFields(logrus.Fields{"lb": lb.Name, "backend": ep, "client": req.RemoteAddr})
 		conn, err := net.DialTimeout("tcp", ep, dialTMOUT)
 		if err != nil {
 			be.SetAlive(lb, false)
-			log.Debugf("unreachable, error: %v", err)
+			reqLog.Debugf("unreachable, error: %v", err)
 		} else {
 			conn.Close()
 		}
@@ -125,7 +210,7 @@ func StartHTTP(lb *kubevip.LoadBalancer, address string) error {
 		// create the reverse proxy
 		proxy := httputil.NewSingleHostReverseProxy(epURL)
 		proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
-			log.Warnf("proxy, error: %v", err)
+			reqLog.Warnf("proxy, error: %v", err)
 			be.SetAlive(lb, false)
 			w.WriteHeader(http.StatusBadGateway)
 			fmt.Fprintf(w, http.StatusText(http.StatusBadGateway))
@@ -141,13 +226,13 @@ func StartHTTP(lb *kubevip.LoadBalancer, address string) error {
 		req.Host = epURL.Host
 
 		// Print out the response (if debug logging)
-		if log.GetLevel() >= log.DebugLevel {
-			log.Debugf("Host: %s", req.Host)
-			log.Debugf("Request: %s", req.Method)
-			log.Debugf("URI: %s", req.RequestURI)
+		if log.Logger.IsLevelEnabled(logrus.DebugLevel) {
+			reqLog.Debugf("Host: %s", req.Host)
+			reqLog.Debugf("Request: %s", req.Method)
+			reqLog.Debugf("URI: %s", req.RequestURI)
 
 			for key, value := range req.Header {
-				log.Debugf("Header: %s, Value: %s", key, value)
+				reqLog.Debugf("Header: %s, Value: %s", key, value)
 			}
 		}
 
@@ -5,70 +5,95 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/pires/go-proxyproto"
 	"github.com/plunder-app/kube-vip/pkg/kubevip"
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 )
 
 // StartTCP a TCP load balancer server instane
 func (lb *LBInstance) startTCP(bindAddress string) error {
-	fullAddress := fmt.Sprintf("%s:%d", bindAddress, lb.instance.Port)
-	log.Infof("Starting TCP Load Balancer for service [%s]", fullAddress)
+	fullAddress := net.JoinHostPort(bindAddress, strconv.Itoa(lb.instance.Port))
+	log.WithField("lb", lb.instance.Name).Infof("Starting TCP Load Balancer for service [%s]", fullAddress)
 
-	laddr, err := net.ResolveTCPAddr("tcp", fullAddress)
-	if nil != err {
-		log.Errorln(err)
+	listeners, err := lb.listen(fullAddress)
+	if err != nil {
+		return err
 	}
-	l, err := net.ListenTCP("tcp", laddr)
-	if nil != err {
-		return fmt.Errorf("Unable to bind [%s]", err.Error())
+
+	// Each listener has its own accept goroutine, which returns once the listener is closed
+	wg := &sync.WaitGroup{}
+	for _, l := range listeners {
+		wg.Add(1)
+		go func(listener net.Listener) {
+			lb.accept(listener, lb.handleConnection)
+			wg.Done()
+		}(lb.proxyListener(l))
 	}
 	go func() {
-		for {
-			select {
-
-			case <-lb.stop:
-				log.Debugf("Closing the load balancer [%s]", lb.instance.Name)
-
-				// We've closed the stop channel
-				err = l.Close()
-				if err != nil {
-					return
-				}
-				// Close the stopped channel as the listener has been stopped
-				close(lb.stopped)
-			default:
-
-				err = l.SetDeadline(time.Now().Add(200 * time.Millisecond))
-				if err != nil {
-					log.Errorf("Error setting TCP deadline", err)
-				}
-				fd, err := l.Accept()
-				if err != nil {
-					// Check it it's an accept timeout
-					if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
-						continue
-					} else if err != io.EOF {
-						log.Errorf("TCP Accept error [%s]", err)
-					}
-				}
-				go persistentConnection(fd, lb.instance, lb.backendIndex)
-			}
+		<-lb.ctx.Done()
+		log.WithField("lb", lb.instance.Name).Debugf("Closing the load balancer [%s]", lb.instance.Name)
+		for _, l := range listeners {
+			l.Close()
 		}
+		wg.Wait()
+		// Close the stopped channel as the listeners have been stopped
+		close(lb.stopped)
 	}()
-	log.Infof("Load Balancer [%s] started", lb.instance.Name)
+	log.WithField("lb", lb.instance.Name).Infof("Load Balancer [%s] started with [%d] listener(s)", lb.instance.Name, len(listeners))
 
 	return nil
 }
 
+// handleConnection proxies a connection to a backend, unless it exceeds the connection limits or the client isn't
+// allowed by the source lists
+func (lb *LBInstance) handleConnection(fd net.Conn) {
+	// The connection is tracked so that it can be drained
+	lb.conns.add(fd)
+	defer lb.conns.done(fd)
+
+	// The limits apply to the connection itself, rather than a client behind a proxy
+	peer := fd.RemoteAddr()
+	pc, proxied := fd.(*proxyproto.Conn)
+	if proxied {
+		peer = pc.Raw().RemoteAddr()
+	}
+	// A denied client doesn't take a place within the limits, a client behind a proxy is checked once its
+	// PROXY protocol header has been read
+	if !proxied && !lb.acl.permits(peer) {
+		fd.Close()
+		return
+	}
+	release, accepted := lb.limiter.acquire(peer)
+	if !accepted {
+		fd.Close()
+		return
+	}
+	defer release()
+
+	// The remote address is the client from any PROXY protocol header
+	if err := proxyHeaderError(fd); err != nil {
+		log.WithFields(logrus.Fields{"lb": lb.instance.Name, "client": peer.String()}).Warnf("Invalid proxy protocol header [%v]", err)
+		fd.Close()
+		return
+	}
+	if proxied && !lb.acl.permits(fd.RemoteAddr()) {
+		fd.Close()
+		return
+	}
+	lb.persistentConnection(fd, lb.nextBackend(clientIP(fd.RemoteAddr())))
+}
+
 // startTCPDNU - Start TCP service Do not use
 // This stops the service by closing the listener and then ignorning the error from Accept()
 func (lb *LBInstance) startTCPDNU(bindAddress string) error {
-	fullAddress := fmt.Sprintf("%s:%d", bindAddress, lb.instance.Port)
-	log.Infof("Starting TCP Load Balancer for service [%s]", fullAddress)
+	fullAddress := net.JoinHostPort(bindAddress, strconv.Itoa(lb.instance.Port))
+	log.WithField("lb", lb.instance.Name).Infof("Starting TCP Load Balancer for service [%s]", fullAddress)
 
-	//l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", bindAddress, lb.instance.Port))
+	//l, err := net.Listen("tcp", net.JoinHostPort(bindAddress, strconv.Itoa(lb.instance.Port)))
 	laddr, err := net.ResolveTCPAddr("tcp", fullAddress)
 	if nil != err {
 		log.Errorln(err)
@@ -79,7 +104,7 @@ func (lb *LBInstance) startTCPDNU(bindAddress string) error {
 	}
 	go func() {
 		<-lb.stop
-		log.Debugf("Closing the load balancer [%s]", lb.instance.Name)
+		log.WithField("lb", lb.instance.Name).Debugf("Closing the load balancer [%s]", lb.instance.Name)
 
 		// We've closed the stop channel
 		err = l.Close()
@@ -100,16 +125,17 @@ func (lb *LBInstance) startTCPDNU(bindAddress string) error {
 				if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
 					continue
 				} else if err != io.EOF {
-					log.Errorf("TCP Accept error [%s]", err)
+					log.WithField("lb", lb.instance.Name).Errorf("TCP Accept error [%s]", err)
 					return
 				}
+				continue
 			}
-			go persistentConnection(fd, lb.instance, lb.backendIndex)
+			go lb.handleConnection(fd)
 			//go processRequests(lb.instance, lb.backendIndex, fd)
 		}
 		//	}
 	}()
-	log.Infof("Load Balancer [%s] started", lb.instance.Name)
+	log.WithField("lb", lb.instance.Name).Infof("Load Balancer [%s] started", lb.instance.Name)
 
 	return nil
 }
@@ -152,7 +178,7 @@ func processRequests(lb *kubevip.LoadBalancer, backendIndex *int, frontendConnec
 		// Set a timeout
 		endpoint.SetReadDeadline(time.Now().Add(time.Second * 1))
 
-		writeProxyProtocol(lb.EnableProxyProtocol, endpoint, frontendConnection)
+		writeProxyProtocol(log.WithFields(logrus.Fields{"lb": lb.Name, "backend": ep}), lb, endpoint, frontendConnection)
 		b, err := endpointRequest(endpoint, ep, string(data))
 
 		_, err = frontendConnection.Write(b)
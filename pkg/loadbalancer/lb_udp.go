@@ -1,103 +1,188 @@
 package loadbalancer
 
 import (
-	"fmt"
 	"net"
+	"strconv"
+	"sync"
+	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 )
 
-// StartTCP a TCP load balancer server instane
+const (
+	// udpSessionTimeout is how long a client session is kept without any datagrams in either direction
+	udpSessionTimeout = 60 * time.Second
+	// udpBufferSize is large enough for any UDP datagram
+	udpBufferSize = 65535
+)
+
+// udpSession is a client of the UDP load balancer, whose datagrams are all forwarded to the same backend
+type udpSession struct {
+	client   *net.UDPAddr
+	endpoint net.Conn
+	lastSeen time.Time
+	connLog  *logrus.Entry
+}
+
+// StartUDP a UDP load balancer server instance
 func (lb *LBInstance) startUDP(bindAddress string) error {
-	fullAddress := fmt.Sprintf("%s:%d", bindAddress, lb.instance.Port)
-	log.Infof("Starting UDP Load Balancer for service [%s]", fullAddress)
+	fullAddress := net.JoinHostPort(bindAddress, strconv.Itoa(lb.instance.Port))
+	log.WithField("lb", lb.instance.Name).Infof("Starting UDP Load Balancer for service [%s]", fullAddress)
 
-	laddr, err := net.ResolveUDPAddr("udp", fullAddress)
-	if nil != err {
-		log.Errorln(err)
+	l, err := lb.listenPacket(fullAddress)
+	if err != nil {
+		return err
+	}
+	if lb.instance.EnableProxyProtocol {
+		log.WithField("lb", lb.instance.Name).Warnf("The PROXY protocol isn't supported by UDP load balancers")
 	}
-	l, err := net.ListenUDP("udp", laddr)
-	if nil != err {
-		return fmt.Errorf("Unable to bind [%s]", err.Error())
+	if lb.instance.UpstreamTLS != nil {
+		log.WithField("lb", lb.instance.Name).Warnf("Upstream TLS isn't supported by UDP load balancers")
 	}
-	//stopListener := make(chan bool)
 
 	go func() {
+		var mux sync.Mutex
+		sessions := map[string]*udpSession{}
+		buffer := make([]byte, udpBufferSize)
+		expiredAt := time.Now()
+
 		for {
 			select {
 
 			case <-lb.stop:
-				log.Debugf("Closing the load balancer [%s]", lb.instance.Name)
+				log.WithField("lb", lb.instance.Name).Debugf("Closing the load balancer [%s]", lb.instance.Name)
 
-				// We've closed the stop channel
-				err = l.Close()
-				if err != nil {
-					return
+				mux.Lock()
+				for _, s := range sessions {
+					s.endpoint.Close()
 				}
+				mux.Unlock()
+				l.Close()
 				// Close the stopped channel as the listener has been stopped
 				close(lb.stopped)
+				return
 			default:
 
-				// err = l.SetDeadline(time.Now().Add(200 * time.Millisecond))
-				// if err != nil {
-				// 	log.Errorf("Error setting TCP deadline", err)
-				// }
-				// fd, err := l.Accept()
-				// if err != nil {
-				// 	// Check it it's an accept timeout
-				// 	if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
-				// 		continue
-				// 	} else if err != io.EOF {
-				// 		log.Errorf("TCP Accept error [%s]", err)
-				// 	}
-				// }
-				go persistentUDPConnection(l, lb.instance, lb.backendIndex)
+				err = l.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+				if err != nil {
+					log.WithField("lb", lb.instance.Name).Errorf("Error setting UDP deadline [%v]", err)
+				}
+				if time.Since(expiredAt) > time.Second {
+					lb.expireUDPSessions(&mux, sessions)
+					expiredAt = time.Now()
+				}
+				n, client, err := l.ReadFromUDP(buffer)
+				if err != nil {
+					if opErr, ok := err.(*net.OpError); !ok || !opErr.Timeout() {
+						log.WithField("lb", lb.instance.Name).Errorf("UDP Read error [%s]", err)
+					}
+					continue
+				}
+
+				mux.Lock()
+				s, ok := sessions[client.String()]
+				mux.Unlock()
+				if !ok {
+					// Sources are checked on the first datagram of a client
+					if !lb.acl.permits(client) {
+						continue
+					}
+					s = lb.newUDPSession(l, client, &mux, sessions)
+					if s == nil {
+						continue
+					}
+				}
+
+				mux.Lock()
+				s.lastSeen = time.Now()
+				mux.Unlock()
+				if _, err := s.endpoint.Write(buffer[:n]); err != nil {
+					s.connLog.Warnf("Error sending data to endpoint [%s] [%v]", s.endpoint.RemoteAddr(), err)
+				}
 			}
 		}
 	}()
-	log.Infof("Load Balancer [%s] started", lb.instance.Name)
-
-	// go func() {
-	// 	<-lb.stop
-	// 	log.Debugln("Closing listener")
+	log.WithField("lb", lb.instance.Name).Infof("Load Balancer [%s] started", lb.instance.Name)
 
-	// 	// We've closed the stop channel
-	// 	err = l.Close()
-	// 	if err != nil {
-	// 		return
-	// 	}
-	// 	// Close the stopped channel as the listener has been stopped
-	// 	close(stopListener)
-	// }()
+	return nil
+}
 
-	// // Create a listener per CPU
-	// // TODO - make this customisable?
+// newUDPSession connects a new client to a backend and starts returning its replies, nil is returned if no backend
+// is reachable
+func (lb *LBInstance) newUDPSession(l *net.UDPConn, client *net.UDPAddr, mux *sync.Mutex, sessions map[string]*udpSession) *udpSession {
+	connLog := log.WithFields(logrus.Fields{"lb": lb.instance.Name, "client": client.String()})
+
+	var endpoint net.Conn
+	var backend string
+	next := lb.nextBackend(clientIP(client))
+	// Each backend is tried once, as a backend that isn't yet ejected would otherwise be retried forever
+	for attempt := 0; ; attempt++ {
+		if attempt != 0 && attempt >= len(lb.instance.CurrentBackends()) {
+			connLog.Errorf("All Backends have failed")
+			return nil
+		}
+		// Connect to Endpoint
+		be, ep, err := next()
+		if err != nil {
+			connLog.Errorf("No Backends available")
+			return nil
+		}
 
-	// //for i := 0; i < runtime.NumCPU(); i++ {
-	// go persistentUDPConnection(l, lb.instance)
-	// //}
+		// A backend that is pinned to the client (or became full since it was chosen) may have no room for it
+		if !lb.outliers.acquire(ep) {
+			connLog.WithField("backend", ep).Warnf("Backend [%s] is at its connection limit", ep)
+			continue
+		}
 
-	//<-stopListener // hang until an error
+		endpoint, err = net.DialTimeout("udp", ep, dialTMOUT)
+		if err != nil {
+			lb.outliers.release(ep)
+			lb.outliers.failure(lb.instance, be, ep)
+			connLog.WithField("backend", ep).Debugf("unreachable, error: %v", err)
+			connLog.WithField("backend", ep).Warnf("[%s]---X [FAILED] X-->[%s]", client, ep)
+			continue
+		}
+		lb.outliers.success(ep)
+		connLog = connLog.WithField("backend", ep)
+		connLog.Debugf("[%s]---->[ACCEPT]---->[%s]", client, ep)
+		backend = ep
+		break
+	}
 
-	log.Infof("Load Balancer [%s] started", lb.instance.Name)
+	s := &udpSession{client: client, endpoint: endpoint, lastSeen: time.Now(), connLog: connLog}
+	mux.Lock()
+	sessions[client.String()] = s
+	mux.Unlock()
 
-	return nil
+	// Begin copying recieving (endpoint -> back to the client), until the session is closed
+	go func() {
+		defer lb.outliers.release(backend)
+		buffer := make([]byte, udpBufferSize)
+		for {
+			n, err := endpoint.Read(buffer)
+			if err != nil {
+				connLog.Debugf("UDP session closed [%v]", err)
+				return
+			}
+			mux.Lock()
+			s.lastSeen = time.Now()
+			mux.Unlock()
+			if _, err := l.WriteToUDP(buffer[:n], client); err != nil {
+				connLog.Warnf("Error sending data to client [%s] [%v]", client, err)
+			}
+		}
+	}()
+	return s
 }
 
-// func listen(connection *net.UDPConn, quit chan bool) {
-// 	buffer := make([]byte, 1024)
-// 	n, remoteAddr, err := 0, new(net.UDPAddr), error(nil)
-// 	for err == nil {
-
-// 		//TODO -
-
-// 		n, remoteAddr, err = connection.ReadFromUDP(buffer)
-// 		// you might copy out the contents of the packet here, to
-// 		// `var r myapp.Request`, say, and `go handleRequest(r)` (or
-// 		// send it down a channel) to free up the listening
-// 		// goroutine. you do *need* to copy then, though,
-// 		// because you've only made one buffer per listen().
-// 		fmt.Println("from", remoteAddr, "-", buffer[:n])
-// 	}
-// 	fmt.Println("listener failed - ", err)
-// }
+// expireUDPSessions closes the sessions that have been idle for the session timeout
+func (lb *LBInstance) expireUDPSessions(mux *sync.Mutex, sessions map[string]*udpSession) {
+	mux.Lock()
+	defer mux.Unlock()
+	for key, s := range sessions {
+		if time.Since(s.lastSeen) > udpSessionTimeout {
+			s.endpoint.Close()
+			delete(sessions, key)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package loadbalancer
+
+import (
+	"expvar"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// clientIdleTimeout is how long a client with no connections is remembered, after which its rate is reset
+	clientIdleTimeout = 5 * time.Minute
+	// rejectionLogInterval is how often rejections are logged, so a flood of connections doesn't flood the logs
+	rejectionLogInterval = 10 * time.Second
+)
+
+// The reasons a connection is rejected
+const (
+	rejectMaxConnections       = "maxConnections"
+	rejectMaxClientConnections = "maxClientConnections"
+	rejectConnectionRate       = "connectionRate"
+	rejectClientConnectionRate = "clientConnectionRate"
+)
+
+// connectionsRejected is the number of connections rejected by the limits, keyed by load balancer and reason
+// and exposed through expvar (/debug/vars)
+var connectionsRejected = expvar.NewMap("lb_connections_rejected")
+
+// connLimiter enforces the connection limits of a load balancer
+type connLimiter struct {
+	mux     sync.Mutex
+	lb      string
+	limits  kubevip.ConnectionLimits
+	active  int
+	limiter *rate.Limiter
+	clients map[string]*clientLimits
+
+	// rejections since they were last logged
+	rejected int
+	loggedAt time.Time
+}
+
+// clientLimits are the connections of a single client (source IP)
+type clientLimits struct {
+	active   int
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newConnLimiter - returns the limiter of a load balancer, or nil if it has no limits
+func newConnLimiter(lb *kubevip.LoadBalancer) (*connLimiter, error) {
+	if lb.Limits == nil {
+		return nil, nil
+	}
+	if err := lb.Limits.Validate(); err != nil {
+		return nil, err
+	}
+	l := &connLimiter{
+		lb:      lb.Name,
+		limits:  *lb.Limits,
+		clients: make(map[string]*clientLimits),
+	}
+	if l.limits.ConnectionRate > 0 {
+		l.limiter = rate.NewLimiter(rate.Limit(l.limits.ConnectionRate), l.burst(l.limits.ConnectionRate))
+	}
+	return l, nil
+}
+
+// burst returns the configured burst, or the rate rounded up
+func (l *connLimiter) burst(r float64) int {
+	if l.limits.ConnectionBurst > 0 {
+		return l.limits.ConnectionBurst
+	}
+	return int(math.Ceil(r))
+}
+
+// acquire - checks a new connection from the address against the limits, if it is accepted the release function
+// must be called once it closes (it is safe to call on a nil limiter)
+func (l *connLimiter) acquire(addr net.Addr) (release func(), accepted bool) {
+	if l == nil {
+		return func() {}, true
+	}
+	client := clientIP(addr)
+	now := time.Now()
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	c, ok := l.clients[client]
+	if !ok {
+		c = &clientLimits{}
+		if l.limits.ClientConnectionRate > 0 {
+			c.limiter = rate.NewLimiter(rate.Limit(l.limits.ClientConnectionRate), l.burst(l.limits.ClientConnectionRate))
+		}
+		l.clients[client] = c
+	}
+	c.lastSeen = now
+
+	// The concurrent limits are checked before any tokens are taken, so a rejected connection doesn't use up the rate
+	var reason string
+	switch {
+	case l.limits.MaxConnections > 0 && l.active >= l.limits.MaxConnections:
+		reason = rejectMaxConnections
+	case l.limits.MaxClientConnections > 0 && c.active >= l.limits.MaxClientConnections:
+		reason = rejectMaxClientConnections
+	case c.limiter != nil && !c.limiter.AllowN(now, 1):
+		reason = rejectClientConnectionRate
+	case l.limiter != nil && !l.limiter.AllowN(now, 1):
+		reason = rejectConnectionRate
+	}
+	if reason != "" {
+		l.reject(client, reason, now)
+		return nil, false
+	}
+
+	l.active++
+	c.active++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mux.Lock()
+			l.active--
+			c.active--
+			c.lastSeen = time.Now()
+			l.mux.Unlock()
+		})
+	}, true
+}
+
+// reject counts a rejected connection and logs the rejections at most once per interval
+func (l *connLimiter) reject(client, reason string, now time.Time) {
+	connectionsRejected.Add(l.lb+"/"+reason, 1)
+	l.rejected++
+	if now.Sub(l.loggedAt) < rejectionLogInterval {
+		return
+	}
+	log.WithFields(logrus.Fields{"lb": l.lb, "client": client, "reason": reason}).Warnf("Rejected [%d] connection(s) exceeding the limits of load balancer [%s]", l.rejected, l.lb)
+	l.rejected, l.loggedAt = 0, now
+}
+
+// prune forgets the clients that have had no connections for the idle timeout (it is safe to call on a nil limiter)
+func (l *connLimiter) prune() {
+	if l == nil {
+		return
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	for client, c := range l.clients {
+		if c.active == 0 && time.Since(c.lastSeen) > clientIdleTimeout {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// clientIP returns the IP of an address, which identifies the client
+func clientIP(addr net.Addr) string {
+	if ip := addrIP(addr); ip != nil {
+		return ip.String()
+	}
+	return addr.String()
+}
+
+// limitListener applies the source lists and then the connection limits to the connections accepted by a listener,
+// connections that are denied or exceed the limits are closed
+type limitListener struct {
+	net.Listener
+	acl     *sourceACL // nil if the client is only known from a PROXY protocol header
+	limiter *connLimiter
+}
+
+// Accept - waits for the next connection that is permitted and within the limits
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		// A denied client doesn't take a place within the limits
+		if !l.acl.permits(conn.RemoteAddr()) {
+			conn.Close()
+			continue
+		}
+		release, accepted := l.limiter.acquire(conn.RemoteAddr())
+		if !accepted {
+			conn.Close()
+			continue
+		}
+		return &limitConn{Conn: conn, release: release}, nil
+	}
+}
+
+// limitConn releases its place within the limits when it is closed
+type limitConn struct {
+	net.Conn
+	release func()
+}
+
+// Close - closes the connection
+func (c *limitConn) Close() error {
+	c.release()
+	return c.Conn.Close()
+}
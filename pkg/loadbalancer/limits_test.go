@@ -0,0 +1,99 @@
+package loadbalancer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+)
+
+func TestConnLimiterAcquire(t *testing.T) {
+	first := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000}
+	second := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 40000}
+
+	tests := []struct {
+		name    string
+		limits  kubevip.ConnectionLimits
+		clients []*net.TCPAddr
+		want    []bool
+	}{
+		{
+			name:    "max connections",
+			limits:  kubevip.ConnectionLimits{MaxConnections: 2},
+			clients: []*net.TCPAddr{first, second, second},
+			want:    []bool{true, true, false},
+		},
+		{
+			name:    "max client connections",
+			limits:  kubevip.ConnectionLimits{MaxClientConnections: 1},
+			clients: []*net.TCPAddr{first, first, second},
+			want:    []bool{true, false, true},
+		},
+		{
+			name:    "connection rate",
+			limits:  kubevip.ConnectionLimits{ConnectionRate: 1, ConnectionBurst: 2},
+			clients: []*net.TCPAddr{first, second, first},
+			want:    []bool{true, true, false},
+		},
+		{
+			name:    "client connection rate",
+			limits:  kubevip.ConnectionLimits{ClientConnectionRate: 1},
+			clients: []*net.TCPAddr{first, first, second},
+			want:    []bool{true, false, true},
+		},
+		{
+			// A connection rejected by the concurrent limits doesn't use up the rate
+			name:    "rejection keeps the rate",
+			limits:  kubevip.ConnectionLimits{MaxClientConnections: 1, ConnectionRate: 1, ConnectionBurst: 2},
+			clients: []*net.TCPAddr{first, first, second},
+			want:    []bool{true, false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := newConnLimiter(&kubevip.LoadBalancer{Name: "test", Limits: &tt.limits})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for x, client := range tt.clients {
+				_, accepted := l.acquire(client)
+				if accepted != tt.want[x] {
+					t.Errorf("connection [%d] from [%s] accepted = %v, want %v", x, client, accepted, tt.want[x])
+				}
+			}
+		})
+	}
+}
+
+func TestConnLimiterRelease(t *testing.T) {
+	l, err := newConnLimiter(&kubevip.LoadBalancer{Name: "test", Limits: &kubevip.ConnectionLimits{MaxConnections: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000}
+	release, accepted := l.acquire(client)
+	if !accepted {
+		t.Fatal("the first connection should be accepted")
+	}
+	if _, accepted := l.acquire(client); accepted {
+		t.Fatal("a connection above the limit should be rejected")
+	}
+	// Releasing twice only gives back one place
+	release()
+	release()
+	if l.active != 0 {
+		t.Fatalf("active connections = %d, want 0", l.active)
+	}
+	if _, accepted := l.acquire(client); !accepted {
+		t.Error("a connection should be accepted once the place is released")
+	}
+}
+
+func TestConnLimiterNil(t *testing.T) {
+	var l *connLimiter
+	release, accepted := l.acquire(&net.TCPAddr{IP: net.ParseIP("10.0.0.1")})
+	if !accepted {
+		t.Fatal("a nil limiter should accept any connection")
+	}
+	release()
+}
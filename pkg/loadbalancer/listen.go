@@ -0,0 +1,75 @@
+package loadbalancer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// maxAcceptDelay is the longest an accept goroutine waits before retrying after an error (e.g. out of descriptors)
+const maxAcceptDelay = time.Second
+
+// listen - opens the TCP listeners of a load balancer, more than one listener share the address with SO_REUSEPORT so
+// the kernel spreads the connections between them
+func (lb *LBInstance) listen(address string) ([]net.Listener, error) {
+	count := lb.instance.Listeners
+	if count < 0 {
+		return nil, fmt.Errorf("The number of listeners [%d] can't be negative", count)
+	}
+	if count == 0 {
+		count = 1
+	}
+	lc := net.ListenConfig{Control: listenControl(count > 1, lb.instance.FreeBind)}
+
+	var listeners []net.Listener
+	for i := 0; i < count; i++ {
+		l, err := lc.Listen(lb.ctx, "tcp", address)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("Unable to bind [%s]", err.Error())
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// listenPacket - opens the UDP listener of a load balancer
+func (lb *LBInstance) listenPacket(address string) (*net.UDPConn, error) {
+	lc := net.ListenConfig{Control: listenControl(false, lb.instance.FreeBind)}
+	l, err := lc.ListenPacket(lb.ctx, "udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to bind [%s]", err.Error())
+	}
+	return l.(*net.UDPConn), nil
+}
+
+// accept - hands each connection of a listener to handle until the load balancer is stopped, which closes the
+// listener
+func (lb *LBInstance) accept(listener net.Listener, handle func(net.Conn)) {
+	var delay time.Duration
+	for {
+		fd, err := listener.Accept()
+		if err != nil {
+			if lb.ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay *= 2; delay > maxAcceptDelay {
+				delay = maxAcceptDelay
+			}
+			log.WithField("lb", lb.instance.Name).Errorf("TCP Accept error [%s], retrying in %v", err, delay)
+			select {
+			case <-time.After(delay):
+			case <-lb.ctx.Done():
+				return
+			}
+			continue
+		}
+		delay = 0
+		go handle(fd)
+	}
+}
@@ -0,0 +1,39 @@
+// +build linux
+
+package loadbalancer
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenControl - returns the socket options of a listener, SO_REUSEPORT allows several listeners on the same address
+// and IP_FREEBIND allows binding to an address that isn't present yet (such as the VIP on a follower)
+func listenControl(reusePort, freeBind bool) func(network, address string, c syscall.RawConn) error {
+	if !reusePort && !freeBind {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			if reusePort {
+				if sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); sockErr != nil {
+					return
+				}
+			}
+			if freeBind {
+				switch network {
+				case "tcp6", "udp6":
+					sockErr = unix.SetsockoptInt(int(fd), unix.SOL_IPV6, unix.IPV6_FREEBIND, 1)
+				default:
+					sockErr = unix.SetsockoptInt(int(fd), unix.SOL_IP, unix.IP_FREEBIND, 1)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
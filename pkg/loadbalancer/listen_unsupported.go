@@ -0,0 +1,18 @@
+// +build !linux
+
+package loadbalancer
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// listenControl - SO_REUSEPORT listeners and IP_FREEBIND are only supported on Linux, so return an error
+func listenControl(reusePort, freeBind bool) func(network, address string, c syscall.RawConn) error {
+	if !reusePort && !freeBind {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		return fmt.Errorf("Multiple listeners and free bind are unsupported on this OS")
+	}
+}
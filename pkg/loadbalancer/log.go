@@ -0,0 +1,6 @@
+package loadbalancer
+
+import "github.com/plunder-app/kube-vip/pkg/logging"
+
+// The logger of the load balancers
+var log = logging.Logger(logging.LoadBalancer)
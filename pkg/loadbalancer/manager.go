@@ -1,13 +1,17 @@
 package loadbalancer
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/pires/go-proxyproto"
 	"github.com/plunder-app/kube-vip/pkg/kubevip"
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -15,97 +19,178 @@ const (
 	resetAlivePeriod = time.Second * 30
 	// net.Dial Timeout, default 0.5 sec
 	dialTMOUT = time.Millisecond * 500
+	// outlier timer period, ejections end and failure rate intervals start to within a second
+	outlierTickPeriod = time.Second
 )
 
 //LBInstance - manages the state of load balancer instances
 type LBInstance struct {
+	ctx      context.Context       // Cancelled when the LB is asked to stop
+	cancel   context.CancelFunc    // Cancels the context of the LB
 	stop     chan bool             // Asks LB to stop
 	stopped  chan bool             // LB is stopped
 	instance *kubevip.LoadBalancer // pointer to a LB instance
+	bindAddress string             // The address the LB instance is bound to
 	//	mux      sync.Mutex
 	backendIndex *int              // The backend index for LB instance
+	accessLog *accessLogger        // The access log of the LB instance (nil if disabled)
+	limiter *connLimiter           // The connection limits of the LB instance (nil if unlimited)
+	acl *sourceACL                 // The source allow and deny lists of the LB instance (nil if any client is allowed)
+	proxyPolicy proxyproto.PolicyFunc // The sources that may send a PROXY protocol header (nil if any source may)
+	affinity *sessionAffinity      // The session affinity of the LB instance (nil if connections aren't pinned)
+	upstreamTLS *tls.Config        // The TLS client configuration of the backends (nil if they don't use TLS)
+	outliers *outlierDetector      // The outlier detection of the LB instance (nil if a backend is down on its first failure)
+	conns *connTracker             // The active connections of the LB instance
+	drainTimeout time.Duration     // How long a http LB instance waits for active requests once stopped (zero is the default)
 }
 
 //LBManager - will manage a number of load blancer instances
 type LBManager struct {
-	loadBalancer []LBInstance
+	loadBalancer []*LBInstance
+	mux          sync.Mutex
 }
 
 //Add - handles the building of the load balancers
 func (lm *LBManager) Add(bindAddress string, lb *kubevip.LoadBalancer) error {
 	// Start the index negative as it will be incrememnted of first approach
 	initBackendIndex := -1
-	newLB := LBInstance{
+	accessLog, err := newAccessLogger(lb)
+	if err != nil {
+		return err
+	}
+	limiter, err := newConnLimiter(lb)
+	if err != nil {
+		return err
+	}
+	acl, err := newSourceACL(lb)
+	if err != nil {
+		return err
+	}
+	proxyPolicy, err := newProxyPolicy(lb)
+	if err != nil {
+		return err
+	}
+	affinity, err := newSessionAffinity(lb)
+	if err != nil {
+		return err
+	}
+	upstreamTLS, err := newUpstreamTLS(lb)
+	if err != nil {
+		return err
+	}
+	outliers, err := newOutlierDetector(lb)
+	if err != nil {
+		return err
+	}
+	dns, err := newDNSBackends(lb)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The DNS backends are resolved before the load balancer starts, and then whilst it runs
+	if dns != nil {
+		go dns.run(ctx, dns.resolve(ctx))
+	}
+	newLB := &LBInstance{
+		ctx:      ctx,
+		cancel:   cancel,
 		stop:     make(chan bool, 1),
 		stopped:  make(chan bool, 1),
 		instance: lb,
+		bindAddress: bindAddress,
 		backendIndex: &initBackendIndex,
+		accessLog: accessLog,
+		limiter: limiter,
+		acl: acl,
+		proxyPolicy: proxyPolicy,
+		affinity: affinity,
+		upstreamTLS: upstreamTLS,
+		outliers: outliers,
+		conns: newConnTracker(),
 	}
 
 	network := strings.ToLower(lb.Type)
 	switch network {
 	case "tcp":
-		err := newLB.startTCP(bindAddress)
-		if err != nil {
-			return err
-		}
+		err = newLB.startTCP(bindAddress)
+	case "tls":
+		// TCP clients are proxied to backends over TLS
+		err = newLB.startTCP(bindAddress)
+		network = "tcp"
 	case "udp":
-		err := newLB.startUDP(bindAddress)
-		if err != nil {
-			return err
-		}
+		err = newLB.startUDP(bindAddress)
 	case "http":
-		err := newLB.startHTTP(bindAddress)
-		if err != nil {
-			return err
-		}
+		err = newLB.startHTTP(bindAddress)
 		// set to 'tcp' for dial
 		network = "tcp"
 	default:
-		return fmt.Errorf("Unknown Load Balancer type [%s]", lb.Type)
+		err = fmt.Errorf("Unknown Load Balancer type [%s]", lb.Type)
+	}
+	if err != nil {
+		cancel()
+		return err
 	}
 
 	// start backend reset alive timer
 	go func(l *LBInstance, network string) {
-		log.Infof("Staring load Balancer [%s] backend reset alive timer", l.instance.Name)
+		log.WithField("lb", l.instance.Name).Infof("Staring load Balancer [%s] backend reset alive timer", l.instance.Name)
 
 		t := time.NewTicker(resetAlivePeriod)
+		outlierTick := time.NewTicker(outlierTickPeriod)
 
 		defer func() {
 			t.Stop()
-			log.Infof("Load Balancer [%s] backend reset alive timer has stopped", l.instance.Name)
+			outlierTick.Stop()
+			log.WithField("lb", l.instance.Name).Infof("Load Balancer [%s] backend reset alive timer has stopped", l.instance.Name)
 		}()
 
 		for {
 			select {
 			case <-l.stop:
 				return
+			case <-outlierTick.C:
+				l.outliers.tick()
 			case <-t.C:
-				for x := range l.instance.Backends {
-					if !l.instance.Backends[x].IsAlive() {
-						go func(backends []kubevip.BackEnd, y int) {
-							fullAddress := fmt.Sprintf("%s:%d", backends[y].Address, backends[y].Port)
+				// Forget any idle clients of the connection limits and session affinity
+				l.limiter.prune()
+				l.affinity.prune()
+
+				backends := l.instance.CurrentBackends()
+				for x := range backends {
+					// Ejected backends are only brought back once their ejection has ended
+					if fullAddress := backendAddress(&backends[x]); !backends[x].IsAlive() && !l.outliers.ejected(fullAddress) {
+						go func(fullAddress string) {
+							backendLog := log.WithFields(logrus.Fields{"lb": l.instance.Name, "backend": fullAddress})
 							conn, err := net.DialTimeout(network, fullAddress, dialTMOUT)
 							if err != nil {
-								log.Warnf("unreachable, error: %v", err)
-							} else {
-								l.instance.Backends[x].SetAlive(l.instance, true)
-								writeProxyProtocol(l.instance.EnableProxyProtocol, conn, conn)
-								conn.Close()
+								backendLog.Warnf("unreachable, error: %v", err)
+								return
 							}
-						}(l.instance.Backends, x)
+							// The backends may have been replaced whilst dialing, the backend is skipped if it was removed
+							if be := findBackend(l.instance, fullAddress); be != nil {
+								be.SetAlive(l.instance, true)
+								l.outliers.returned(fullAddress)
+							}
+							writeProxyProtocol(backendLog, l.instance, conn, conn)
+							conn.Close()
+						}(fullAddress)
 					}
 				}
 			}
 		}
-	}(&newLB, network)
+	}(newLB, network)
 
+	lm.mux.Lock()
 	lm.loadBalancer = append(lm.loadBalancer, newLB)
+	lm.mux.Unlock()
 	return nil
 }
 
 //StopAll - handles the building of the load balancers
 func (lm *LBManager) StopAll() error {
+	lm.mux.Lock()
+	defer lm.mux.Unlock()
 	log.Debugf("Stopping [%d] loadbalancer instances", len(lm.loadBalancer))
 	for x := range lm.loadBalancer {
 		err := lm.loadBalancer[x].Stop()
@@ -121,9 +206,13 @@ func (lm *LBManager) StopAll() error {
 //Stop - handles the building of the load balancers
 func (l *LBInstance) Stop() error {
 
+	l.cancel()
 	close(l.stop)
 
 	<-l.stopped
-	log.Infof("Load Balancer instance [%s] has stopped", l.instance.Name)
+	if err := l.accessLog.close(); err != nil {
+		log.WithField("lb", l.instance.Name).Warnf("Unable to close access log [%v]", err)
+	}
+	log.WithField("lb", l.instance.Name).Infof("Load Balancer instance [%s] has stopped", l.instance.Name)
 	return nil
 }
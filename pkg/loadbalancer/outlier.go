@@ -0,0 +1,341 @@
+package loadbalancer
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+)
+
+const (
+	defaultOutlierConsecutiveFailures = 5
+	defaultOutlierMinimumRequests     = 10
+	defaultOutlierInterval            = 10 * time.Second
+	defaultOutlierBaseEjectionTime    = 30 * time.Second
+	defaultOutlierMaxEjectionTime     = 300 * time.Second
+	defaultOutlierMaxEjectionPercent  = 50
+	// slowStartMinimumWeight is the least share of new connections a returning backend is sent
+	slowStartMinimumWeight = 0.1
+)
+
+var (
+	// errBackendsFull is returned when every backend that is up already has the most connections it can be sent
+	errBackendsFull = errors.New("All Backends are at their connection limit")
+	// errBackendsUnavailable is returned when every backend is down and is either ejected or full
+	errBackendsUnavailable = errors.New("All Backends are down or ejected")
+)
+
+// outlierDetector ejects the backends of a load balancer that keep failing, and ramps up the backends that return
+type outlierDetector struct {
+	mux         sync.Mutex
+	lb          *kubevip.LoadBalancer
+	config      kubevip.OutlierDetection
+	interval    time.Duration
+	baseTime    time.Duration
+	maxTime     time.Duration
+	slowStart   time.Duration
+	windowStart time.Time
+	backends    map[string]*outlierState
+}
+
+// outlierState is what is known about the failures of a backend
+type outlierState struct {
+	consecutive  int       // failures in a row
+	successes    int       // successes within the current interval
+	failures     int       // failures within the current interval
+	ejections    int       // ejections without a clean interval since, which doubles the next ejection time
+	ejectedUntil time.Time // zero if the backend isn't ejected
+	returnedAt   time.Time // zero if the backend isn't being slow started
+	active       int       // connections (or requests) in progress, counted if the backends have a connection limit
+}
+
+// newOutlierDetector - returns the outlier detection of a load balancer, or nil if it doesn't have any
+func newOutlierDetector(lb *kubevip.LoadBalancer) (*outlierDetector, error) {
+	if lb.OutlierDetection == nil {
+		return nil, nil
+	}
+	if err := lb.OutlierDetection.Validate(); err != nil {
+		return nil, err
+	}
+	d := &outlierDetector{
+		lb:          lb,
+		config:      *lb.OutlierDetection,
+		interval:    time.Duration(lb.OutlierDetection.Interval) * time.Second,
+		baseTime:    time.Duration(lb.OutlierDetection.BaseEjectionTime) * time.Second,
+		maxTime:     time.Duration(lb.OutlierDetection.MaxEjectionTime) * time.Second,
+		slowStart:   time.Duration(lb.OutlierDetection.SlowStart) * time.Second,
+		windowStart: time.Now(),
+		backends:    make(map[string]*outlierState),
+	}
+	if d.config.ConsecutiveFailures == 0 {
+		d.config.ConsecutiveFailures = defaultOutlierConsecutiveFailures
+	}
+	if d.config.MinimumRequests == 0 {
+		d.config.MinimumRequests = defaultOutlierMinimumRequests
+	}
+	if d.config.MaxEjectionPercent == 0 {
+		d.config.MaxEjectionPercent = defaultOutlierMaxEjectionPercent
+	}
+	if d.interval == 0 {
+		d.interval = defaultOutlierInterval
+	}
+	if d.baseTime == 0 {
+		d.baseTime = defaultOutlierBaseEjectionTime
+	}
+	if d.maxTime == 0 {
+		d.maxTime = defaultOutlierMaxEjectionTime
+	}
+	if d.maxTime < d.baseTime {
+		d.maxTime = d.baseTime
+	}
+	return d, nil
+}
+
+// state returns the state of a backend, which must be called with the lock held
+func (d *outlierDetector) state(endpoint string) *outlierState {
+	s, ok := d.backends[endpoint]
+	if !ok {
+		s = &outlierState{}
+		d.backends[endpoint] = s
+	}
+	return s
+}
+
+// success - records a successful connection (or request) to a backend (it is safe to call on a nil detector)
+func (d *outlierDetector) success(endpoint string) {
+	if d == nil {
+		return
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	s := d.state(endpoint)
+	s.consecutive = 0
+	s.successes++
+}
+
+// failure - records a failed connection (or request) to a backend, which is ejected if it has failed too often. A
+// nil detector marks the backend down straight away
+func (d *outlierDetector) failure(lb *kubevip.LoadBalancer, be *kubevip.BackEnd, endpoint string) {
+	if d == nil {
+		be.SetAlive(lb, false)
+		return
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	s := d.state(endpoint)
+	s.consecutive++
+	s.failures++
+	if !s.ejectedUntil.IsZero() {
+		return
+	}
+
+	consecutive := d.config.ConsecutiveFailures > 0 && s.consecutive >= d.config.ConsecutiveFailures
+	total := s.successes + s.failures
+	rate := d.config.FailureRate > 0 && total >= d.config.MinimumRequests && s.failures*100 >= d.config.FailureRate*total
+	if !consecutive && !rate {
+		return
+	}
+
+	// Never eject more of the pool than is allowed, the backend is still sent connections if it can't be ejected
+	ejected := 0
+	for _, other := range d.backends {
+		if !other.ejectedUntil.IsZero() {
+			ejected++
+		}
+	}
+	if (ejected+1)*100 > d.config.MaxEjectionPercent*len(d.lb.CurrentBackends()) {
+		log.WithField("lb", d.lb.Name).Warnf("Backend [%s] is failing but [%d] backends are already ejected", endpoint, ejected)
+		return
+	}
+
+	s.ejections++
+	ejection := d.baseTime
+	for x := 1; x < s.ejections && ejection < d.maxTime; x++ {
+		ejection *= 2
+	}
+	if ejection > d.maxTime {
+		ejection = d.maxTime
+	}
+	s.ejectedUntil = time.Now().Add(ejection)
+	s.returnedAt = time.Time{}
+	be.SetAlive(lb, false)
+	log.WithField("lb", d.lb.Name).Warnf("Backend [%s] ejected for [%s] after [%d] failures of [%d]", endpoint, ejection, s.failures, total)
+}
+
+// tick - returns the backends whose ejection has ended, forgets the backends that have been removed and starts a new
+// interval of the failure rate (it is safe to call on a nil detector)
+func (d *outlierDetector) tick() {
+	if d == nil {
+		return
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	now := time.Now()
+	backends := d.lb.CurrentBackends()
+	current := make(map[string]bool, len(backends))
+	for x := range backends {
+		be := &backends[x]
+		endpoint := backendAddress(be)
+		current[endpoint] = true
+		s, ok := d.backends[endpoint]
+		if !ok || s.ejectedUntil.IsZero() || now.Before(s.ejectedUntil) {
+			continue
+		}
+		s.ejectedUntil = time.Time{}
+		s.consecutive = 0
+		if d.slowStart > 0 {
+			s.returnedAt = now
+		}
+		be.SetAlive(d.lb, true)
+		log.WithField("lb", d.lb.Name).Infof("Backend [%s] has returned from ejection", endpoint)
+	}
+	// A removed backend would otherwise count towards the ejected backends
+	for endpoint := range d.backends {
+		if !current[endpoint] {
+			delete(d.backends, endpoint)
+		}
+	}
+
+	if now.Sub(d.windowStart) < d.interval {
+		return
+	}
+	d.windowStart = now
+	for _, s := range d.backends {
+		// A backend that has a clean interval has its next ejection time halved
+		if s.ejectedUntil.IsZero() && s.failures == 0 && s.ejections > 0 {
+			s.ejections--
+		}
+		s.successes, s.failures = 0, 0
+	}
+}
+
+// ejected - returns if a backend is ejected, and so shouldn't be brought back before its ejection ends (it is safe to
+// call on a nil detector)
+func (d *outlierDetector) ejected(endpoint string) bool {
+	if d == nil {
+		return false
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	s, ok := d.backends[endpoint]
+	return ok && !s.ejectedUntil.IsZero()
+}
+
+// returned - starts the slow start of a backend that has come back up (it is safe to call on a nil detector)
+func (d *outlierDetector) returned(endpoint string) {
+	if d == nil || d.slowStart == 0 {
+		return
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.state(endpoint).returnedAt = time.Now()
+}
+
+// admit - returns if a backend should be sent a new connection, a backend being slow started is sent a share that
+// grows until the slow start ends (it is safe to call on a nil detector)
+func (d *outlierDetector) admit(endpoint string) bool {
+	if d == nil || d.slowStart == 0 {
+		return true
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	s, ok := d.backends[endpoint]
+	if !ok || s.returnedAt.IsZero() {
+		return true
+	}
+	elapsed := time.Since(s.returnedAt)
+	if elapsed >= d.slowStart {
+		s.returnedAt = time.Time{}
+		return true
+	}
+	weight := float64(elapsed) / float64(d.slowStart)
+	if weight < slowStartMinimumWeight {
+		weight = slowStartMinimumWeight
+	}
+	return rand.Float64() < weight
+}
+
+// acquire - counts a new connection (or request) to a backend, returning false if the backend already has the most
+// connections it can be sent (it is safe to call on a nil detector)
+func (d *outlierDetector) acquire(endpoint string) bool {
+	if d == nil || d.config.MaxConnections == 0 {
+		return true
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	s := d.state(endpoint)
+	if s.active >= d.config.MaxConnections {
+		return false
+	}
+	s.active++
+	return true
+}
+
+// release - counts a connection (or request) to a backend as finished (it is safe to call on a nil detector)
+func (d *outlierDetector) release(endpoint string) {
+	if d == nil || d.config.MaxConnections == 0 {
+		return
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if s, ok := d.backends[endpoint]; ok && s.active > 0 {
+		s.active--
+	}
+}
+
+// full - returns if a backend has the most connections it can be sent (it is safe to call on a nil detector)
+func (d *outlierDetector) full(endpoint string) bool {
+	if d == nil || d.config.MaxConnections == 0 {
+		return false
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	s, ok := d.backends[endpoint]
+	return ok && s.active >= d.config.MaxConnections
+}
+
+// roundRobin - returns the next backend that is up, isn't full and, if it is being slow started, admitted. If every
+// backend is down then the next backend that isn't ejected is tried instead
+func (lb *LBInstance) roundRobin() (*kubevip.BackEnd, string, error) {
+	var slowStarted *kubevip.BackEnd
+	var slowStartedEP string
+	// Every backend is tried once, after which a backend being slow started is used whether it is admitted or not
+	for x := 0; x == 0 || x < len(lb.instance.CurrentBackends()); x++ {
+		be, ep, err := lb.instance.ReturnEndpointAddr(lb.backendIndex)
+		if err == kubevip.ErrNoAliveBackends {
+			return lb.fallback()
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if lb.outliers.full(ep) {
+			continue
+		}
+		if lb.outliers.admit(ep) {
+			return be, ep, nil
+		}
+		slowStarted, slowStartedEP = be, ep
+	}
+	if slowStarted == nil {
+		return nil, "", errBackendsFull
+	}
+	return slowStarted, slowStartedEP, nil
+}
+
+// fallback - returns the next backend that isn't ejected or full when every backend is down, the backend is left
+// down (and any ejected backend stays ejected) as it is only brought back up once the reset timer can reach it
+func (lb *LBInstance) fallback() (*kubevip.BackEnd, string, error) {
+	backends := lb.instance.CurrentBackends()
+	for range backends {
+		*lb.backendIndex = (*lb.backendIndex + 1) % len(backends)
+		be := &backends[*lb.backendIndex]
+		ep := backendAddress(be)
+		if !lb.outliers.ejected(ep) && !lb.outliers.full(ep) {
+			log.WithField("lb", lb.instance.Name).Debugf("Every backend is down, trying backend [%s]", ep)
+			return be, ep, nil
+		}
+	}
+	return nil, "", errBackendsUnavailable
+}
@@ -0,0 +1,248 @@
+package loadbalancer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+)
+
+func TestOutlierDetectorEjection(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   kubevip.OutlierDetection
+		backends int
+		outcomes []bool // the successes (true) and failures (false) of the first backend
+		ejected  bool
+	}{
+		{name: "consecutive failures", config: kubevip.OutlierDetection{ConsecutiveFailures: 3}, backends: 2, outcomes: []bool{false, false, false}, ejected: true},
+		{name: "too few consecutive failures", config: kubevip.OutlierDetection{ConsecutiveFailures: 3}, backends: 2, outcomes: []bool{false, false, true, false}, ejected: false},
+		{name: "failure rate", config: kubevip.OutlierDetection{ConsecutiveFailures: -1, FailureRate: 50, MinimumRequests: 4}, backends: 2, outcomes: []bool{true, false, true, false}, ejected: true},
+		{name: "failure rate below the minimum requests", config: kubevip.OutlierDetection{ConsecutiveFailures: -1, FailureRate: 50, MinimumRequests: 4}, backends: 2, outcomes: []bool{false, false, false}, ejected: false},
+		{name: "failure rate below the rate", config: kubevip.OutlierDetection{ConsecutiveFailures: -1, FailureRate: 50, MinimumRequests: 4}, backends: 2, outcomes: []bool{true, true, true, false}, ejected: false},
+		{name: "single backend exceeds the max ejection percent", config: kubevip.OutlierDetection{ConsecutiveFailures: 1}, backends: 1, outcomes: []bool{false}, ejected: false},
+		{name: "all backends can be ejected", config: kubevip.OutlierDetection{ConsecutiveFailures: 1, MaxEjectionPercent: 100}, backends: 1, outcomes: []bool{false}, ejected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := &kubevip.LoadBalancer{Name: "test", OutlierDetection: &tt.config, Backends: []kubevip.BackEnd{
+				{Address: "10.0.0.1", Port: 80, Alive: true},
+				{Address: "10.0.0.2", Port: 80, Alive: true},
+			}[:tt.backends]}
+			d, err := newOutlierDetector(lb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			be := &lb.Backends[0]
+			ep := backendAddress(be)
+			for _, success := range tt.outcomes {
+				if success {
+					d.success(ep)
+				} else {
+					d.failure(lb, be, ep)
+				}
+			}
+			if got := d.ejected(ep); got != tt.ejected {
+				t.Errorf("ejected = %v, want %v", got, tt.ejected)
+			}
+			if be.IsAlive() == tt.ejected {
+				t.Errorf("alive = %v, want %v", be.IsAlive(), !tt.ejected)
+			}
+		})
+	}
+}
+
+func TestOutlierDetectorMaxEjectionPercent(t *testing.T) {
+	tests := []struct {
+		name string
+		want []bool
+	}{
+		// Half of the four backends can be ejected, the third is still sent connections
+		{name: "even", want: []bool{true, true, false, false}},
+		// Ejecting a second of three backends would eject more than half of them
+		{name: "odd", want: []bool{true, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := &kubevip.LoadBalancer{Name: "test", OutlierDetection: &kubevip.OutlierDetection{ConsecutiveFailures: 1, MaxEjectionPercent: 50}, Backends: []kubevip.BackEnd{
+				{Address: "10.0.0.1", Port: 80, Alive: true},
+				{Address: "10.0.0.2", Port: 80, Alive: true},
+				{Address: "10.0.0.3", Port: 80, Alive: true},
+				{Address: "10.0.0.4", Port: 80, Alive: true},
+			}[:len(tt.want)]}
+			d, err := newOutlierDetector(lb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for x := range lb.Backends {
+				ep := backendAddress(&lb.Backends[x])
+				d.failure(lb, &lb.Backends[x], ep)
+				if got := d.ejected(ep); got != tt.want[x] {
+					t.Errorf("backend [%s] ejected = %v, want %v", ep, got, tt.want[x])
+				}
+			}
+		})
+	}
+}
+
+func TestOutlierDetectorTick(t *testing.T) {
+	lb := &kubevip.LoadBalancer{Name: "test", OutlierDetection: &kubevip.OutlierDetection{ConsecutiveFailures: 1, MaxEjectionPercent: 100}, Backends: []kubevip.BackEnd{
+		{Address: "10.0.0.1", Port: 80, Alive: true},
+		{Address: "10.0.0.2", Port: 80, Alive: true},
+	}}
+	d, err := newOutlierDetector(lb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := backendAddress(&lb.Backends[0]), backendAddress(&lb.Backends[1])
+	d.failure(lb, &lb.Backends[0], first)
+	d.failure(lb, &lb.Backends[1], second)
+
+	// The first backend's ejection ends, the second is still ejected
+	d.backends[first].ejectedUntil = time.Now().Add(-time.Second)
+	d.tick()
+	if d.ejected(first) || !lb.Backends[0].IsAlive() {
+		t.Errorf("backend [%s] should have returned from ejection", first)
+	}
+	if !d.ejected(second) || lb.Backends[1].IsAlive() {
+		t.Errorf("backend [%s] should still be ejected", second)
+	}
+
+	// A backend that is removed is forgotten, so it no longer counts towards the ejected backends
+	lb.SetBackends(lb.Backends[:1])
+	d.tick()
+	if _, ok := d.backends[second]; ok {
+		t.Errorf("removed backend [%s] should have been forgotten", second)
+	}
+}
+
+func TestOutlierDetectorEjectionTime(t *testing.T) {
+	lb := &kubevip.LoadBalancer{Name: "test", OutlierDetection: &kubevip.OutlierDetection{ConsecutiveFailures: 1, MaxEjectionPercent: 100, BaseEjectionTime: 10, MaxEjectionTime: 30},
+		Backends: []kubevip.BackEnd{{Address: "10.0.0.1", Port: 80, Alive: true}}}
+	d, err := newOutlierDetector(lb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	be := &lb.Backends[0]
+	ep := backendAddress(be)
+	// Each ejection without a clean interval doubles the ejection time, up to the max
+	for _, want := range []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second} {
+		d.failure(lb, be, ep)
+		got := time.Until(d.backends[ep].ejectedUntil)
+		if got > want || got < want-time.Second {
+			t.Errorf("ejection time = %s, want %s", got, want)
+		}
+		d.backends[ep].ejectedUntil = time.Now().Add(-time.Second)
+		d.tick()
+	}
+}
+
+func TestOutlierDetectorNil(t *testing.T) {
+	lb := &kubevip.LoadBalancer{Name: "test", Backends: []kubevip.BackEnd{{Address: "10.0.0.1", Port: 80, Alive: true}}}
+	d, err := newOutlierDetector(lb)
+	if err != nil || d != nil {
+		t.Fatalf("newOutlierDetector() = %v, %v, want nil detection", d, err)
+	}
+	// Without outlier detection a backend is down on its first failure
+	be := &lb.Backends[0]
+	d.failure(lb, be, backendAddress(be))
+	if be.IsAlive() {
+		t.Error("backend should be down after its first failure")
+	}
+	d.tick()
+	if d.ejected(backendAddress(be)) || !d.admit(backendAddress(be)) || !d.acquire(backendAddress(be)) || d.full(backendAddress(be)) {
+		t.Error("nil detection shouldn't eject, hold back or limit a backend")
+	}
+}
+
+func TestOutlierDetectorConnectionLimit(t *testing.T) {
+	lb := &kubevip.LoadBalancer{Name: "test", OutlierDetection: &kubevip.OutlierDetection{MaxConnections: 2}, Backends: []kubevip.BackEnd{{Address: "10.0.0.1", Port: 80, Alive: true}}}
+	d, err := newOutlierDetector(lb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ep := backendAddress(&lb.Backends[0])
+	if !d.acquire(ep) || !d.acquire(ep) {
+		t.Fatal("a backend should be sent connections up to its limit")
+	}
+	if d.acquire(ep) || !d.full(ep) {
+		t.Fatal("a backend at its limit shouldn't be sent another connection")
+	}
+	d.release(ep)
+	if d.full(ep) || !d.acquire(ep) {
+		t.Error("a finished connection should make room for another")
+	}
+	// Releasing a backend that isn't known is ignored
+	d.release("10.0.0.2:80")
+	if d.full("10.0.0.2:80") {
+		t.Error("an unknown backend shouldn't be full")
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *kubevip.OutlierDetection
+		alive    []bool
+		ejected  []bool
+		active   []int
+		want     string
+		wantErr  error
+		wantDown bool // the chosen backend is left down
+	}{
+		{name: "next backend", alive: []bool{true, true}, want: "10.0.0.1:80"},
+		{name: "down backend is skipped", alive: []bool{false, true}, want: "10.0.0.2:80"},
+		{name: "every backend down without detection", alive: []bool{false, false}, want: "10.0.0.1:80", wantDown: true},
+		{name: "every backend down", config: &kubevip.OutlierDetection{}, alive: []bool{false, false}, ejected: []bool{true, false}, want: "10.0.0.2:80", wantDown: true},
+		{name: "every backend ejected", config: &kubevip.OutlierDetection{}, alive: []bool{false, false}, ejected: []bool{true, true}, wantErr: errBackendsUnavailable},
+		{name: "full backend is skipped", config: &kubevip.OutlierDetection{MaxConnections: 1}, alive: []bool{true, true}, active: []int{1, 0}, want: "10.0.0.2:80"},
+		{name: "every backend full", config: &kubevip.OutlierDetection{MaxConnections: 1}, alive: []bool{true, true}, active: []int{1, 1}, wantErr: errBackendsFull},
+		{name: "every backend down or full", config: &kubevip.OutlierDetection{MaxConnections: 1}, alive: []bool{false, false}, active: []int{1, 0}, want: "10.0.0.2:80", wantDown: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := &kubevip.LoadBalancer{Name: "test", OutlierDetection: tt.config, Backends: []kubevip.BackEnd{
+				{Address: "10.0.0.1", Port: 80, Alive: tt.alive[0]},
+				{Address: "10.0.0.2", Port: 80, Alive: tt.alive[1]},
+			}}
+			d, err := newOutlierDetector(lb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for x := range lb.Backends {
+				ep := backendAddress(&lb.Backends[x])
+				if len(tt.ejected) != 0 && tt.ejected[x] {
+					d.state(ep).ejectedUntil = time.Now().Add(time.Minute)
+				}
+				if len(tt.active) != 0 {
+					d.state(ep).active = tt.active[x]
+				}
+			}
+			index := -1
+			instance := &LBInstance{instance: lb, outliers: d, backendIndex: &index}
+
+			be, ep, err := instance.roundRobin()
+			if err != tt.wantErr {
+				t.Fatalf("roundRobin() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if ep != tt.want {
+				t.Errorf("roundRobin() = %s, want %s", ep, tt.want)
+			}
+			if be.IsAlive() == tt.wantDown {
+				t.Errorf("backend [%s] alive = %v, want %v", ep, be.IsAlive(), !tt.wantDown)
+			}
+			// A backend that is tried because every backend is down doesn't bring any backend back up
+			for x := range lb.Backends {
+				if lb.Backends[x].IsAlive() != tt.alive[x] {
+					t.Errorf("backend [%s] alive = %v, want %v", backendAddress(&lb.Backends[x]), lb.Backends[x].IsAlive(), tt.alive[x])
+				}
+				if len(tt.ejected) != 0 && d.ejected(backendAddress(&lb.Backends[x])) != tt.ejected[x] {
+					t.Errorf("backend [%s] ejected = %v, want %v", backendAddress(&lb.Backends[x]), !tt.ejected[x], tt.ejected[x])
+				}
+			}
+		})
+	}
+}
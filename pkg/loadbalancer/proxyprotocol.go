@@ -0,0 +1,54 @@
+package loadbalancer
+
+import (
+	"net"
+
+	"github.com/pires/go-proxyproto"
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+)
+
+// newProxyPolicy - returns the policy that only uses the PROXY protocol headers of the trusted sources of a load
+// balancer, a header from any other source is rejected. nil is returned if any source is trusted
+func newProxyPolicy(lb *kubevip.LoadBalancer) (proxyproto.PolicyFunc, error) {
+	if err := lb.ValidateProxyProtocol(); err != nil {
+		return nil, err
+	}
+	if len(lb.ProxyProtocolTrustedSources) == 0 {
+		return nil, nil
+	}
+	trusted, err := kubevip.ParseSources(lb.ProxyProtocolTrustedSources)
+	if err != nil {
+		return nil, err
+	}
+	return func(upstream net.Addr) (proxyproto.Policy, error) {
+		if ip := addrIP(upstream); ip != nil {
+			for _, cidr := range trusted {
+				if cidr.Contains(ip) {
+					return proxyproto.USE, nil
+				}
+			}
+		}
+		return proxyproto.REJECT, nil
+	}, nil
+}
+
+// proxyListener wraps the listener so that the client address is taken from the PROXY protocol header (v1 or v2)
+// of a proxy in front of the load balancer, if it accepts them. The header is only read once the connection is used.
+func (lb *LBInstance) proxyListener(l net.Listener) net.Listener {
+	if !lb.instance.AcceptProxyProtocol {
+		return l
+	}
+	return &proxyproto.Listener{Listener: l, Policy: lb.proxyPolicy}
+}
+
+// proxyHeaderError reads the PROXY protocol header of a connection, returning an error if it is invalid or was
+// sent by an untrusted source
+func proxyHeaderError(conn net.Conn) error {
+	pc, ok := conn.(*proxyproto.Conn)
+	if !ok {
+		return nil
+	}
+	// An empty read only reads the header
+	_, err := pc.Read(nil)
+	return err
+}
@@ -0,0 +1,50 @@
+package loadbalancer
+
+import (
+	"net"
+	"strconv"
+)
+
+// Status - the state of a running load balancer instance
+type Status struct {
+	Name      string          `json:"name"`
+	Type      string          `json:"type"`
+	Address   string          `json:"address"`
+	BindToVip bool            `json:"bindToVip"`
+	Backends  []BackendStatus `json:"backends"`
+}
+
+// BackendStatus - the state of a backend of a load balancer instance
+type BackendStatus struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	Alive   bool   `json:"alive"`
+}
+
+// Status - returns the state of all of the running load balancer instances
+func (lm *LBManager) Status() []Status {
+	lm.mux.Lock()
+	defer lm.mux.Unlock()
+
+	status := []Status{}
+	for x := range lm.loadBalancer {
+		lb := lm.loadBalancer[x].instance
+		s := Status{
+			Name:      lb.Name,
+			Type:      lb.Type,
+			Address:   net.JoinHostPort(lm.loadBalancer[x].bindAddress, strconv.Itoa(lb.Port)),
+			BindToVip: lb.BindToVip,
+			Backends:  []BackendStatus{},
+		}
+		backends := lb.CurrentBackends()
+		for y := range backends {
+			s.Backends = append(s.Backends, BackendStatus{
+				Address: backends[y].Address,
+				Port:    backends[y].Port,
+				Alive:   backends[y].IsAlive(),
+			})
+		}
+		status = append(status, s)
+	}
+	return status
+}
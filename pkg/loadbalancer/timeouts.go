@@ -0,0 +1,128 @@
+package loadbalancer
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+)
+
+// connTimeouts are the timeouts and keepalive of the connections of a load balancer
+type connTimeouts struct {
+	connect   time.Duration
+	idle      time.Duration
+	total     time.Duration
+	keepAlive time.Duration // zero is the default, negative disables
+}
+
+// newConnTimeouts - returns the timeouts of a load balancer, any that aren't configured are the default
+func newConnTimeouts(lb *kubevip.LoadBalancer) connTimeouts {
+	t := connTimeouts{connect: dialTMOUT}
+	if lb.Timeouts == nil {
+		return t
+	}
+	if lb.Timeouts.ConnectTimeout > 0 {
+		t.connect = time.Duration(lb.Timeouts.ConnectTimeout) * time.Millisecond
+	}
+	t.idle = time.Duration(lb.Timeouts.IdleTimeout) * time.Second
+	t.total = time.Duration(lb.Timeouts.TotalTimeout) * time.Second
+	t.keepAlive = time.Duration(lb.Timeouts.KeepAlive) * time.Second
+	return t
+}
+
+// dial - connects to a backend with the connect timeout and keepalive
+func (t connTimeouts) dial(network, address string) (net.Conn, error) {
+	d := net.Dialer{Timeout: t.connect, KeepAlive: t.keepAlive}
+	return d.Dial(network, address)
+}
+
+// setKeepAlive - applies the keepalive to an accepted connection, which otherwise has the default
+func (t connTimeouts) setKeepAlive(conn net.Conn) {
+	if t.keepAlive == 0 {
+		return
+	}
+	tcpConn, ok := rawConn(conn).(*net.TCPConn)
+	if !ok {
+		return
+	}
+	if t.keepAlive < 0 {
+		tcpConn.SetKeepAlive(false)
+		return
+	}
+	tcpConn.SetKeepAlive(true)
+	tcpConn.SetKeepAlivePeriod(t.keepAlive)
+}
+
+// rawConn returns the connection underneath any PROXY protocol wrapper
+func rawConn(conn net.Conn) net.Conn {
+	if pc, ok := conn.(*proxyproto.Conn); ok {
+		return pc.Raw()
+	}
+	return conn
+}
+
+// closeWrite - half-closes a connection, so the peer reads EOF but can still send, a connection that can't be
+// half-closed is closed
+func closeWrite(conn net.Conn) error {
+	if cw, ok := rawConn(conn).(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return conn.Close()
+}
+
+// activity tracks the data copied in both directions of a connection, so that it can be closed once it has been
+// idle for the idle timeout or has been open for the total timeout
+type activity struct {
+	idle     time.Duration
+	deadline time.Time // zero if there is no total timeout
+	lastSeen int64     // unix nanoseconds
+}
+
+func newActivity(t connTimeouts) *activity {
+	now := time.Now()
+	a := &activity{idle: t.idle, lastSeen: now.UnixNano()}
+	if t.total > 0 {
+		a.deadline = now.Add(t.total)
+	}
+	return a
+}
+
+func (a *activity) touch() {
+	atomic.StoreInt64(&a.lastSeen, time.Now().UnixNano())
+}
+
+// nextDeadline returns when the next read or write times out
+func (a *activity) nextDeadline() time.Time {
+	if a.idle == 0 {
+		return a.deadline
+	}
+	next := time.Now().Add(a.idle)
+	if !a.deadline.IsZero() && a.deadline.Before(next) {
+		return a.deadline
+	}
+	return next
+}
+
+// expired returns the timeout that has passed, or nil if the connection should continue
+func (a *activity) expired() error {
+	if !a.deadline.IsZero() && !time.Now().Before(a.deadline) {
+		return errTotalTimeout
+	}
+	if a.idle != 0 && time.Since(time.Unix(0, atomic.LoadInt64(&a.lastSeen))) >= a.idle {
+		return errIdleTimeout
+	}
+	return nil
+}
+
+var (
+	errIdleTimeout  = errors.New("idle timeout")
+	errTotalTimeout = errors.New("total timeout")
+)
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
@@ -0,0 +1,61 @@
+package loadbalancer
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestActivityExpired(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeouts connTimeouts
+		idleFor  time.Duration // how long ago the connection last copied data
+		openFor  time.Duration // how long ago the connection was opened
+		want     error
+	}{
+		{name: "no timeouts", idleFor: time.Hour, openFor: time.Hour, want: nil},
+		{name: "active", timeouts: connTimeouts{idle: time.Minute}, idleFor: time.Second, want: nil},
+		{name: "idle", timeouts: connTimeouts{idle: time.Minute}, idleFor: 2 * time.Minute, want: errIdleTimeout},
+		{name: "within the total timeout", timeouts: connTimeouts{total: time.Hour}, openFor: time.Minute, want: nil},
+		{name: "total timeout", timeouts: connTimeouts{total: time.Hour}, openFor: 2 * time.Hour, want: errTotalTimeout},
+		{name: "total timeout of an active connection", timeouts: connTimeouts{idle: time.Minute, total: time.Hour}, openFor: 2 * time.Hour, want: errTotalTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newActivity(tt.timeouts)
+			if !a.deadline.IsZero() {
+				a.deadline = a.deadline.Add(-tt.openFor)
+			}
+			atomic.StoreInt64(&a.lastSeen, time.Now().Add(-tt.idleFor).UnixNano())
+			if got := a.expired(); got != tt.want {
+				t.Errorf("expired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActivityTouch(t *testing.T) {
+	a := newActivity(connTimeouts{idle: time.Minute})
+	atomic.StoreInt64(&a.lastSeen, time.Now().Add(-2*time.Minute).UnixNano())
+	if a.expired() != errIdleTimeout {
+		t.Fatal("connection should be idle")
+	}
+	// Copying data resets the idle timeout
+	a.touch()
+	if err := a.expired(); err != nil {
+		t.Errorf("expired() = %v after the connection copied data", err)
+	}
+}
+
+func TestActivityNextDeadline(t *testing.T) {
+	a := newActivity(connTimeouts{idle: time.Minute, total: time.Second})
+	// The total timeout is sooner than the idle timeout
+	if next := a.nextDeadline(); !next.Equal(a.deadline) {
+		t.Errorf("nextDeadline() = %s, want the total timeout %s", next, a.deadline)
+	}
+	a = newActivity(connTimeouts{})
+	if next := a.nextDeadline(); !next.IsZero() {
+		t.Errorf("nextDeadline() = %s, want none", next)
+	}
+}
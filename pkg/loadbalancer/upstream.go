@@ -0,0 +1,117 @@
+package loadbalancer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/plunder-app/kube-vip/pkg/kubevip"
+	"github.com/sirupsen/logrus"
+)
+
+// newUpstreamTLS - returns the TLS client configuration of the backends of a load balancer, or nil if it has none. A
+// tls load balancer without any upstream TLS verifies its backends against the system roots
+func newUpstreamTLS(lb *kubevip.LoadBalancer) (*tls.Config, error) {
+	upstream := lb.UpstreamTLS
+	if upstream == nil {
+		if !strings.EqualFold(lb.Type, "tls") {
+			return nil, nil
+		}
+		upstream = &kubevip.UpstreamTLS{}
+	}
+	if err := upstream.Validate(); err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{ServerName: upstream.ServerName}
+	if upstream.CA != "" {
+		ca, err := ioutil.ReadFile(upstream.CA)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load upstream CA [%s] -> error [%v]", upstream.CA, err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in upstream CA [%s]", upstream.CA)
+		}
+	}
+	if upstream.Certificate != "" {
+		cert, err := tls.LoadX509KeyPair(upstream.Certificate, upstream.Key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load upstream certificate [%s] -> error [%v]", upstream.Certificate, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	switch upstream.Verify {
+	case kubevip.TLSVerifyNone:
+		config.InsecureSkipVerify = true
+	case kubevip.TLSVerifyCA:
+		// The chain is verified by hand, as the standard verification always checks the server name
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = verifyChain(config.RootCAs)
+	}
+	return config, nil
+}
+
+// verifyChain returns a verification of the certificate chain presented by a backend, against the roots (or the
+// system roots if nil) but not its server name
+func verifyChain(roots *x509.CertPool) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return fmt.Errorf("no certificate presented")
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		return err
+	}
+}
+
+// dialBackend - connects to a backend with the connect timeout, sending any PROXY protocol header and then, for a tls
+// load balancer, completing the TLS handshake within the connect timeout
+func (lb *LBInstance) dialBackend(connLog *logrus.Entry, timeouts connTimeouts, frontend net.Conn, endpoint string) (net.Conn, error) {
+	conn, err := timeouts.dial("tcp", endpoint)
+	if err != nil {
+		return nil, err
+	}
+	// The PROXY protocol header is sent in the clear, before any TLS
+	writeProxyProtocol(connLog, lb.instance, conn, frontend)
+	if lb.upstreamTLS == nil || !strings.EqualFold(lb.instance.Type, "tls") {
+		return conn, nil
+	}
+
+	config := lb.upstreamTLS
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(endpoint)
+	}
+	tlsConn := tls.Client(conn, config)
+	conn.SetDeadline(time.Now().Add(timeouts.connect))
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake failed [%v]", err)
+	}
+	conn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// upstreamTransport - returns the transport of a http load balancer, which uses the upstream TLS for https backends
+// (nil is the default transport)
+func (lb *LBInstance) upstreamTransport() http.RoundTripper {
+	if lb.upstreamTLS == nil {
+		return nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = lb.upstreamTLS
+	return transport
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	stdlog "log"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/sirupsen/logrus"
+)
+
+// hclogAdapter - writes the logs of libraries using hclog (such as Raft) through a logrus entry, so that they
+// share the same format and level
+type hclogAdapter struct {
+	entry *logrus.Entry
+	name  string
+}
+
+// NewHCLogger - returns an hclog logger that writes through the entry
+func NewHCLogger(entry *logrus.Entry) hclog.Logger {
+	return &hclogAdapter{entry: entry}
+}
+
+// withArgs converts the alternating key/value pairs of hclog into logrus fields
+func (h *hclogAdapter) withArgs(args []interface{}) *logrus.Entry {
+	fields := logrus.Fields{}
+	if h.name != "" {
+		fields["component"] = h.name
+	}
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			fields["EXTRA_VALUE_AT_END"] = args[i]
+			break
+		}
+		fields[fmt.Sprintf("%v", args[i])] = args[i+1]
+	}
+	return h.entry.WithFields(fields)
+}
+
+func (h *hclogAdapter) Trace(msg string, args ...interface{}) { h.withArgs(args).Trace(msg) }
+func (h *hclogAdapter) Debug(msg string, args ...interface{}) { h.withArgs(args).Debug(msg) }
+func (h *hclogAdapter) Info(msg string, args ...interface{})  { h.withArgs(args).Info(msg) }
+func (h *hclogAdapter) Warn(msg string, args ...interface{})  { h.withArgs(args).Warn(msg) }
+func (h *hclogAdapter) Error(msg string, args ...interface{}) { h.withArgs(args).Error(msg) }
+
+func (h *hclogAdapter) IsTrace() bool { return h.entry.Logger.IsLevelEnabled(logrus.TraceLevel) }
+func (h *hclogAdapter) IsDebug() bool { return h.entry.Logger.IsLevelEnabled(logrus.DebugLevel) }
+func (h *hclogAdapter) IsInfo() bool  { return h.entry.Logger.IsLevelEnabled(logrus.InfoLevel) }
+func (h *hclogAdapter) IsWarn() bool  { return h.entry.Logger.IsLevelEnabled(logrus.WarnLevel) }
+func (h *hclogAdapter) IsError() bool { return h.entry.Logger.IsLevelEnabled(logrus.ErrorLevel) }
+
+func (h *hclogAdapter) With(args ...interface{}) hclog.Logger {
+	return &hclogAdapter{entry: h.withArgs(args), name: h.name}
+}
+
+func (h *hclogAdapter) Named(name string) hclog.Logger {
+	if h.name != "" {
+		name = h.name + "." + name
+	}
+	return &hclogAdapter{entry: h.entry, name: name}
+}
+
+func (h *hclogAdapter) ResetNamed(name string) hclog.Logger {
+	return &hclogAdapter{entry: h.entry, name: name}
+}
+
+// SetLevel does nothing, the level is set through Configure
+func (h *hclogAdapter) SetLevel(level hclog.Level) {}
+
+func (h *hclogAdapter) StandardLogger(opts *hclog.StandardLoggerOptions) *stdlog.Logger {
+	return stdlog.New(h.StandardWriter(opts), "", 0)
+}
+
+func (h *hclogAdapter) StandardWriter(opts *hclog.StandardLoggerOptions) io.Writer {
+	return h.withArgs(nil).Writer()
+}
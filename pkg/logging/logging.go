@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The subsystems that can be logged at their own level
+const (
+	VIP          = "vip"
+	ARP          = "arp"
+	Raft         = "raft"
+	Election     = "election"
+	LoadBalancer = "loadbalancer"
+	Service      = "service"
+)
+
+// Subsystems - all of the subsystems that can be logged at their own level
+var Subsystems = []string{VIP, ARP, Raft, Election, LoadBalancer, Service}
+
+// The formats logs can be written in
+const (
+	FormatText   = "text"
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+var (
+	mux     sync.Mutex
+	loggers = make(map[string]*logrus.Logger)
+)
+
+// Logger - returns the logger of a subsystem, every entry has the subsystem as a field. The logger can be created
+// before logging is configured, Configure will update it.
+func Logger(subsystem string) *logrus.Entry {
+	mux.Lock()
+	defer mux.Unlock()
+
+	l, ok := loggers[subsystem]
+	if !ok {
+		std := logrus.StandardLogger()
+		l = logrus.New()
+		l.SetOutput(std.Out)
+		l.SetFormatter(std.Formatter)
+		l.SetLevel(std.GetLevel())
+		loggers[subsystem] = l
+	}
+	return l.WithField("subsystem", subsystem)
+}
+
+// Configure - sets the format and level of all logs, any subsystem in levels is logged at that level instead
+func Configure(format string, level logrus.Level, levels map[string]logrus.Level) error {
+	formatter, err := newFormatter(format)
+	if err != nil {
+		return err
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	logrus.SetFormatter(formatter)
+	logrus.SetOutput(os.Stderr)
+	logrus.SetLevel(level)
+	for _, subsystem := range Subsystems {
+		if _, ok := loggers[subsystem]; !ok {
+			loggers[subsystem] = logrus.New()
+		}
+	}
+	for subsystem, l := range loggers {
+		l.SetFormatter(formatter)
+		l.SetOutput(os.Stderr)
+		if subsystemLevel, ok := levels[subsystem]; ok {
+			l.SetLevel(subsystemLevel)
+		} else {
+			l.SetLevel(level)
+		}
+	}
+	return nil
+}
+
+func newFormatter(format string) (logrus.Formatter, error) {
+	switch strings.ToLower(format) {
+	case "", FormatText:
+		return &logrus.TextFormatter{}, nil
+	case FormatLogfmt:
+		return &logrus.TextFormatter{DisableColors: true, FullTimestamp: true}, nil
+	case FormatJSON:
+		return &logrus.JSONFormatter{}, nil
+	}
+	return nil, fmt.Errorf("Unknown log format [%s], expected %s, %s or %s", format, FormatText, FormatLogfmt, FormatJSON)
+}
+
+// ParseLevel - parses a level from its name (e.g. debug) or number (e.g. 5)
+func ParseLevel(level string) (logrus.Level, error) {
+	if n, err := strconv.ParseUint(level, 10, 32); err == nil {
+		return logrus.Level(n), nil
+	}
+	return logrus.ParseLevel(level)
+}
+
+// ParseLevels - parses the level of each subsystem, in the format subsystem=level (e.g. raft=warn or arp=5)
+func ParseLevels(levels []string) (map[string]logrus.Level, error) {
+	parsed := make(map[string]logrus.Level)
+	for _, l := range levels {
+		parts := strings.SplitN(l, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Unable to parse log level [%s], ensure it's in the format subsystem=level", l)
+		}
+		known := false
+		for _, subsystem := range Subsystems {
+			known = known || subsystem == parts[0]
+		}
+		if !known {
+			return nil, fmt.Errorf("Unknown log subsystem [%s], expected one of %s", parts[0], strings.Join(Subsystems, ", "))
+		}
+		level, err := ParseLevel(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		parsed[parts[0]] = level
+	}
+	return parsed, nil
+}
@@ -0,0 +1,6 @@
+package service
+
+import "github.com/plunder-app/kube-vip/pkg/logging"
+
+// The logger of the service
+var log = logging.Logger(logging.Service)
@@ -15,12 +15,10 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/plunder-app/kube-vip/pkg/cluster"
 	"github.com/plunder-app/kube-vip/pkg/kubevip"
-	log "github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	watchtools "k8s.io/client-go/tools/watch"
 
 	"k8s.io/apimachinery/pkg/watch"
@@ -41,6 +39,9 @@ var EnableArp bool
 // Interface - determines the interface that all Loadbalancers will bind too
 var Interface string
 
+// LeaderElection - determines the lock used for leader election, unset values use the service defaults
+var LeaderElection kubevip.LeaderElection
+
 type plndrServices struct {
 	Services []service `json:"services"`
 }
@@ -51,7 +52,7 @@ type serviceInstance struct {
 	// Kubernetes service mapping
 	service service
 	// cluster instance
-	cluster cluster.Cluster
+	cluster *cluster.Cluster
 }
 
 // TODO - call from a package (duplicated struct in the cloud-provider code)
@@ -90,7 +91,7 @@ func NewManager(configMap string) (*Manager, error) {
 	} else {
 		config, err := clientcmd.BuildConfigFromFlags("", filepath.Join(os.Getenv("HOME"), ".kube", "config"))
 		if err != nil {
-			panic(err.Error())
+			return nil, fmt.Errorf("error reading kubernetes configuration: %s", err.Error())
 		}
 		clientset, err = kubernetes.NewForConfig(config)
 
@@ -122,18 +123,20 @@ func (sm *Manager) Start() error {
 	listOptions := metav1.ListOptions{
 		FieldSelector: fmt.Sprintf("metadata.name=%s", sm.configMap),
 	}
-	log.Infof("Beginning cluster membership, namespace [%s], lock name [%s], id [%s]", ns, plunderLock, id)
-	// we use the Lease lock type since edits to Leases are less common
+	// Any unset values of the lock use the service defaults, the lock is created in the namespace of this pod
+	le := &LeaderElection
+	le.SetDefaults(plunderLock, ns, 10, 5, 1)
+	err = le.Validate()
+	if err != nil {
+		return err
+	}
+	log.Infof("Beginning cluster membership, namespace [%s], lock name [%s], lock type [%s], id [%s]", le.LeaseNamespace, le.LeaseName, le.LeaseLockType, id)
+
+	// we use the Lease lock type by default since edits to Leases are less common
 	// and fewer objects in the cluster watch "all Leases".
-	lock := &resourcelock.LeaseLock{
-		LeaseMeta: metav1.ObjectMeta{
-			Name:      plunderLock,
-			Namespace: ns,
-		},
-		Client: sm.clientSet.CoordinationV1(),
-		LockConfig: resourcelock.ResourceLockConfig{
-			Identity: id,
-		},
+	lock, err := cluster.NewLock(sm.clientSet, le, id)
+	if err != nil {
+		return err
 	}
 
 	// use a Go context so we can tell the leaderelection code when we
@@ -170,9 +173,9 @@ func (sm *Manager) Start() error {
 		// get elected before your background loop finished, violating
 		// the stated goal of the lease.
 		ReleaseOnCancel: true,
-		LeaseDuration:   10 * time.Second,
-		RenewDeadline:   5 * time.Second,
-		RetryPeriod:     1 * time.Second,
+		LeaseDuration:   time.Duration(le.LeaseDuration) * time.Second,
+		RenewDeadline:   time.Duration(le.RenewDeadline) * time.Second,
+		RetryPeriod:     time.Duration(le.RetryPeriod) * time.Second,
 		Callbacks: leaderelection.LeaderCallbacks{
 			OnStartedLeading: func(ctx context.Context) {
 				// we're notified when we start
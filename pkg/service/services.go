@@ -6,7 +6,6 @@ import (
 
 	"github.com/plunder-app/kube-vip/pkg/cluster"
 	"github.com/plunder-app/kube-vip/pkg/kubevip"
-	log "github.com/sirupsen/logrus"
 )
 
 func (sm *Manager) stopService(uid string) error {
@@ -62,13 +61,6 @@ func (sm *Manager) syncServices(ctx context.Context, s *plndrServices) error {
 		if foundInstance == false {
 			log.Infof("New VIP [%s] for [%s/%s] ", s.Services[x].Vip, s.Services[x].ServiceName, s.Services[x].UID)
 
-			// Generate Load Balancer configu
-			newLB := kubevip.LoadBalancer{
-				Name:      fmt.Sprintf("%s-load-balancer", s.Services[x].ServiceName),
-				Port:      s.Services[x].Port,
-				Type:      s.Services[x].Type,
-				BindToVip: true,
-			}
 
 			// Generate new Virtual IP configuration
 			newVip := kubevip.Config{
@@ -79,7 +71,12 @@ func (sm *Manager) syncServices(ctx context.Context, s *plndrServices) error {
 			}
 
 			// Add Load Balancer Configuration
-			newVip.LoadBalancers = append(newVip.LoadBalancers, newLB)
+			newVip.LoadBalancers = append(newVip.LoadBalancers, kubevip.LoadBalancer{
+				Name:      fmt.Sprintf("%s-load-balancer", s.Services[x].ServiceName),
+				Port:      s.Services[x].Port,
+				Type:      s.Services[x].Type,
+				BindToVip: true,
+			})
 			// Create new Virtual IP service for Manager
 			newService := &serviceInstance{
 				vipConfig: newVip,
@@ -97,7 +94,7 @@ func (sm *Manager) syncServices(ctx context.Context, s *plndrServices) error {
 				log.Errorf("Failed to add Service [%s] / [%s]", s.Services[x].ServiceName, s.Services[x].UID)
 				return err
 			}
-			newService.cluster = *c
+			newService.cluster = c
 			// Begin watching this service
 			go sm.newWatcher(ctx, newService)
 			// Add new service to manager configuration
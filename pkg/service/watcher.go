@@ -6,7 +6,7 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/plunder-app/kube-vip/pkg/kubevip"
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -51,7 +51,7 @@ func (sm *Manager) newWatcher(ctx context.Context, s *serviceInstance) error {
 			if !ok {
 				return fmt.Errorf("Unable to parse Endpoints from watcher")
 			}
-			s.vipConfig.LoadBalancers[0].Backends = rebuildEndpoints(*ep)
+			s.vipConfig.LoadBalancers[0].SetBackends(rebuildEndpoints(*ep))
 
 			log.Debugf("Load-Balancer updated with [%d] backends", len(s.vipConfig.LoadBalancers[0].Backends))
 		case watch.Deleted:
@@ -103,7 +103,7 @@ func rebuildEndpoints(eps v1.Endpoints) []kubevip.BackEnd {
 	for x := range addresses {
 		for y := range ports {
 			// Print out Backends if debug logging is enabled
-			if log.GetLevel() == log.DebugLevel {
+			if log.Logger.IsLevelEnabled(logrus.DebugLevel) {
 				fmt.Printf("-> Address: %s:%d \n", addresses[x], ports[y])
 			}
 			newBackend = append(newBackend, kubevip.BackEnd{
@@ -1,6 +1,8 @@
 package vip
 
 import (
+	"net"
+
 	"github.com/pkg/errors"
 	"github.com/vishvananda/netlink"
 )
@@ -24,7 +26,13 @@ type Network struct {
 func NewConfig(address, iface string) (result Network, err error) {
 	result = Network{}
 
-	result.address, err = netlink.ParseAddr(address + "/32")
+	// The VIP is a single host address, so use a full length mask for its family
+	mask := "/32"
+	if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+		mask = "/128"
+	}
+
+	result.address, err = netlink.ParseAddr(address + mask)
 	if err != nil {
 		err = errors.Wrapf(err, "could not parse address '%s'", address)
 
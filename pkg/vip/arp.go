@@ -6,15 +6,20 @@ package vip
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"net"
 	"syscall"
+	"time"
 	"unsafe"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/plunder-app/kube-vip/pkg/logging"
 )
 
+// The logger of ARP
+var log = logging.Logger(logging.ARP)
+
 const (
 	opARPRequest = 1
 	opARPReply   = 2
@@ -23,8 +28,12 @@ const (
 
 var (
 	ethernetBroadcast = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	ethernetZero      = net.HardwareAddr{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
 )
 
+// arpPollInterval is how often a blocking ARP read returns to check if it should stop
+const arpPollInterval = 250 * time.Millisecond
+
 func htons(p uint16) uint16 {
 	var b [2]byte
 	binary.BigEndian.PutUint16(b[:], p)
@@ -91,6 +100,144 @@ func gratuitousARPReply(ip net.IP, mac net.HardwareAddr) (*arpMessage, error) {
 	return m, nil
 }
 
+// gratuitousARPRequest returns an ARP message that contains a gratuitous ARP
+// request (an ARP announcement) from the specified sender.
+func gratuitousARPRequest(ip net.IP, mac net.HardwareAddr) (*arpMessage, error) {
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("%q is not an IPv4 address", ip)
+	}
+	if len(mac) != hwLen {
+		return nil, fmt.Errorf("%q is not an Ethernet MAC address", mac)
+	}
+
+	m := &arpMessage{
+		arpHeader{
+			1,            // Ethernet
+			0x0800,       // IPv4
+			hwLen,        // 48-bit MAC Address
+			net.IPv4len,  // 32-bit IPv4 Address
+			opARPRequest, // ARP Request
+		},
+		mac,
+		ip.To4(),
+		ethernetZero,
+		ip.To4(),
+	}
+
+	return m, nil
+}
+
+// arpProbe returns an ARP probe (RFC 5227) asking if any host on the network
+// is using the specified address, a probe carries an unspecified sender address
+// so that it does not update the ARP caches of other hosts.
+func arpProbe(ip net.IP, mac net.HardwareAddr) (*arpMessage, error) {
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("%q is not an IPv4 address", ip)
+	}
+	if len(mac) != hwLen {
+		return nil, fmt.Errorf("%q is not an Ethernet MAC address", mac)
+	}
+
+	m := &arpMessage{
+		arpHeader{
+			1,            // Ethernet
+			0x0800,       // IPv4
+			hwLen,        // 48-bit MAC Address
+			net.IPv4len,  // 32-bit IPv4 Address
+			opARPRequest, // ARP Request
+		},
+		mac,
+		net.IPv4zero.To4(),
+		ethernetZero,
+		ip.To4(),
+	}
+
+	return m, nil
+}
+
+// parseARP returns the ARP message from its wire representation.
+func parseARP(b []byte) (*arpMessage, error) {
+	// The fixed header is followed by two hardware and two protocol addresses
+	if len(b) < 8 {
+		return nil, fmt.Errorf("ARP message too short [%d] bytes", len(b))
+	}
+	m := &arpMessage{}
+	m.hardwareType = binary.BigEndian.Uint16(b[0:2])
+	m.protocolType = binary.BigEndian.Uint16(b[2:4])
+	m.hardwareAddressLength = b[4]
+	m.protocolAddressLength = b[5]
+	m.opcode = binary.BigEndian.Uint16(b[6:8])
+
+	hl, pl := int(m.hardwareAddressLength), int(m.protocolAddressLength)
+	if len(b) < 8+2*hl+2*pl {
+		return nil, fmt.Errorf("ARP message too short [%d] bytes", len(b))
+	}
+	b = b[8:]
+	m.senderHardwareAddress, b = b[:hl], b[hl:]
+	m.senderProtocolAddress, b = b[:pl], b[pl:]
+	m.targetHardwareAddress, b = b[:hl], b[hl:]
+	m.targetProtocolAddress = b[:pl]
+
+	return m, nil
+}
+
+// listenARP opens a socket that will receive all ARP messages arriving on the specified interface.
+func listenARP(iface *net.Interface) (int, error) {
+	return listenPackets(iface, syscall.ETH_P_ARP)
+}
+
+// listenPackets opens a socket that will receive all packets of the protocol arriving on the specified interface.
+func listenPackets(iface *net.Interface, protocol uint16) (int, error) {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM, int(htons(protocol)))
+	if err != nil {
+		return -1, fmt.Errorf("failed to get raw socket: %v", err)
+	}
+
+	ll := syscall.SockaddrLinklayer{
+		Protocol: htons(protocol),
+		Ifindex:  iface.Index,
+	}
+	if err := syscall.Bind(fd, &ll); err != nil {
+		syscall.Close(fd)
+		return -1, fmt.Errorf("failed to bind: %v", err)
+	}
+
+	// A receive timeout allows the caller to regularly check if it should stop listening
+	tv := syscall.NsecToTimeval(arpPollInterval.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return -1, fmt.Errorf("failed to set receive timeout: %v", err)
+	}
+
+	return fd, nil
+}
+
+// readConflict will read the next ARP message from the socket, returning the hardware address of the
+// sender if it is a host (other than this one) claiming the address. A nil address is returned if the
+// read timed out or the message wasn't a conflict.
+func readConflict(fd int, ip net.IP, local net.HardwareAddr) (net.HardwareAddr, error) {
+	buf := make([]byte, 128)
+	n, _, err := syscall.Recvfrom(fd, buf, 0)
+	if err != nil {
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to receive: %v", err)
+	}
+
+	m, err := parseARP(buf[:n])
+	if err != nil {
+		// Ignore anything that doesn't parse, it isn't a conflict we can act on
+		return nil, nil
+	}
+
+	sender := net.HardwareAddr(m.senderHardwareAddress)
+	if !net.IP(m.senderProtocolAddress).Equal(ip) || bytes.Equal(sender, local) {
+		return nil, nil
+	}
+	return append(net.HardwareAddr{}, sender...), nil
+}
+
 // sendARP sends the given ARP message via the specified interface.
 func sendARP(iface *net.Interface, m *arpMessage) error {
 	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM, int(htons(syscall.ETH_P_ARP)))
@@ -152,3 +299,118 @@ func ARPSendGratuitous(address, ifaceName string) error {
 	}
 	return sendARP(iface, m)
 }
+
+// ARPSendGratuitousRequest sends a gratuitous ARP request via the specified interface, some switches
+// will only update their tables from a request rather than a reply.
+func ARPSendGratuitousRequest(address, ifaceName string) error {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return fmt.Errorf("failed to get interface %q: %v", ifaceName, err)
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return fmt.Errorf("failed to parse address %s", address)
+	}
+
+	log.Infof("Broadcasting ARP request for %s (%s) via %s", address, iface.HardwareAddr, iface.Name)
+	m, err := gratuitousARPRequest(ip, iface.HardwareAddr)
+	if err != nil {
+		return err
+	}
+	return sendARP(iface, m)
+}
+
+// ARPProbe will send an ARP probe for the address via the specified interface, and wait for the timeout
+// for any other host to answer for it. The hardware address of the conflicting host is returned, or nil if
+// the address is free. IPv6 addresses are not probed, as the kernel duplicate address detection checks
+// them once they're added (see CheckDAD). The probe is abandoned if the context is cancelled.
+func ARPProbe(ctx context.Context, address, ifaceName string, timeout time.Duration) (net.HardwareAddr, error) {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get interface %q: %v", ifaceName, err)
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("failed to parse address %s", address)
+	}
+	if ip.To4() == nil {
+		return nil, nil
+	}
+
+	// Start listening before the probe is sent, so that no reply is missed
+	fd, err := listenARP(iface)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	log.Debugf("Probing for hosts using %s via %s", address, iface.Name)
+	m, err := arpProbe(ip, iface.HardwareAddr)
+	if err != nil {
+		return nil, err
+	}
+	if err = sendARP(iface, m); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		mac, err := readConflict(fd, ip, iface.HardwareAddr)
+		if err != nil {
+			return nil, err
+		}
+		if mac != nil {
+			conflictsDetected.Add(1)
+			return mac, nil
+		}
+	}
+	return nil, nil
+}
+
+// ARPMonitor will watch the specified interface for ARP messages from any other host claiming the address,
+// calling conflict with the hardware address of that host. An IPv6 address is claimed through NDP rather than
+// ARP, so the neighbor advertisements for it are watched instead. It blocks until the context is cancelled.
+func ARPMonitor(ctx context.Context, address, ifaceName string, conflict func(net.HardwareAddr)) error {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return fmt.Errorf("failed to get interface %q: %v", ifaceName, err)
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return fmt.Errorf("failed to parse address %s", address)
+	}
+
+	listen, read := listenARP, readConflict
+	if ip.To4() == nil {
+		listen, read = listenNDP, readNDPConflict
+	}
+	fd, err := listen(iface)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	log.Debugf("Monitoring for hosts claiming %s via %s", address, iface.Name)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		mac, err := read(fd, ip, iface.HardwareAddr)
+		if err != nil {
+			return err
+		}
+		if mac != nil {
+			conflictsDetected.Add(1)
+			conflict(mac)
+		}
+	}
+}
@@ -2,9 +2,34 @@
 
 package vip
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
 
 // ARPSendGratuitous is only supported on Linux, so return an error
 func ARPSendGratuitous(address, ifaceName string) error {
 	return fmt.Errorf("Unsupported on this OS")
 }
+
+// ARPSendGratuitousRequest is only supported on Linux, so return an error
+func ARPSendGratuitousRequest(address, ifaceName string) error {
+	return fmt.Errorf("Unsupported on this OS")
+}
+
+// ARPProbe is only supported on Linux, so return an error
+func ARPProbe(ctx context.Context, address, ifaceName string, timeout time.Duration) (net.HardwareAddr, error) {
+	return nil, fmt.Errorf("Unsupported on this OS")
+}
+
+// ARPMonitor is only supported on Linux, so return an error
+func ARPMonitor(ctx context.Context, address, ifaceName string, conflict func(net.HardwareAddr)) error {
+	return fmt.Errorf("Unsupported on this OS")
+}
+
+// CheckDAD is only supported on Linux, so return an error
+func (configurator Network) CheckDAD(ctx context.Context, timeout time.Duration) error {
+	return fmt.Errorf("Unsupported on this OS")
+}
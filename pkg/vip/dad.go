@@ -0,0 +1,54 @@
+// +build linux
+
+package vip
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+)
+
+// CheckDAD waits for the kernel to complete duplicate address detection for an IPv6 VIP, returning an
+// error if another host on the network already holds the address. IPv4 addresses are not checked by the
+// kernel, so will always pass (see ARPProbe). The wait is abandoned if the context is cancelled.
+func (configurator Network) CheckDAD(ctx context.Context, timeout time.Duration) error {
+	if configurator.address.IP.To4() != nil {
+		return nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		addresses, err := netlink.AddrList(configurator.link, netlink.FAMILY_V6)
+		if err != nil {
+			return errors.Wrap(err, "could not list addresses")
+		}
+
+		tentative := false
+		for _, address := range addresses {
+			if !address.IP.Equal(configurator.address.IP) {
+				continue
+			}
+			if address.Flags&syscall.IFA_F_DADFAILED != 0 {
+				conflictsDetected.Add(1)
+				return fmt.Errorf("duplicate address detection failed for %s, it is in use by another host", configurator.IP())
+			}
+			tentative = address.Flags&syscall.IFA_F_TENTATIVE != 0
+		}
+
+		if !tentative {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("duplicate address detection for %s did not complete within %s", configurator.IP(), timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package vip
+
+import "expvar"
+
+// Counters exposed through expvar (/debug/vars) for the virtual IP
+var (
+	// conflictsDetected is the number of times another host was found answering for the VIP
+	conflictsDetected = expvar.NewInt("vip_conflicts_detected")
+)
@@ -0,0 +1,93 @@
+// +build linux
+
+package vip
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+const (
+	ipv6HeaderLength = 40
+	// icmpv6NextHeader is the next header of an IPv6 packet that carries ICMPv6
+	icmpv6NextHeader = 58
+	// ndpHopLimit is the only hop limit of a valid NDP message, so that it can't have come from another link
+	ndpHopLimit = 255
+	// icmpv6NeighborAdvertisement is the ICMPv6 type of a neighbor advertisement (RFC 4861)
+	icmpv6NeighborAdvertisement = 136
+	// ndpTargetLinkLayerAddress is the option of a neighbor advertisement that carries the hardware address of the host
+	ndpTargetLinkLayerAddress = 2
+	// neighborAdvertisementLength is the ICMPv6 header and the fixed fields of a neighbor advertisement
+	neighborAdvertisementLength = 24
+)
+
+// listenNDP opens a socket that will receive all IPv6 packets arriving on the specified interface, which include
+// the neighbor advertisements sent to all nodes.
+func listenNDP(iface *net.Interface) (int, error) {
+	return listenPackets(iface, syscall.ETH_P_IPV6)
+}
+
+// readNDPConflict will read the next IPv6 packet from the socket, returning the hardware address of the sender
+// if it is a neighbor advertisement from a host (other than this one) claiming the address. A nil address is
+// returned if the read timed out or the packet wasn't a conflict.
+func readNDPConflict(fd int, ip net.IP, local net.HardwareAddr) (net.HardwareAddr, error) {
+	buf := make([]byte, 1500)
+	n, from, err := syscall.Recvfrom(fd, buf, 0)
+	if err != nil {
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to receive: %v", err)
+	}
+
+	// The advertisements this host sends are also seen by the socket
+	ll, ok := from.(*syscall.SockaddrLinklayer)
+	if ok && ll.Pkttype == syscall.PACKET_OUTGOING {
+		return nil, nil
+	}
+	target, sender, ok := parseNeighborAdvertisement(buf[:n])
+	if !ok || !target.Equal(ip) {
+		return nil, nil
+	}
+	// An advertisement without the option is from the host that sent the packet
+	if sender == nil && ll != nil && int(ll.Halen) <= len(ll.Addr) {
+		sender = net.HardwareAddr(ll.Addr[:ll.Halen])
+	}
+	if len(sender) == 0 || bytes.Equal(sender, local) {
+		return nil, nil
+	}
+	return append(net.HardwareAddr{}, sender...), nil
+}
+
+// parseNeighborAdvertisement returns the target address of a neighbor advertisement, and the hardware address
+// of its target link-layer address option (nil if it doesn't have one). Any packet that isn't a neighbor
+// advertisement (including one behind IPv6 extension headers) isn't parsed.
+func parseNeighborAdvertisement(b []byte) (net.IP, net.HardwareAddr, bool) {
+	if len(b) < ipv6HeaderLength+neighborAdvertisementLength || b[0]>>4 != 6 {
+		return nil, nil, false
+	}
+	if b[6] != icmpv6NextHeader || b[7] != ndpHopLimit {
+		return nil, nil, false
+	}
+	m := b[ipv6HeaderLength:]
+	if m[0] != icmpv6NeighborAdvertisement || m[1] != 0 {
+		return nil, nil, false
+	}
+	target := net.IP(append([]byte{}, m[8:24]...))
+
+	// Options are a type and a length in units of 8 bytes
+	var sender net.HardwareAddr
+	for options := m[neighborAdvertisementLength:]; len(options) >= 2; {
+		length := int(options[1]) * 8
+		if length == 0 || length > len(options) {
+			break
+		}
+		if options[0] == ndpTargetLinkLayerAddress && length >= 2+hwLen {
+			sender = net.HardwareAddr(options[2 : 2+hwLen])
+		}
+		options = options[length:]
+	}
+	return target, sender, true
+}